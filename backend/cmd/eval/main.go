@@ -0,0 +1,73 @@
+// Command eval scores extraction prompts against the gold-standard graphs in an evaluation directory.
+//
+//	go run ./cmd/eval -dir eval -prompts builtin,v2 -mode replay -v
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/eval"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+)
+
+func main() {
+	dir := flag.String("dir", "eval", "evaluation directory containing cases/ and prompts/")
+	prompts := flag.String("prompts", eval.BuiltinPromptVersion, "comma-separated prompt versions to compare")
+	mode := flag.String("mode", eval.ModeLive, "live calls the configured LLM provider, record also saves its responses, replay uses saved responses only")
+	threshold := flag.Float64("threshold", eval.DefaultMatchThreshold, "name similarity (0-1) required to match an element")
+	verbose := flag.Bool("v", false, "print per-case scores and mismatched elements")
+	asJSON := flag.Bool("json", false, "print the full report as JSON")
+	flag.Parse()
+
+	if *mode != eval.ModeLive && *mode != eval.ModeRecord && *mode != eval.ModeReplay {
+		log.Fatalf("Unknown mode %q: use live, record or replay", *mode)
+	}
+
+	var provider llm.Provider
+	var embedder llm.Embedder
+	if *mode != eval.ModeReplay {
+		var err error
+		if provider, err = llm.NewFromEnv(); err != nil {
+			log.Fatal("Failed to configure LLM provider: ", err)
+		}
+		if embedder, err = llm.NewEmbedderFromEnv(); err != nil {
+			log.Fatal("Failed to configure embedding model: ", err)
+		}
+	}
+
+	var versions []string
+	for _, version := range strings.Split(*prompts, ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			versions = append(versions, version)
+		}
+	}
+
+	report, err := eval.Run(context.Background(), eval.Options{
+		Dir:       *dir,
+		Versions:  versions,
+		Mode:      *mode,
+		Threshold: *threshold,
+		Provider:  provider,
+		Embedder:  embedder,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := eval.WriteTable(os.Stdout, report, *verbose); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/handlers"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/markdown"
+)
+
+// Imports a directory or .zip/.tar/.tar.gz archive of Markdown posts as narratives.
+// Usage: go run ./cmd/import [-analyze] <directory|archive>
+func main() {
+	analyze := flag.Bool("analyze", false, "analyze newly created narratives before exiting")
+	editor := flag.String("editor", "markdown-import", "editor recorded on the revisions this import creates")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		log.Fatal("Please provide a directory or archive of Markdown files as an argument")
+	}
+	source := flag.Arg(0)
+
+	info, err := os.Stat(source)
+	if err != nil {
+		log.Fatal("Failed to open source:", err)
+	}
+
+	var files []markdown.File
+	if info.IsDir() {
+		files, err = markdown.ReadDir(source)
+	} else {
+		var data []byte
+		data, err = os.ReadFile(source)
+		if err == nil {
+			files, err = markdown.ReadArchive(source, data)
+		}
+	}
+	if err != nil {
+		log.Fatal("Failed to read Markdown files:", err)
+	}
+	if len(files) == 0 {
+		log.Fatal("No Markdown files found in ", source)
+	}
+
+	db := database.NewDB()
+	defer db.Close(context.Background())
+
+	h := handlers.NewHandler(db)
+	report := h.ImportMarkdownFiles(context.Background(), files, *editor, *analyze, true)
+
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+}
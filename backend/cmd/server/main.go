@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
 	"github.com/anuragk02/jna-nuh-yoh-guh/internal/handlers"
@@ -16,7 +17,27 @@ func main() {
 	db := database.NewDB()
 	defer db.Close(context.Background())
 
+	// Apply pending schema migrations, retrying while Neo4j finishes starting up
+	for attempt := 1; ; attempt++ {
+		err := db.Migrate(context.Background())
+		if err == nil {
+			break
+		}
+		if attempt == 5 {
+			log.Printf("Warning: Schema migrations not applied, search will be unavailable: %v", err)
+			break
+		}
+		log.Printf("Schema migrations failed (attempt %d), retrying: %v", attempt, err)
+		time.Sleep(time.Duration(attempt) * 3 * time.Second)
+	}
+
 	h := handlers.NewHandler(db)
+
+	// Register built-in and PROMPTS_DIR prompt versions, activating defaults where none is active
+	if err := h.SyncPrompts(context.Background()); err != nil {
+		log.Printf("Warning: Prompt registry not synced, using built-in prompts: %v", err)
+	}
+
 	r := gin.Default()
 
 	// Configure CORS middleware
@@ -54,6 +75,8 @@ func main() {
 	api := r.Group("/api/v1")
 	// Apply authentication middleware to all /api/v1 routes
 	api.Use(handlers.AuthMiddleware())
+	// Cache-Control: no-cache or ?no_cache=true skips cached LLM and embedding responses
+	api.Use(handlers.CacheBypassMiddleware())
 	{
 		// Health Check
 		api.GET("/health", h.HealthCheck)
@@ -63,19 +86,101 @@ func main() {
 		{
 			narratives.POST("", h.CreateNarrativeNode)
 			narratives.GET("", h.GetNarratives)
+			// Markdown import - multipart upload of .md files or a .zip/.tar archive
+			narratives.POST("/import", h.ImportNarratives)
 			narratives.GET("/:id", h.GetNarrativeByID)
 			narratives.PUT("/:id", h.UpdateNarrativeNode)
 			narratives.DELETE("/:id", h.DeleteNarrativeNode)
+			// Revision history - every update is kept as an immutable NarrativeRevision
+			narratives.GET("/:id/revisions", h.ListNarrativeRevisions)
+			narratives.GET("/:id/revisions/diff", h.DiffNarrativeRevisions)
+			narratives.GET("/:id/revisions/:revision", h.GetNarrativeRevision)
+			narratives.POST("/:id/revisions/:revision/restore", h.RestoreNarrativeRevision)
+			// Narrative Graph - The mental model a narrative contributed, raw or consolidated
+			narratives.GET("/:id/graph", h.GetNarrativeGraph)
 			// LLM Workflow Endpoint - ID provided in request body
 			narratives.POST("/analyze", h.AnalyzeNarrative)
+			// Preview-then-commit Workflow - Store the extracted plan as a draft, then apply an edited version
+			narratives.POST("/:id/analysis/preview", h.PreviewNarrativeAnalysis)
+			narratives.GET("/:id/analysis/drafts/:draftId", h.GetAnalysisDraft)
+			narratives.POST("/:id/analysis/commit", h.CommitNarrativeAnalysis)
+			// Batch LLM Workflow Endpoint - Analyzes every narrative not yet extrapolated
+			narratives.POST("/analyze-pending", h.AnalyzePendingNarratives)
 		}
 
+		// Model Element Endpoints - CRUD for Systems, Stocks and Flows
+		for _, nodeType := range []string{"system", "stock", "flow"} {
+			elements := api.Group("/" + nodeType + "s")
+			{
+				elements.GET("", h.ListElements(nodeType))
+				elements.GET("/:id", h.GetElement(nodeType))
+				elements.POST("", h.CreateElement(nodeType))
+				elements.PUT("/:id", h.UpdateElement(nodeType))
+				elements.DELETE("/:id", h.DeleteElement(nodeType))
+			}
+		}
+
+		// Relationship Endpoints - Curate relationships between Systems, Stocks and Flows
+		relationships := api.Group("/relationships")
+		{
+			relationships.GET("", h.ListRelationships)
+			relationships.GET("/:id", h.GetRelationship)
+			relationships.POST("", h.CreateRelationship)
+			relationships.PUT("/:id", h.UpdateRelationship)
+			relationships.DELETE("/:id", h.DeleteRelationship)
+		}
+
+		// Graph Views - Subgraphs with properties for visualization
+		api.GET("/graph/neighborhood", h.GetGraphNeighborhood)
+
+		// Full-text Search Endpoint - Ranked, highlighted hits over narratives and concepts
+		api.GET("/search", h.Search)
+		// Semantic Search Endpoint - Concepts and narratives ranked by embedding similarity to a free-text query
+		api.POST("/search/semantic", h.SemanticSearch)
+
+		// Prompt Registry - Versioned LLM prompts with activation and rollback
+		prompts := api.Group("/prompts")
+		{
+			prompts.GET("", h.ListPrompts)
+			prompts.GET("/:name/:version", h.GetPromptVersion)
+			prompts.POST("/:name", h.CreatePromptVersion)
+			prompts.POST("/:name/rollback", h.RollbackPrompt)
+			prompts.POST("/:name/:version/activate", h.ActivatePromptVersion)
+		}
+
+		// Staged Extraction Runs - Inspect the stages of a staged analysis and rerun a failed stage
+		extractionRuns := api.Group("/extraction-runs")
+		{
+			extractionRuns.GET("", h.ListExtractionRuns)
+			extractionRuns.GET("/:id", h.GetExtractionRun)
+			extractionRuns.POST("/:id/stages/:stage/rerun", h.RerunExtractionStage)
+		}
+
+		// LLM Call Audit Log - Every generation and embedding request with usage and latency
+		api.GET("/llm-calls", h.ListLLMCalls)
+		api.GET("/llm-calls/:id", h.GetLLMCall)
+
+		// LLM Cache - Invalidate cached LLM and embedding responses
+		api.DELETE("/llm-cache", h.InvalidateLLMCache)
+
 		// Utility Endpoint to clean the graph
 		api.POST("/clean", h.CleanNonNarrativeData)
 
 		// Utility Endpoint to process embeddings for all unconsolidated nodes
 		api.POST("/embeddings", h.ProcessEmbeddings)
 
+		// Staging Area - Review, edit and approve unconsolidated extractions before consolidation
+		staging := api.Group("/staging")
+		{
+			staging.GET("", h.ListStaging)
+			staging.PUT("/nodes/:id", h.UpdateStagedNode)
+			staging.DELETE("/nodes/:id", h.DeleteStagedNode)
+			staging.POST("/nodes/:id/retype", h.RetypeStagedNode)
+			staging.PUT("/relationships/:id", h.UpdateStagedRelationship)
+			staging.DELETE("/relationships/:id", h.DeleteStagedRelationship)
+			staging.POST("/approve", h.ApproveStagingItems)
+		}
+
 		// Consolidation Endpoint - Main workflow for consolidating the graph
 		api.POST("/consolidate", h.ConsolidateGraph)
 
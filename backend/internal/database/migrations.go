@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Migration is a schema change applied once, in order, and recorded as a SchemaMigration node
+type Migration struct {
+	ID          string
+	Description string
+	Statements  []string
+}
+
+// migrations lists every schema change in the order it must be applied. Never edit an applied
+// migration; append a new one instead.
+var migrations = []Migration{
+	{
+		ID:          "0001_fulltext_search",
+		Description: "Full-text indexes over narratives and System/Stock/Flow concepts",
+		Statements: []string{
+			`CREATE FULLTEXT INDEX narrative_fulltext IF NOT EXISTS
+				FOR (n:Narrative) ON EACH [n.title, n.content]`,
+			`CREATE FULLTEXT INDEX concept_fulltext IF NOT EXISTS
+				FOR (n:System|Stock|Flow) ON EACH [n.name, n.description, n.boundary_description]`,
+		},
+	},
+	{
+		ID:          "0002_llm_call_indexes",
+		Description: "Indexes for looking up audited LLM calls by id, narrative and date",
+		Statements: []string{
+			`CREATE INDEX llm_call_id IF NOT EXISTS FOR (c:LLMCall) ON (c.id)`,
+			`CREATE INDEX llm_call_narrative_id IF NOT EXISTS FOR (c:LLMCall) ON (c.narrative_id)`,
+			`CREATE INDEX llm_call_created_at IF NOT EXISTS FOR (c:LLMCall) ON (c.created_at)`,
+		},
+	},
+	{
+		ID:          "0003_llm_cache_key",
+		Description: "Unique cache keys for cached LLM and embedding responses",
+		Statements: []string{
+			`CREATE CONSTRAINT llm_cache_entry_key IF NOT EXISTS FOR (e:LLMCacheEntry) REQUIRE e.key IS UNIQUE`,
+		},
+	},
+	{
+		ID:          "0004_extraction_runs",
+		Description: "Unique extraction run ids and indexes for looking up runs by narrative and stages by run",
+		Statements: []string{
+			`CREATE CONSTRAINT extraction_run_id IF NOT EXISTS FOR (r:ExtractionRun) REQUIRE r.id IS UNIQUE`,
+			`CREATE INDEX extraction_run_narrative_id IF NOT EXISTS FOR (r:ExtractionRun) ON (r.narrative_id)`,
+			`CREATE INDEX extraction_stage_run_id IF NOT EXISTS FOR (s:ExtractionStage) ON (s.run_id)`,
+		},
+	},
+	{
+		ID:          "0005_analysis_drafts",
+		Description: "Unique analysis draft ids",
+		Statements: []string{
+			`CREATE CONSTRAINT analysis_draft_id IF NOT EXISTS FOR (d:AnalysisDraft) REQUIRE d.id IS UNIQUE`,
+		},
+	},
+	{
+		ID:          "0006_narrative_revision_numbers",
+		Description: "Unique revision numbers per narrative, renumbering narratives whose concurrent edits shared one",
+		Statements: []string{
+			`MATCH (r:NarrativeRevision)
+			WITH r.narrative_id as narrative_id, r.number as number, count(*) as copies
+			WHERE copies > 1
+			WITH DISTINCT narrative_id
+			MATCH (r:NarrativeRevision {narrative_id: narrative_id})
+			WITH narrative_id, r ORDER BY r.number, r.created_at, r.id
+			WITH narrative_id, collect(r) as revisions
+			UNWIND range(0, size(revisions) - 1) as i
+			WITH revisions[i] as r, i
+			SET r.number = i + 1`,
+			`CREATE CONSTRAINT narrative_revision_number IF NOT EXISTS
+			FOR (r:NarrativeRevision) REQUIRE (r.narrative_id, r.number) IS UNIQUE`,
+		},
+	},
+}
+
+// Migrate applies all migrations that have not been recorded yet
+func (db *DB) Migrate(ctx context.Context) error {
+	records, err := db.ExecuteRead(ctx, `MATCH (m:SchemaMigration) RETURN m.id as id`, nil)
+	if err != nil {
+		return fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+
+	applied := make(map[string]bool)
+	for _, record := range records {
+		if id, ok := record["id"].(string); ok {
+			applied[id] = true
+		}
+	}
+
+	for _, migration := range migrations {
+		if applied[migration.ID] {
+			continue
+		}
+
+		log.Printf("Applying migration %s: %s", migration.ID, migration.Description)
+		for _, statement := range migration.Statements {
+			if _, err := db.ExecuteQuery(ctx, statement, nil); err != nil {
+				return fmt.Errorf("migration %s failed: %v", migration.ID, err)
+			}
+		}
+
+		_, err := db.ExecuteQuery(ctx, `CREATE (:SchemaMigration {id: $id, description: $description, applied_at: $applied_at})`,
+			map[string]interface{}{
+				"id":          migration.ID,
+				"description": migration.Description,
+				"applied_at":  time.Now().Format(time.RFC3339),
+			})
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %v", migration.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
 	"os"
 
@@ -68,3 +69,9 @@ func (db *DB) ExecuteRead(ctx context.Context, query string, params map[string]i
 
 	return records, result.Err()
 }
+
+// IsConstraintViolation reports whether err is Neo4j rejecting a write that would break a uniqueness constraint
+func IsConstraintViolation(err error) bool {
+	var neo4jErr *neo4j.Neo4jError
+	return errors.As(err, &neo4jErr) && neo4jErr.Code == "Neo.ClientError.Schema.ConstraintValidationFailed"
+}
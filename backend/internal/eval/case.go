@@ -0,0 +1,184 @@
+// Package eval scores extraction plans against hand-written gold-standard graphs.
+//
+// An evaluation directory holds one sub-directory per case:
+//
+//	cases/<name>/narrative.md     the narrative, optionally with YAML front matter
+//	cases/<name>/expected.json    the graph a good extraction should produce
+//	cases/<name>/recordings/      model exchanges recorded per prompt version, as llm.Fixtures
+//
+// and, optionally, alternative prompt versions to compare against the built-in one:
+//
+//	prompts/<version>/system.txt  system instruction
+//	prompts/<version>/user.txt    user prompt template with three %s verbs (vocabulary, title, content)
+//
+// The recordings shipped for the built-in prompt are hand-written responses, so replay mode runs offline and
+// its scores are stable; record them again with -mode record to score the live model.
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/handlers"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/markdown"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+// BuiltinPromptVersion names the extraction prompts compiled into the server
+const BuiltinPromptVersion = "builtin"
+
+// Graph is the set of elements an extraction produced or should produce, by name.
+// Expected names may list accepted alternatives separated by "|", e.g. "Mental Energy|Cognitive Energy".
+type Graph struct {
+	Systems     []string      `json:"systems"`
+	Stocks      []string      `json:"stocks"`
+	Flows       []string      `json:"flows"`
+	Changes     []ChangesEdge `json:"changes"`
+	CausalLinks []CausalEdge  `json:"causalLinks"`
+}
+
+// ChangesEdge is a CHANGES relationship from a flow to a stock
+type ChangesEdge struct {
+	Flow     string  `json:"flow"`
+	Stock    string  `json:"stock"`
+	Polarity float64 `json:"polarity"` // +1 increases the stock, -1 decreases it
+}
+
+// CausalEdge is a CAUSAL_LINK between two stocks or flows
+type CausalEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Case is one narrative paired with its expected graph
+type Case struct {
+	Name      string
+	Dir       string
+	Narrative *models.Narrative
+	Expected  Graph
+}
+
+// LoadCases reads every case under dir/cases, sorted by name
+func LoadCases(dir string) ([]Case, error) {
+	casesDir := filepath.Join(dir, "cases")
+	entries, err := os.ReadDir(casesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cases directory: %v", err)
+	}
+
+	var cases []Case
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		c, err := loadCase(entry.Name(), filepath.Join(casesDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, *c)
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, nil
+}
+
+func loadCase(name, dir string) (*Case, error) {
+	narrativePath := filepath.Join(dir, "narrative.md")
+	data, err := os.ReadFile(narrativePath)
+	if err != nil {
+		return nil, fmt.Errorf("case %s: %v", name, err)
+	}
+	doc, err := markdown.Parse(narrativePath, data)
+	if err != nil {
+		return nil, fmt.Errorf("case %s: %v", name, err)
+	}
+
+	expectedData, err := os.ReadFile(filepath.Join(dir, "expected.json"))
+	if err != nil {
+		return nil, fmt.Errorf("case %s: %v", name, err)
+	}
+	var expected Graph
+	if err := json.Unmarshal(expectedData, &expected); err != nil {
+		return nil, fmt.Errorf("case %s: invalid expected.json: %v", name, err)
+	}
+
+	return &Case{
+		Name: name,
+		Dir:  dir,
+		Narrative: &models.Narrative{
+			ID:      "eval_" + name,
+			Title:   doc.Title,
+			Content: doc.Content,
+		},
+		Expected: expected,
+	}, nil
+}
+
+// LoadPrompts returns the extraction prompts for a version: the built-in prompts, or the files under
+// dir/prompts/<version>
+func LoadPrompts(dir, version string) (handlers.ExtractionPrompts, error) {
+	if version == BuiltinPromptVersion {
+		return handlers.DefaultExtractionPrompts(), nil
+	}
+
+	versionDir := filepath.Join(dir, "prompts", version)
+	system, err := os.ReadFile(filepath.Join(versionDir, "system.txt"))
+	if err != nil {
+		return handlers.ExtractionPrompts{}, fmt.Errorf("prompt version %s: %v", version, err)
+	}
+	user, err := os.ReadFile(filepath.Join(versionDir, "user.txt"))
+	if err != nil {
+		return handlers.ExtractionPrompts{}, fmt.Errorf("prompt version %s: %v", version, err)
+	}
+	if count := strings.Count(string(user), "%s"); count != 3 {
+		return handlers.ExtractionPrompts{}, fmt.Errorf("prompt version %s: user.txt must contain three %%s verbs, found %d", version, count)
+	}
+
+	return handlers.ExtractionPrompts{System: string(system), UserTemplate: string(user)}, nil
+}
+
+// GraphFromPlan collects the elements a plan would write. Relationships are kept only when their endpoints
+// name nodes created in the same plan, matching how the server executes plans.
+func GraphFromPlan(plan *models.LLMResponse) Graph {
+	var graph Graph
+	stocks, flows := make(map[string]bool), make(map[string]bool)
+	for _, action := range plan.Actions {
+		name, _ := action.Parameters["name"].(string)
+		if name == "" {
+			continue
+		}
+		switch action.FunctionName {
+		case "CreateSystemNode":
+			graph.Systems = append(graph.Systems, name)
+		case "CreateStockNode":
+			graph.Stocks = append(graph.Stocks, name)
+			stocks[name] = true
+		case "CreateFlowNode":
+			graph.Flows = append(graph.Flows, name)
+			flows[name] = true
+		}
+	}
+
+	for _, action := range plan.Actions {
+		params := action.Parameters
+		switch action.FunctionName {
+		case "CreateChangesRelationship":
+			flowName, _ := params["flowName"].(string)
+			stockName, _ := params["stockName"].(string)
+			polarity, ok := params["polarity"].(float64)
+			if ok && flows[flowName] && stocks[stockName] {
+				graph.Changes = append(graph.Changes, ChangesEdge{Flow: flowName, Stock: stockName, Polarity: polarity})
+			}
+		case "CreateCausalLinkRelationship":
+			fromName, _ := params["fromName"].(string)
+			toName, _ := params["toName"].(string)
+			if (stocks[fromName] || flows[fromName]) && (stocks[toName] || flows[toName]) {
+				graph.CausalLinks = append(graph.CausalLinks, CausalEdge{From: fromName, To: toName})
+			}
+		}
+	}
+	return graph
+}
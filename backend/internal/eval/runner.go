@@ -0,0 +1,181 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/handlers"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+)
+
+// Modes for running a case: call the provider, call it and save the exchanges, or serve saved exchanges
+const (
+	ModeLive   = "live"
+	ModeRecord = llm.FixtureRecord
+	ModeReplay = llm.FixtureReplay
+)
+
+// Options configures an evaluation run
+type Options struct {
+	Dir       string       // Evaluation directory holding cases/ and prompts/
+	Versions  []string     // Prompt versions to compare; BuiltinPromptVersion is the compiled-in prompt
+	Mode      string       // ModeLive, ModeRecord or ModeReplay
+	Threshold float64      // Name similarity needed to match elements
+	Provider  llm.Provider // Model to extract with; unused in replay mode
+	Embedder  llm.Embedder // Merges near-duplicates across chunks; nil skips merging
+}
+
+// CaseResult is the score of one case under one prompt version
+type CaseResult struct {
+	Case          string `json:"case"`
+	PromptVersion string `json:"promptVersion"`
+	Score         Score  `json:"score"`
+	Error         string `json:"error,omitempty"`
+	DurationMs    int64  `json:"durationMs"`
+}
+
+// VersionSummary totals the scores of all cases under one prompt version
+type VersionSummary struct {
+	PromptVersion string `json:"promptVersion"`
+	Cases         int    `json:"cases"`
+	Failed        int    `json:"failed"`
+	Total         Score  `json:"total"`
+}
+
+// Report is the outcome of an evaluation run
+type Report struct {
+	Threshold float64          `json:"threshold"`
+	Mode      string           `json:"mode"`
+	Versions  []VersionSummary `json:"versions"`
+	Results   []CaseResult     `json:"results"`
+}
+
+// Run extracts every case with every prompt version and scores the plans against the expected graphs
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultMatchThreshold
+	}
+	cases, err := LoadCases(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no cases found in %s", opts.Dir)
+	}
+
+	report := &Report{Threshold: opts.Threshold, Mode: opts.Mode}
+	for _, version := range opts.Versions {
+		prompts, err := LoadPrompts(opts.Dir, version)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := VersionSummary{PromptVersion: version}
+		for _, c := range cases {
+			result := runCase(ctx, c, version, prompts, opts)
+			if result.Error != "" {
+				summary.Failed++
+			} else {
+				summary.Total.Add(result.Score)
+			}
+			summary.Cases++
+			report.Results = append(report.Results, result)
+		}
+		report.Versions = append(report.Versions, summary)
+	}
+	return report, nil
+}
+
+func runCase(ctx context.Context, c Case, version string, prompts handlers.ExtractionPrompts, opts Options) CaseResult {
+	result := CaseResult{Case: c.Name, PromptVersion: version}
+	started := time.Now()
+	defer func() { result.DurationMs = time.Since(started).Milliseconds() }()
+
+	provider, embedder := opts.Provider, opts.Embedder
+	if opts.Mode == ModeRecord || opts.Mode == ModeReplay {
+		fixtures, err := llm.NewFixtures(RecordingPath(c, version), opts.Mode)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		provider = fixtures.Provider(provider)
+		if embedder != nil || fixtures.Replaying() {
+			embedder = fixtures.Embedder(embedder)
+		}
+	}
+
+	h := handlers.NewHandlerWithProvider(nil, provider, embedder)
+	plan, err := h.ExtractNarrativePlan(ctx, c.Narrative, prompts)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Score = ScoreGraph(c.Expected, GraphFromPlan(plan), opts.Threshold)
+	return result
+}
+
+// RecordingPath is the fixture directory for a case and prompt version
+func RecordingPath(c Case, promptVersion string) string {
+	return filepath.Join(c.Dir, "recordings", promptVersion)
+}
+
+// WriteTable prints one row per prompt version, and with verbose one row per case plus its mismatches
+func WriteTable(w io.Writer, report *Report, verbose bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "PROMPT VERSION\tCASES\tFAILED\tNODES P\tNODES R\tNODES F1\tEDGES P\tEDGES R\tEDGES F1\tSYSTEMS F1\tSTOCKS F1\tFLOWS F1\tCHANGES F1\tCAUSAL F1\n")
+	for _, summary := range report.Versions {
+		columns := scoreColumns(summary.Total)
+		if summary.Failed == summary.Cases {
+			columns = strings.TrimSuffix(strings.Repeat("-\t", 11), "\t")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", summary.PromptVersion, summary.Cases, summary.Failed, columns)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !verbose {
+		return nil
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CASE\tPROMPT VERSION\tNODES P\tNODES R\tNODES F1\tEDGES P\tEDGES R\tEDGES F1\tSYSTEMS F1\tSTOCKS F1\tFLOWS F1\tCHANGES F1\tCAUSAL F1\n")
+	for _, result := range report.Results {
+		if result.Error != "" {
+			fmt.Fprintf(tw, "%s\t%s\tfailed: %s\n", result.Case, result.PromptVersion, result.Error)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Case, result.PromptVersion, scoreColumns(result.Score))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, result := range report.Results {
+		if len(result.Score.Missing) == 0 && len(result.Score.Spurious) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s [%s]\n", result.Case, result.PromptVersion)
+		if len(result.Score.Missing) > 0 {
+			fmt.Fprintf(w, "  missing:  %s\n", strings.Join(result.Score.Missing, "; "))
+		}
+		if len(result.Score.Spurious) > 0 {
+			fmt.Fprintf(w, "  spurious: %s\n", strings.Join(result.Score.Spurious, "; "))
+		}
+	}
+	return nil
+}
+
+func scoreColumns(s Score) string {
+	nodes, edges := s.Nodes(), s.Edges()
+	return fmt.Sprintf("%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f",
+		nodes.Precision(), nodes.Recall(), nodes.F1(),
+		edges.Precision(), edges.Recall(), edges.F1(),
+		s.Systems.F1(), s.Stocks.F1(), s.Flows.F1(), s.Changes.F1(), s.CausalLinks.F1())
+}
@@ -0,0 +1,64 @@
+package eval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// evalDir is the evaluation directory shipped with the repository
+const evalDir = "../../eval"
+
+func TestRunReplaysShippedRecordings(t *testing.T) {
+	report, err := Run(context.Background(), Options{Dir: evalDir, Versions: []string{BuiltinPromptVersion}, Mode: ModeReplay})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(report.Versions) != 1 || report.Versions[0].Failed != 0 {
+		t.Fatalf("Run() versions = %+v, want one version with no failed cases", report.Versions)
+	}
+	for _, result := range report.Results {
+		if result.Error != "" {
+			t.Errorf("case %s failed: %s", result.Case, result.Error)
+		}
+	}
+
+	// The recordings are fixed, so the scores are too
+	total := report.Versions[0].Total
+	if want := (Metrics{Matched: 12, Predicted: 13, Expected: 13}); total.Nodes() != want {
+		t.Errorf("nodes = %+v, want %+v", total.Nodes(), want)
+	}
+	if want := (Metrics{Matched: 6, Predicted: 9, Expected: 8}); total.Edges() != want {
+		t.Errorf("edges = %+v, want %+v", total.Edges(), want)
+	}
+}
+
+func TestRunReplayFailsWithoutRecording(t *testing.T) {
+	dir := t.TempDir()
+	caseDir := filepath.Join(dir, "cases", "unrecorded")
+	if err := os.MkdirAll(filepath.Join(caseDir, "recordings", BuiltinPromptVersion), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"narrative.md":  "---\ntitle: Unrecorded\n---\nA narrative nobody has recorded a model response for.\n",
+		"expected.json": `{"systems": [], "stocks": ["Anything"], "flows": [], "changes": [], "causalLinks": []}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(caseDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Run(context.Background(), Options{Dir: dir, Versions: []string{BuiltinPromptVersion}, Mode: ModeReplay})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Versions[0].Failed != 1 {
+		t.Fatalf("Failed = %d, want 1", report.Versions[0].Failed)
+	}
+	if got := report.Results[0].Error; !strings.Contains(got, "no recorded generate fixture") {
+		t.Errorf("Error = %q, want a missing fixture error", got)
+	}
+}
@@ -0,0 +1,313 @@
+package eval
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultMatchThreshold is the name similarity at or above which two names are considered the same element
+const DefaultMatchThreshold = 0.75
+
+// Metrics counts matches between predicted and expected elements of one kind
+type Metrics struct {
+	Matched   int `json:"matched"`
+	Predicted int `json:"predicted"`
+	Expected  int `json:"expected"`
+}
+
+// Add accumulates other into m
+func (m *Metrics) Add(other Metrics) {
+	m.Matched += other.Matched
+	m.Predicted += other.Predicted
+	m.Expected += other.Expected
+}
+
+// Precision is the share of predicted elements that were expected; 1 when nothing was predicted
+func (m Metrics) Precision() float64 {
+	if m.Predicted == 0 {
+		return 1
+	}
+	return float64(m.Matched) / float64(m.Predicted)
+}
+
+// Recall is the share of expected elements that were predicted; 1 when nothing was expected
+func (m Metrics) Recall() float64 {
+	if m.Expected == 0 {
+		return 1
+	}
+	return float64(m.Matched) / float64(m.Expected)
+}
+
+// F1 is the harmonic mean of precision and recall
+func (m Metrics) F1() float64 {
+	p, r := m.Precision(), m.Recall()
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// Score compares a predicted graph with the expected one, per element kind
+type Score struct {
+	Systems     Metrics `json:"systems"`
+	Stocks      Metrics `json:"stocks"`
+	Flows       Metrics `json:"flows"`
+	Changes     Metrics `json:"changes"`
+	CausalLinks Metrics `json:"causalLinks"`
+
+	Missing  []string `json:"missing,omitempty"`  // Expected elements with no match
+	Spurious []string `json:"spurious,omitempty"` // Predicted elements with no match
+}
+
+// Nodes sums the system, stock and flow metrics
+func (s Score) Nodes() Metrics {
+	var m Metrics
+	m.Add(s.Systems)
+	m.Add(s.Stocks)
+	m.Add(s.Flows)
+	return m
+}
+
+// Edges sums the CHANGES and causal link metrics
+func (s Score) Edges() Metrics {
+	var m Metrics
+	m.Add(s.Changes)
+	m.Add(s.CausalLinks)
+	return m
+}
+
+// Add accumulates other's metrics into s
+func (s *Score) Add(other Score) {
+	s.Systems.Add(other.Systems)
+	s.Stocks.Add(other.Stocks)
+	s.Flows.Add(other.Flows)
+	s.Changes.Add(other.Changes)
+	s.CausalLinks.Add(other.CausalLinks)
+}
+
+// ScoreGraph matches predicted nodes to expected nodes one-to-one by fuzzy name similarity, then matches
+// edges whose endpoints map onto the expected edge's endpoints. CHANGES edges must also agree on polarity.
+func ScoreGraph(expected, predicted Graph, threshold float64) Score {
+	var score Score
+
+	systemMatches := matchNames(expected.Systems, predicted.Systems, threshold)
+	stockMatches := matchNames(expected.Stocks, predicted.Stocks, threshold)
+	flowMatches := matchNames(expected.Flows, predicted.Flows, threshold)
+
+	score.Systems = nodeMetrics(expected.Systems, predicted.Systems, systemMatches, "system", &score)
+	score.Stocks = nodeMetrics(expected.Stocks, predicted.Stocks, stockMatches, "stock", &score)
+	score.Flows = nodeMetrics(expected.Flows, predicted.Flows, flowMatches, "flow", &score)
+
+	// Map each predicted name to the expected element it matched, for edge comparison
+	aligned := func(matches map[int]int, expectedNames, predictedNames []string) map[string]string {
+		m := make(map[string]string)
+		for p, e := range matches {
+			m[predictedNames[p]] = expectedNames[e]
+		}
+		return m
+	}
+	stockAlignment := aligned(stockMatches, expected.Stocks, predicted.Stocks)
+	flowAlignment := aligned(flowMatches, expected.Flows, predicted.Flows)
+	elementAlignment := make(map[string]string)
+	for k, v := range stockAlignment {
+		elementAlignment[k] = v
+	}
+	for k, v := range flowAlignment {
+		elementAlignment[k] = v
+	}
+
+	// Expected edges may name an endpoint by any of its alternatives
+	canonical := make(map[string]string)
+	for _, name := range append(append(append([]string{}, expected.Systems...), expected.Stocks...), expected.Flows...) {
+		canonical[name] = name
+		for _, alternative := range strings.Split(name, "|") {
+			canonical[strings.TrimSpace(alternative)] = name
+		}
+	}
+	resolve := func(name string) string {
+		if full, ok := canonical[name]; ok {
+			return full
+		}
+		return name
+	}
+	expected.Changes = append([]ChangesEdge(nil), expected.Changes...)
+	expected.CausalLinks = append([]CausalEdge(nil), expected.CausalLinks...)
+	for i, edge := range expected.Changes {
+		expected.Changes[i].Flow, expected.Changes[i].Stock = resolve(edge.Flow), resolve(edge.Stock)
+	}
+	for i, edge := range expected.CausalLinks {
+		expected.CausalLinks[i].From, expected.CausalLinks[i].To = resolve(edge.From), resolve(edge.To)
+	}
+
+	// CHANGES
+	expectedChanges := make(map[string]bool)
+	for _, edge := range expected.Changes {
+		expectedChanges[changesKey(edge.Flow, edge.Stock, edge.Polarity)] = true
+	}
+	matchedChanges := make(map[string]bool)
+	for _, edge := range predicted.Changes {
+		key := changesKey(flowAlignment[edge.Flow], stockAlignment[edge.Stock], edge.Polarity)
+		if expectedChanges[key] && !matchedChanges[key] {
+			matchedChanges[key] = true
+			continue
+		}
+		score.Spurious = append(score.Spurious, "changes: "+edge.Flow+" -> "+edge.Stock)
+	}
+	for _, edge := range expected.Changes {
+		if !matchedChanges[changesKey(edge.Flow, edge.Stock, edge.Polarity)] {
+			score.Missing = append(score.Missing, "changes: "+displayName(edge.Flow)+" -> "+displayName(edge.Stock))
+		}
+	}
+	score.Changes = Metrics{Matched: len(matchedChanges), Predicted: len(predicted.Changes), Expected: len(expected.Changes)}
+
+	// CAUSAL_LINK
+	expectedLinks := make(map[string]bool)
+	for _, edge := range expected.CausalLinks {
+		expectedLinks[edge.From+"\x00"+edge.To] = true
+	}
+	matchedLinks := make(map[string]bool)
+	for _, edge := range predicted.CausalLinks {
+		key := elementAlignment[edge.From] + "\x00" + elementAlignment[edge.To]
+		if expectedLinks[key] && !matchedLinks[key] {
+			matchedLinks[key] = true
+			continue
+		}
+		score.Spurious = append(score.Spurious, "causal link: "+edge.From+" -> "+edge.To)
+	}
+	for _, edge := range expected.CausalLinks {
+		if !matchedLinks[edge.From+"\x00"+edge.To] {
+			score.Missing = append(score.Missing, "causal link: "+displayName(edge.From)+" -> "+displayName(edge.To))
+		}
+	}
+	score.CausalLinks = Metrics{Matched: len(matchedLinks), Predicted: len(predicted.CausalLinks), Expected: len(expected.CausalLinks)}
+
+	return score
+}
+
+// displayName returns the first of an expected name's alternatives
+func displayName(name string) string {
+	return strings.TrimSpace(strings.Split(name, "|")[0])
+}
+
+func changesKey(flow, stock string, polarity float64) string {
+	sign := "+"
+	if polarity < 0 {
+		sign = "-"
+	}
+	return flow + "\x00" + stock + "\x00" + sign
+}
+
+func nodeMetrics(expected, predicted []string, matches map[int]int, kind string, score *Score) Metrics {
+	matchedExpected := make(map[int]bool)
+	for p := range predicted {
+		if e, ok := matches[p]; ok {
+			matchedExpected[e] = true
+		} else {
+			score.Spurious = append(score.Spurious, kind+": "+predicted[p])
+		}
+	}
+	for e := range expected {
+		if !matchedExpected[e] {
+			score.Missing = append(score.Missing, kind+": "+displayName(expected[e]))
+		}
+	}
+	return Metrics{Matched: len(matches), Predicted: len(predicted), Expected: len(expected)}
+}
+
+// matchNames pairs predicted names with expected names one-to-one, most similar pairs first.
+// It returns predicted index -> expected index for pairs at or above threshold.
+func matchNames(expected, predicted []string, threshold float64) map[int]int {
+	type pair struct {
+		e, p       int
+		similarity float64
+	}
+	var pairs []pair
+	for e, expectedName := range expected {
+		for p, predictedName := range predicted {
+			best := 0.0
+			for _, alternative := range strings.Split(expectedName, "|") {
+				best = math.Max(best, NameSimilarity(alternative, predictedName))
+			}
+			if best >= threshold {
+				pairs = append(pairs, pair{e, p, best})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].similarity > pairs[j].similarity })
+
+	matches := make(map[int]int)
+	usedExpected := make(map[int]bool)
+	for _, candidate := range pairs {
+		if _, used := matches[candidate.p]; used || usedExpected[candidate.e] {
+			continue
+		}
+		matches[candidate.p] = candidate.e
+		usedExpected[candidate.e] = true
+	}
+	return matches
+}
+
+// NameSimilarity scores two element names between 0 and 1: the better of token-set overlap (Dice) and normalized
+// edit distance, after lowercasing, dropping punctuation and trimming plural "s"
+func NameSimilarity(a, b string) float64 {
+	tokensA, tokensB := nameTokens(a), nameTokens(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	setA := make(map[string]bool)
+	for _, t := range tokensA {
+		setA[t] = true
+	}
+	setB := make(map[string]bool)
+	for _, t := range tokensB {
+		setB[t] = true
+	}
+	intersection := 0
+	for t := range setA {
+		if setB[t] {
+			intersection++
+		}
+	}
+	dice := 2 * float64(intersection) / float64(len(setA)+len(setB))
+
+	joinedA, joinedB := []rune(strings.Join(tokensA, " ")), []rune(strings.Join(tokensB, " "))
+	longest := max(len(joinedA), len(joinedB))
+	edit := 1 - float64(levenshtein(joinedA, joinedB))/float64(longest)
+
+	return math.Max(dice, edit)
+}
+
+func nameTokens(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, field := range fields {
+		if len(field) > 3 && strings.HasSuffix(field, "s") && !strings.HasSuffix(field, "ss") {
+			fields[i] = strings.TrimSuffix(field, "s")
+		}
+	}
+	return fields
+}
+
+func levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,268 @@
+package eval
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-3
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"debt", "debt", 0},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"café", "cafe", 1}, // Counts runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein([]rune(tt.b), []rune(tt.a)); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{"identical", "Technical Debt", "Technical Debt", 1},
+		{"case and punctuation", "Technical-Debt!", "technical debt", 1},
+		{"token order", "Debt Technical", "Technical Debt", 1},
+		{"plural", "Stocks", "Stock", 1},
+		{"only a single trailing s is trimmed", "Stress", "Stres", 0.667}, // "stress" vs "stre"
+		{"edit distance wins", "Mental Energy", "Mental Energies", 0.857},
+		{"extra token", "Refactoring", "Code Refactoring", 0.688},
+		{"token overlap wins", "Delivery Speed", "Speed of Delivery", 0.8},
+		{"unrelated", "Sleep", "Frustration", 0.091},
+		{"empty", "", "Technical Debt", 0},
+		{"punctuation only", "!!!", "!!!", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NameSimilarity(tt.a, tt.b); !approxEqual(got, tt.want) {
+				t.Errorf("NameSimilarity(%q, %q) = %.4f, want %.3f", tt.a, tt.b, got, tt.want)
+			}
+			if got := NameSimilarity(tt.b, tt.a); !approxEqual(got, tt.want) {
+				t.Errorf("NameSimilarity(%q, %q) = %.4f, want %.3f", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	tests := []struct {
+		name                  string
+		metrics               Metrics
+		precision, recall, f1 float64
+	}{
+		{"nothing predicted or expected", Metrics{}, 1, 1, 1},
+		{"nothing predicted", Metrics{Expected: 2}, 1, 0, 0},
+		{"nothing expected", Metrics{Predicted: 2}, 0, 1, 0},
+		{"no matches", Metrics{Matched: 0, Predicted: 2, Expected: 2}, 0, 0, 0},
+		{"perfect", Metrics{Matched: 3, Predicted: 3, Expected: 3}, 1, 1, 1},
+		{"over-predicted", Metrics{Matched: 2, Predicted: 4, Expected: 2}, 0.5, 1, 0.667},
+		{"under-predicted", Metrics{Matched: 1, Predicted: 1, Expected: 4}, 1, 0.25, 0.4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.metrics.Precision(); !approxEqual(got, tt.precision) {
+				t.Errorf("Precision() = %.4f, want %.3f", got, tt.precision)
+			}
+			if got := tt.metrics.Recall(); !approxEqual(got, tt.recall) {
+				t.Errorf("Recall() = %.4f, want %.3f", got, tt.recall)
+			}
+			if got := tt.metrics.F1(); !approxEqual(got, tt.f1) {
+				t.Errorf("F1() = %.4f, want %.3f", got, tt.f1)
+			}
+		})
+	}
+}
+
+func TestMatchNamesIsOneToOne(t *testing.T) {
+	expected := []string{"Technical Debt", "Delivery Velocity|Delivery Speed"}
+	predicted := []string{"Tech Debt", "Technical Debt", "Delivery Speed", "Morale"}
+
+	matches := matchNames(expected, predicted, DefaultMatchThreshold)
+
+	want := map[int]int{1: 0, 2: 1} // The exact name beats the abbreviation; alternatives are matched too
+	if len(matches) != len(want) {
+		t.Fatalf("matchNames() = %v, want %v", matches, want)
+	}
+	for p, e := range want {
+		if matches[p] != e {
+			t.Errorf("matchNames() = %v, want %v", matches, want)
+		}
+	}
+}
+
+func TestScoreGraph(t *testing.T) {
+	expected := Graph{
+		Systems: []string{"Software Development Process|Software Development Lifecycle"},
+		Stocks:  []string{"Technical Debt", "Delivery Velocity|Delivery Speed"},
+		Flows:   []string{"Debt Accumulation|Shortcut Implementation", "Refactoring"},
+		Changes: []ChangesEdge{
+			{Flow: "Debt Accumulation", Stock: "Technical Debt", Polarity: 1},
+			{Flow: "Refactoring", Stock: "Technical Debt", Polarity: -1},
+		},
+		CausalLinks: []CausalEdge{
+			{From: "Technical Debt", To: "Delivery Velocity"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		predicted Graph
+		want      Score
+		missing   []string
+		spurious  []string
+	}{
+		{
+			name: "perfect extraction using alternative names",
+			predicted: Graph{
+				Systems: []string{"Software Development Lifecycle"},
+				Stocks:  []string{"Technical Debt", "Delivery Speed"},
+				Flows:   []string{"Shortcut Implementation", "Refactoring"},
+				Changes: []ChangesEdge{
+					{Flow: "Shortcut Implementation", Stock: "Technical Debt", Polarity: 1},
+					{Flow: "Refactoring", Stock: "Technical Debt", Polarity: -1},
+				},
+				CausalLinks: []CausalEdge{{From: "Technical Debt", To: "Delivery Speed"}},
+			},
+			want: Score{
+				Systems:     Metrics{Matched: 1, Predicted: 1, Expected: 1},
+				Stocks:      Metrics{Matched: 2, Predicted: 2, Expected: 2},
+				Flows:       Metrics{Matched: 2, Predicted: 2, Expected: 2},
+				Changes:     Metrics{Matched: 2, Predicted: 2, Expected: 2},
+				CausalLinks: Metrics{Matched: 1, Predicted: 1, Expected: 1},
+			},
+		},
+		{
+			name: "wrong polarity, reversed causal link and an extra stock",
+			predicted: Graph{
+				Systems: []string{"Software Development Process"},
+				Stocks:  []string{"Technical Debt", "Delivery Velocity", "Team Morale"},
+				Flows:   []string{"Debt Accumulation", "Refactoring"},
+				Changes: []ChangesEdge{
+					{Flow: "Debt Accumulation", Stock: "Technical Debt", Polarity: 1},
+					{Flow: "Refactoring", Stock: "Technical Debt", Polarity: 1},
+				},
+				CausalLinks: []CausalEdge{{From: "Delivery Velocity", To: "Technical Debt"}},
+			},
+			want: Score{
+				Systems:     Metrics{Matched: 1, Predicted: 1, Expected: 1},
+				Stocks:      Metrics{Matched: 2, Predicted: 3, Expected: 2},
+				Flows:       Metrics{Matched: 2, Predicted: 2, Expected: 2},
+				Changes:     Metrics{Matched: 1, Predicted: 2, Expected: 2},
+				CausalLinks: Metrics{Matched: 0, Predicted: 1, Expected: 1},
+			},
+			missing: []string{
+				"changes: Refactoring -> Technical Debt",
+				"causal link: Technical Debt -> Delivery Velocity",
+			},
+			spurious: []string{
+				"stock: Team Morale",
+				"changes: Refactoring -> Technical Debt",
+				"causal link: Delivery Velocity -> Technical Debt",
+			},
+		},
+		{
+			name: "edges between unmatched nodes do not count",
+			predicted: Graph{
+				Stocks:  []string{"Code Complexity"},
+				Flows:   []string{"Feature Work"},
+				Changes: []ChangesEdge{{Flow: "Feature Work", Stock: "Code Complexity", Polarity: 1}},
+			},
+			want: Score{
+				Systems:     Metrics{Matched: 0, Predicted: 0, Expected: 1},
+				Stocks:      Metrics{Matched: 0, Predicted: 1, Expected: 2},
+				Flows:       Metrics{Matched: 0, Predicted: 1, Expected: 2},
+				Changes:     Metrics{Matched: 0, Predicted: 1, Expected: 2},
+				CausalLinks: Metrics{Matched: 0, Predicted: 0, Expected: 1},
+			},
+			missing: []string{
+				"system: Software Development Process",
+				"stock: Technical Debt",
+				"stock: Delivery Velocity",
+				"flow: Debt Accumulation",
+				"flow: Refactoring",
+				"changes: Debt Accumulation -> Technical Debt",
+				"changes: Refactoring -> Technical Debt",
+				"causal link: Technical Debt -> Delivery Velocity",
+			},
+			spurious: []string{
+				"stock: Code Complexity",
+				"flow: Feature Work",
+				"changes: Feature Work -> Code Complexity",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScoreGraph(expected, tt.predicted, DefaultMatchThreshold)
+
+			kinds := []struct {
+				name      string
+				got, want Metrics
+			}{
+				{"systems", got.Systems, tt.want.Systems},
+				{"stocks", got.Stocks, tt.want.Stocks},
+				{"flows", got.Flows, tt.want.Flows},
+				{"changes", got.Changes, tt.want.Changes},
+				{"causal links", got.CausalLinks, tt.want.CausalLinks},
+			}
+			for _, kind := range kinds {
+				if kind.got != kind.want {
+					t.Errorf("%s = %+v, want %+v", kind.name, kind.got, kind.want)
+				}
+			}
+			assertSameElements(t, "missing", got.Missing, tt.missing)
+			assertSameElements(t, "spurious", got.Spurious, tt.spurious)
+		})
+	}
+
+	// Scoring resolves alternatives on a copy and must leave the expected graph untouched
+	if expected.Changes[0].Flow != "Debt Accumulation" || expected.CausalLinks[0].To != "Delivery Velocity" {
+		t.Errorf("ScoreGraph modified the expected graph: %+v", expected)
+	}
+}
+
+func TestScoreAdd(t *testing.T) {
+	var total Score
+	total.Add(Score{Stocks: Metrics{Matched: 1, Predicted: 2, Expected: 2}, Changes: Metrics{Matched: 1, Predicted: 1, Expected: 1}})
+	total.Add(Score{Stocks: Metrics{Matched: 2, Predicted: 2, Expected: 3}, Flows: Metrics{Predicted: 1}})
+
+	if want := (Metrics{Matched: 3, Predicted: 4, Expected: 5}); total.Stocks != want {
+		t.Errorf("Stocks = %+v, want %+v", total.Stocks, want)
+	}
+	if want := (Metrics{Matched: 3, Predicted: 5, Expected: 5}); total.Nodes() != want {
+		t.Errorf("Nodes() = %+v, want %+v", total.Nodes(), want)
+	}
+	if want := (Metrics{Matched: 1, Predicted: 1, Expected: 1}); total.Edges() != want {
+		t.Errorf("Edges() = %+v, want %+v", total.Edges(), want)
+	}
+}
+
+func assertSameElements(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("%s = %q, want %q", name, got, want)
+	}
+}
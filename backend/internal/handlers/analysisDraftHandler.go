@@ -0,0 +1,617 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Analysis draft statuses
+const (
+	DraftStatusOpen      = "draft"
+	DraftStatusCommitted = "committed"
+)
+
+// =============================================================================
+// ANALYSIS DRAFTS - PREVIEW AN EXTRACTED PLAN, EDIT IT, THEN COMMIT IT
+// =============================================================================
+
+// AnalysisDraft is an extracted plan stored for review before it is written to the graph
+type AnalysisDraft struct {
+	ID               string                 `json:"id"`
+	NarrativeID      string                 `json:"narrativeId"`
+	Status           string                 `json:"status"`
+	ExtractionMode   string                 `json:"extractionMode"`
+	PromptVersion    string                 `json:"promptVersion"`
+	ChunkCount       int                    `json:"chunkCount"`
+	ExtractionRunID  string                 `json:"extractionRunId,omitempty"`
+	Actions          []models.LLMAction     `json:"actions"`
+	Grounding        []GroundingConcept     `json:"grounding"`
+	SelfConsistency  *SelfConsistencyReport `json:"selfConsistency,omitempty"`
+	Critique         *CritiqueReport        `json:"critique,omitempty"`
+	ContentHash      string                 `json:"-"` // Narrative content the plan was extracted from
+	CommittedActions []models.LLMAction     `json:"committedActions,omitempty"`
+	Edited           bool                   `json:"edited"`
+	CreatedAt        string                 `json:"createdAt"`
+	CommittedAt      string                 `json:"committedAt,omitempty"`
+}
+
+// extractedPlan returns what commit writes to the graph: the draft's plan, or the given edited actions
+func (d *AnalysisDraft) extractedPlan(actions []models.LLMAction) *ExtractedPlan {
+	return &ExtractedPlan{
+		Plan:            models.LLMResponse{Actions: actions},
+		Grounding:       d.Grounding,
+		PromptVersion:   d.PromptVersion,
+		ChunkCount:      d.ChunkCount,
+		SelfConsistency: d.SelfConsistency,
+		Critique:        d.Critique,
+		ExtractionRunID: d.ExtractionRunID,
+	}
+}
+
+// PlanResolution reports how the names in a plan resolve the way executeLLMPlan resolves them
+type PlanResolution struct {
+	Nodes         []NodeResolution         `json:"nodes"`
+	Relationships []RelationshipResolution `json:"relationships"`
+	Ignored       []int                    `json:"ignored,omitempty"` // Indices of actions that are not graph operations
+	Problems      int                      `json:"problems"`          // Actions that would be skipped on commit
+}
+
+// NodeResolution reports whether a node action creates a new node or links an existing one
+type NodeResolution struct {
+	Index        int    `json:"index"`
+	NodeType     string `json:"nodeType"`
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	Resolution   string `json:"resolution"` // "new", "linked" or "invalid"
+	ExistingID   string `json:"existingId,omitempty"`
+	ExistingName string `json:"existingName,omitempty"`
+	Problem      string `json:"problem,omitempty"`
+}
+
+// RelationshipResolution reports what a relationship action connects
+type RelationshipResolution struct {
+	Index         int    `json:"index"`
+	Type          string `json:"type"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	FromID        string `json:"fromId,omitempty"` // Set when the endpoint is an existing node
+	ToID          string `json:"toId,omitempty"`
+	Resolved      bool   `json:"resolved"`
+	ExistsInGraph bool   `json:"existsInGraph"` // Both endpoints exist and are already connected this way
+	Problem       string `json:"problem,omitempty"`
+}
+
+// PlanDiff summarizes what committing a plan would change in the consolidated graph
+type PlanDiff struct {
+	AddedNodes            []NodeResolution         `json:"addedNodes"`
+	ReusedNodes           []NodeResolution         `json:"reusedNodes"`
+	AddedRelationships    []RelationshipResolution `json:"addedRelationships"`
+	ExistingRelationships []RelationshipResolution `json:"existingRelationships"` // Duplicates consolidation will merge
+	Skipped               int                      `json:"skipped"`
+}
+
+// ConsolidationCandidate is a consolidated node a new node of the plan is likely to be merged into
+type ConsolidationCandidate struct {
+	Index            int     `json:"index"`
+	NodeType         string  `json:"nodeType"`
+	Name             string  `json:"name"`
+	ConsolidatedID   string  `json:"consolidatedId"`
+	ConsolidatedName string  `json:"consolidatedName"`
+	Similarity       float64 `json:"similarity"`
+}
+
+// relationshipEndpoint describes the endpoints of a relationship action. CAUSAL_LINK endpoints take their
+// type from the fromType/toType parameters.
+type relationshipEndpoint struct {
+	Type                string
+	FromParam, FromType string
+	ToParam, ToType     string
+}
+
+var relationshipEndpoints = map[string]relationshipEndpoint{
+	"CreateDescribesRelationship":        {"DESCRIBES", "narrativeName", "narrative", "systemName", "system"},
+	"CreateConstitutesRelationship":      {"CONSTITUTES", "subsystemName", "system", "systemName", "system"},
+	"CreateDescribesStaticRelationship":  {"DESCRIBES_STATIC", "stockName", "stock", "systemName", "system"},
+	"CreateDescribesDynamicRelationship": {"DESCRIBES_DYNAMIC", "flowName", "flow", "systemName", "system"},
+	"CreateChangesRelationship":          {"CHANGES", "flowName", "flow", "stockName", "stock"},
+	"CreateCausalLinkRelationship":       {"CAUSAL_LINK", "fromName", "fromType", "toName", "toType"},
+}
+
+// resolvePlanNames resolves every action of a plan as executeLLMPlan would: node names are matched exactly,
+// linked nodes answer to both the name used in the plan and their own, and the narrative is known by its title
+func resolvePlanNames(plan models.LLMResponse, narrativeTitle string, groundingIndex map[string]GroundingConcept) PlanResolution {
+	resolution := PlanResolution{Nodes: []NodeResolution{}, Relationships: []RelationshipResolution{}}
+	known := map[string]map[string]string{"system": {}, "stock": {}, "flow": {}} // type -> name -> existing id, "" for new nodes
+
+	for i, action := range plan.Actions {
+		required, isNode := nodeRequiredParams[action.FunctionName]
+		if !isNode {
+			continue
+		}
+		name, _ := action.Parameters["name"].(string)
+		node := NodeResolution{Index: i, NodeType: actionNodeType(action), Name: name, Resolution: "new", Description: actionDescription(action)}
+		if missing := missingStringParams(action.Parameters, required); missing != "" {
+			node.Resolution, node.Problem = "invalid", "missing parameter "+missing
+		} else if action.FunctionName == "LinkExistingNode" {
+			id, _ := action.Parameters["id"].(string)
+			concept, ok := groundingIndex[id]
+			if !ok || concept.NodeType != node.NodeType {
+				node.Resolution, node.Problem = "invalid", fmt.Sprintf("unknown %s id %q", node.NodeType, id)
+			} else {
+				node.Resolution, node.ExistingID, node.ExistingName, node.Description = "linked", concept.ID, concept.Name, concept.Description
+				known[concept.NodeType][concept.Name] = concept.ID
+			}
+		}
+		if node.Problem == "" {
+			known[node.NodeType][name] = node.ExistingID
+		} else {
+			resolution.Problems++
+		}
+		resolution.Nodes = append(resolution.Nodes, node)
+	}
+
+	for i, action := range plan.Actions {
+		if _, isNode := nodeRequiredParams[action.FunctionName]; isNode {
+			continue
+		}
+		endpoints, isRelationship := relationshipEndpoints[action.FunctionName]
+		if !isRelationship {
+			resolution.Ignored = append(resolution.Ignored, i)
+			resolution.Problems++
+			continue
+		}
+
+		params := action.Parameters
+		relationship := RelationshipResolution{Index: i, Type: endpoints.Type, Resolved: true}
+		relationship.From, _ = params[endpoints.FromParam].(string)
+		relationship.To, _ = params[endpoints.ToParam].(string)
+		resolveEndpoint := func(param, typeSource, name string) string {
+			nodeType := typeSource
+			if action.FunctionName == "CreateCausalLinkRelationship" {
+				nodeType, _ = params[typeSource].(string)
+				nodeType = strings.ToLower(nodeType)
+			}
+			if nodeType == "narrative" {
+				if name != narrativeTitle {
+					relationship.Resolved, relationship.Problem = false, fmt.Sprintf("%s must be the narrative title %q", param, narrativeTitle)
+				}
+				return ""
+			}
+			id, ok := known[nodeType][name]
+			if !ok {
+				relationship.Resolved, relationship.Problem = false, fmt.Sprintf("%s refers to unknown %s %q", param, nodeType, name)
+			}
+			return id
+		}
+		relationship.FromID = resolveEndpoint(endpoints.FromParam, endpoints.FromType, relationship.From)
+		if relationship.Resolved {
+			relationship.ToID = resolveEndpoint(endpoints.ToParam, endpoints.ToType, relationship.To)
+		}
+		if relationship.Resolved {
+			switch action.FunctionName {
+			case "CreateChangesRelationship":
+				if _, ok := params["polarity"].(float64); !ok {
+					relationship.Resolved, relationship.Problem = false, "polarity must be a number"
+				}
+			case "CreateCausalLinkRelationship":
+				if _, ok := params["curiosity"].(string); !ok {
+					relationship.Resolved, relationship.Problem = false, "missing parameter curiosity"
+				} else if _, ok := params["curiosityScore"].(float64); !ok {
+					relationship.Resolved, relationship.Problem = false, "curiosityScore must be a number"
+				}
+			}
+		}
+		if !relationship.Resolved {
+			resolution.Problems++
+		}
+		resolution.Relationships = append(resolution.Relationships, relationship)
+	}
+	return resolution
+}
+
+// diffPlan compares a resolved plan with the graph, marking relationships between existing nodes that are
+// already connected the same way
+func (h *Handler) diffPlan(ctx context.Context, resolution *PlanResolution) (PlanDiff, error) {
+	diff := PlanDiff{
+		AddedNodes:            []NodeResolution{},
+		ReusedNodes:           []NodeResolution{},
+		AddedRelationships:    []RelationshipResolution{},
+		ExistingRelationships: []RelationshipResolution{},
+		Skipped:               resolution.Problems,
+	}
+	reused := make(map[string]bool)
+	for _, node := range resolution.Nodes {
+		switch node.Resolution {
+		case "new":
+			diff.AddedNodes = append(diff.AddedNodes, node)
+		case "linked":
+			if !reused[node.ExistingID] {
+				reused[node.ExistingID] = true
+				diff.ReusedNodes = append(diff.ReusedNodes, node)
+			}
+		}
+	}
+
+	var pairs []map[string]interface{}
+	for i, relationship := range resolution.Relationships {
+		if relationship.Resolved && relationship.FromID != "" && relationship.ToID != "" {
+			pairs = append(pairs, map[string]interface{}{"position": i, "from": relationship.FromID, "to": relationship.ToID, "type": relationship.Type})
+		}
+	}
+	if len(pairs) > 0 {
+		query := `UNWIND $pairs as pair
+			MATCH (a {id: pair.from})-[r]->(b {id: pair.to})
+			WHERE type(r) = pair.type
+			RETURN DISTINCT pair.position as position`
+		records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"pairs": pairs})
+		if err != nil {
+			return diff, fmt.Errorf("failed to compare plan with the graph: %v", err)
+		}
+		for _, record := range records {
+			resolution.Relationships[getInt64Value(record, "position")].ExistsInGraph = true
+		}
+	}
+
+	for _, relationship := range resolution.Relationships {
+		if !relationship.Resolved {
+			continue
+		}
+		if relationship.ExistsInGraph {
+			diff.ExistingRelationships = append(diff.ExistingRelationships, relationship)
+		} else {
+			diff.AddedRelationships = append(diff.AddedRelationships, relationship)
+		}
+	}
+	return diff, nil
+}
+
+// findConsolidationCandidates embeds the new nodes of a plan and returns, for each, the most similar
+// consolidated node of its type when consolidation would merge them
+func (h *Handler) findConsolidationCandidates(ctx context.Context, narrativeID string, resolution PlanResolution) ([]ConsolidationCandidate, error) {
+	candidates := []ConsolidationCandidate{}
+	var newNodes []NodeResolution
+	var texts []string
+	for _, node := range resolution.Nodes {
+		if node.Resolution != "new" {
+			continue
+		}
+		text := node.Name
+		if node.Description != "" {
+			text += ": " + node.Description
+		}
+		newNodes = append(newNodes, node)
+		texts = append(texts, text)
+	}
+	if len(newNodes) == 0 {
+		return candidates, nil
+	}
+
+	_, consolidated, err := h.fetchNodesForConsolidation(ctx)
+	if err != nil {
+		return candidates, fmt.Errorf("failed to fetch consolidated nodes: %v", err)
+	}
+	if len(consolidated) == 0 {
+		return candidates, nil
+	}
+
+	embeddings, _, err := h.generateEmbeddingsInBatch(ctx, llm.EmbedRequest{Purpose: "draft_preview", Texts: texts, Trace: llm.Trace{NarrativeID: narrativeID}})
+	if err != nil {
+		return candidates, fmt.Errorf("failed to embed new nodes: %v", err)
+	}
+
+	for i, node := range newNodes {
+		if embeddings[i] == nil {
+			continue
+		}
+		var best *ConsolidationCandidate
+		for _, existing := range consolidated[node.NodeType] {
+			existingMap := existing.(map[string]interface{})
+			score, err := cosineSimilarity(embeddings[i], h.convertEmbedding(existingMap["embedding"]))
+			if err != nil || score < consolidationSimilarity || (best != nil && score <= best.Similarity) {
+				continue
+			}
+			name, _ := existingMap["name"].(string)
+			best = &ConsolidationCandidate{
+				Index:            node.Index,
+				NodeType:         node.NodeType,
+				Name:             node.Name,
+				ConsolidatedID:   existingMap["id"].(string),
+				ConsolidatedName: name,
+				Similarity:       score,
+			}
+		}
+		if best != nil {
+			candidates = append(candidates, *best)
+		}
+	}
+	return candidates, nil
+}
+
+// describeDraftPlan resolves the names of a plan, diffs it against the graph and looks for likely
+// consolidation matches. Diff and match failures are reported in the response rather than failing it.
+func (h *Handler) describeDraftPlan(ctx context.Context, narrative *models.Narrative, draft *AnalysisDraft, actions []models.LLMAction) gin.H {
+	resolution := resolvePlanNames(models.LLMResponse{Actions: actions}, narrative.Title, indexGroundingConcepts(draft.Grounding))
+	response := gin.H{}
+
+	diff, err := h.diffPlan(ctx, &resolution)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		response["diff_error"] = err.Error()
+	}
+	response["resolution"] = resolution
+	response["diff"] = diff
+
+	candidates, err := h.findConsolidationCandidates(ctx, narrative.ID, resolution)
+	if err != nil {
+		log.Printf("Warning: Failed to find consolidation matches for draft %s: %v", draft.ID, err)
+		response["consolidation_matches_error"] = err.Error()
+	}
+	response["consolidation_matches"] = candidates
+	return response
+}
+
+// saveAnalysisDraft stores a new draft linked to its narrative
+func (h *Handler) saveAnalysisDraft(ctx context.Context, draft *AnalysisDraft) error {
+	actionsJSON, _ := json.Marshal(draft.Actions)
+	groundingJSON, _ := json.Marshal(draft.Grounding)
+	selfConsistencyJSON, _ := json.Marshal(draft.SelfConsistency)
+	critiqueJSON, _ := json.Marshal(draft.Critique)
+
+	query := `MATCH (n:Narrative {id: $narrative_id})
+		CREATE (n)-[:HAS_ANALYSIS_DRAFT]->(d:AnalysisDraft {
+			id: $id, narrative_id: $narrative_id, status: $status, extraction_mode: $extraction_mode,
+			prompt_version: $prompt_version, chunk_count: $chunk_count, extraction_run_id: $extraction_run_id,
+			actions: $actions, grounding: $grounding, self_consistency: $self_consistency, critique: $critique,
+			content_hash: $content_hash, edited: false, created_at: $created_at
+		})
+		RETURN d.id as id`
+	params := map[string]interface{}{
+		"id":                draft.ID,
+		"narrative_id":      draft.NarrativeID,
+		"status":            draft.Status,
+		"extraction_mode":   draft.ExtractionMode,
+		"prompt_version":    draft.PromptVersion,
+		"chunk_count":       draft.ChunkCount,
+		"extraction_run_id": nilIfEmpty(draft.ExtractionRunID),
+		"actions":           string(actionsJSON),
+		"grounding":         string(groundingJSON),
+		"self_consistency":  string(selfConsistencyJSON),
+		"critique":          string(critiqueJSON),
+		"content_hash":      draft.ContentHash,
+		"created_at":        draft.CreatedAt,
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return fmt.Errorf("failed to save analysis draft: %v", err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("failed to save analysis draft: narrative %s not found", draft.NarrativeID)
+	}
+	return nil
+}
+
+// getAnalysisDraft reads a draft of a narrative. It returns nil when there is no such draft.
+func (h *Handler) getAnalysisDraft(ctx context.Context, narrativeID, id string) (*AnalysisDraft, error) {
+	query := `MATCH (d:AnalysisDraft {id: $id, narrative_id: $narrative_id})
+		RETURN d.id as id, d.narrative_id as narrative_id, d.status as status, d.extraction_mode as extraction_mode,
+		       d.prompt_version as prompt_version, d.chunk_count as chunk_count, d.extraction_run_id as extraction_run_id,
+		       d.actions as actions, d.grounding as grounding, d.self_consistency as self_consistency, d.critique as critique,
+		       d.content_hash as content_hash, d.committed_actions as committed_actions, d.edited as edited,
+		       d.created_at as created_at, d.committed_at as committed_at`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id, "narrative_id": narrativeID})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	record := records[0]
+	edited, _ := record["edited"].(bool)
+	draft := &AnalysisDraft{
+		ID:              getStringValue(record, "id"),
+		NarrativeID:     getStringValue(record, "narrative_id"),
+		Status:          getStringValue(record, "status"),
+		ExtractionMode:  getStringValue(record, "extraction_mode"),
+		PromptVersion:   getStringValue(record, "prompt_version"),
+		ChunkCount:      int(getInt64Value(record, "chunk_count")),
+		ExtractionRunID: getStringValue(record, "extraction_run_id"),
+		ContentHash:     getStringValue(record, "content_hash"),
+		Edited:          edited,
+		CreatedAt:       getStringValue(record, "created_at"),
+		CommittedAt:     getStringValue(record, "committed_at"),
+	}
+	json.Unmarshal([]byte(getStringValue(record, "actions")), &draft.Actions)
+	json.Unmarshal([]byte(getStringValue(record, "grounding")), &draft.Grounding)
+	json.Unmarshal([]byte(getStringValue(record, "self_consistency")), &draft.SelfConsistency)
+	json.Unmarshal([]byte(getStringValue(record, "critique")), &draft.Critique)
+	if committed := getStringValue(record, "committed_actions"); committed != "" {
+		json.Unmarshal([]byte(committed), &draft.CommittedActions)
+	}
+	return draft, nil
+}
+
+// claimAnalysisDraft marks an open draft as committed with the actions being written. It returns false when
+// the draft was committed in the meantime, so concurrent commits cannot both write the plan.
+func (h *Handler) claimAnalysisDraft(ctx context.Context, draft *AnalysisDraft, actions []models.LLMAction, edited bool) (bool, error) {
+	actionsJSON, _ := json.Marshal(actions)
+	query := `MATCH (d:AnalysisDraft {id: $id})
+		WHERE d.status = $open
+		SET d.status = $committed, d.committed_actions = $actions, d.edited = $edited, d.committed_at = $committed_at
+		RETURN d.id as id`
+	params := map[string]interface{}{
+		"id":           draft.ID,
+		"open":         DraftStatusOpen,
+		"committed":    DraftStatusCommitted,
+		"actions":      string(actionsJSON),
+		"edited":       edited,
+		"committed_at": time.Now().Format(time.RFC3339),
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return false, fmt.Errorf("failed to commit analysis draft: %v", err)
+	}
+	return len(records) > 0, nil
+}
+
+// PreviewNarrativeAnalysis - Extracts a plan from a narrative without writing it to the graph and stores it
+// as a draft. The response shows how the plan's names resolve, what it would add to the consolidated graph and
+// which new nodes consolidation is likely to merge into existing ones.
+func (h *Handler) PreviewNarrativeAnalysis(c *gin.Context) {
+	var req models.AnalysisPreviewRequest
+	// An empty body is allowed and previews with the default options
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+	options, err := newAnalysisOptions(req.ExtractionMode, req.SelfConsistency, req.Critic)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	narrative, err := h.getNarrativeByIDFromDB(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
+	}
+
+	extracted, err := h.prepareAnalysisPlan(ctx, narrative, options)
+	if err != nil {
+		respondWithAnalysisError(c, err)
+		return
+	}
+
+	draft := &AnalysisDraft{
+		ID:              uuid.New().String(),
+		NarrativeID:     narrative.ID,
+		Status:          DraftStatusOpen,
+		ExtractionMode:  options.ExtractionMode,
+		PromptVersion:   extracted.PromptVersion,
+		ChunkCount:      extracted.ChunkCount,
+		ExtractionRunID: extracted.ExtractionRunID,
+		Actions:         extracted.Plan.Actions,
+		Grounding:       extracted.Grounding,
+		SelfConsistency: extracted.SelfConsistency,
+		Critique:        extracted.Critique,
+		ContentHash:     contentHash(narrative.Content),
+		CreatedAt:       time.Now().Format(time.RFC3339),
+	}
+	if draft.Actions == nil {
+		draft.Actions = []models.LLMAction{}
+	}
+	if err := h.saveAnalysisDraft(ctx, draft); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := h.describeDraftPlan(ctx, narrative, draft, draft.Actions)
+	response["message"] = "Analysis draft created; commit it to write the plan to the graph"
+	response["draft"] = draft
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetAnalysisDraft - Reads a stored draft with its name resolution, diff and likely consolidation matches
+func (h *Handler) GetAnalysisDraft(c *gin.Context) {
+	ctx := c.Request.Context()
+	narrative, err := h.getNarrativeByIDFromDB(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
+	}
+	draft, err := h.getAnalysisDraft(ctx, narrative.ID, c.Param("draftId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if draft == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis draft not found"})
+		return
+	}
+
+	actions := draft.Actions
+	if draft.Status == DraftStatusCommitted {
+		actions = draft.CommittedActions
+	}
+	response := h.describeDraftPlan(ctx, narrative, draft, actions)
+	response["draft"] = draft
+	c.JSON(http.StatusOK, response)
+}
+
+// CommitNarrativeAnalysis - Writes a previewed draft to the graph, optionally with an edited list of actions.
+// Actions that would be skipped (unknown names, missing parameters) reject the commit unless skipInvalid is set.
+func (h *Handler) CommitNarrativeAnalysis(c *gin.Context) {
+	var req models.CommitAnalysisRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	narrative, err := h.getNarrativeByIDFromDB(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
+	}
+	draft, err := h.getAnalysisDraft(ctx, narrative.ID, req.DraftID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if draft == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis draft not found"})
+		return
+	}
+	if draft.Status != DraftStatusOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Analysis draft has already been committed"})
+		return
+	}
+	if draft.ContentHash != contentHash(narrative.Content) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Narrative has changed since the draft was previewed; preview it again"})
+		return
+	}
+
+	actions, edited := draft.Actions, req.Actions != nil
+	if edited {
+		actions = req.Actions
+	}
+	resolution := resolvePlanNames(models.LLMResponse{Actions: actions}, narrative.Title, indexGroundingConcepts(draft.Grounding))
+	if resolution.Problems > 0 && !req.SkipInvalid {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      fmt.Sprintf("%d actions cannot be resolved; fix them or set skipInvalid to skip them", resolution.Problems),
+			"resolution": resolution,
+		})
+		return
+	}
+
+	claimed, err := h.claimAnalysisDraft(ctx, draft, actions, edited)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Analysis draft has already been committed"})
+		return
+	}
+
+	result := h.applyAnalysisPlan(ctx, narrative, draft.extractedPlan(actions))
+	response := analysisResponse("Analysis draft committed", result)
+	response["narrativeId"] = narrative.ID
+	response["draftId"] = draft.ID
+	response["edited"] = edited
+	response["skipped"] = resolution.Problems
+	c.JSON(http.StatusOK, response)
+}
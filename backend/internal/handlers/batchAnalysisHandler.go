@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBatchConcurrency       = 2
+	maxBatchConcurrency           = 8
+	defaultBatchRequestsPerMinute = 10
+)
+
+// NarrativeAnalysisOutcome reports the result of analyzing one narrative in a batch
+type NarrativeAnalysisOutcome struct {
+	NarrativeID          string `json:"narrativeId"`
+	Title                string `json:"title"`
+	Status               string `json:"status"` // "succeeded" or "failed"
+	Error                string `json:"error,omitempty"`
+	ChunksAnalyzed       int    `json:"chunks_analyzed"`
+	SystemsCreated       int    `json:"systems_created"`
+	StocksCreated        int    `json:"stocks_created"`
+	FlowsCreated         int    `json:"flows_created"`
+	NodesLinked          int    `json:"nodes_linked"`
+	RelationshipsCreated int    `json:"relationships_created"`
+	DurationMs           int64  `json:"duration_ms"`
+
+	SelfConsistency *SelfConsistencyReport `json:"self_consistency,omitempty"`
+	Critique        *CritiqueReport        `json:"critique,omitempty"`
+}
+
+// AnalyzePendingNarratives - Analyzes every narrative that has not been extrapolated yet
+// With consolidate set, only approved staging items are consolidated; the response counts those still awaiting approval.
+func (h *Handler) AnalyzePendingNarratives(c *gin.Context) {
+	var req models.AnalyzePendingRequest
+	// An empty body is allowed and runs the batch with defaults
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+
+	options, err := newAnalysisOptions(req.ExtractionMode, req.SelfConsistency, req.Critic)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	narratives, err := h.fetchPendingNarratives(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending narratives: " + err.Error()})
+		return
+	}
+
+	outcomes := h.analyzeNarrativesInBatch(ctx, narratives, req.Concurrency, req.RequestsPerMinute, options)
+
+	succeeded := 0
+	for _, outcome := range outcomes {
+		if outcome.Status == "succeeded" {
+			succeeded++
+		}
+	}
+
+	response := gin.H{
+		"message":   "Batch analysis completed",
+		"pending":   len(narratives),
+		"succeeded": succeeded,
+		"failed":    len(narratives) - succeeded,
+		"outcomes":  outcomes,
+	}
+
+	// Optionally chain the rest of the pipeline; consolidation needs embeddings, so it implies them
+	if succeeded > 0 && (req.ProcessEmbeddings || req.Consolidate) {
+		embeddingReport, err := h.processNodeEmbeddingsInBatch(ctx)
+		if err != nil {
+			log.Printf("Error processing embeddings after batch analysis: %v", err)
+			response["embeddings"] = gin.H{"status": "failed", "error": err.Error()}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		response["embeddings"] = gin.H{"status": "succeeded", "embedded": embeddingReport.Embedded, "failures": embeddingReport.Failures}
+
+		if req.Consolidate {
+			consolidationsPerformed, synthesisFailures, err := h.runConsolidation(ctx)
+			if err != nil {
+				response["consolidation"] = gin.H{"status": "failed", "error": err.Error()}
+			} else {
+				consolidation := gin.H{
+					"status":                   "succeeded",
+					"consolidations_performed": consolidationsPerformed,
+					"synthesis_failures":       synthesisFailures,
+				}
+				h.reportAwaitingApproval(ctx, consolidation)
+				response["consolidation"] = consolidation
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// fetchPendingNarratives returns all narratives that have not been analyzed yet, oldest first
+func (h *Handler) fetchPendingNarratives(ctx context.Context) ([]*models.Narrative, error) {
+	query := `MATCH (n:Narrative)
+		WHERE n.extrapolated = false OR n.extrapolated IS NULL
+		RETURN n.id
+		ORDER BY n.created_at`
+	records, err := h.db.ExecuteRead(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var narratives []*models.Narrative
+	for _, record := range records {
+		narrative, err := h.getNarrativeByIDFromDB(ctx, getStringValue(record, "n.id"))
+		if err != nil {
+			log.Printf("Warning: Skipping pending narrative %v: %v", record["n.id"], err)
+			continue
+		}
+		narratives = append(narratives, narrative)
+	}
+	return narratives, nil
+}
+
+// analyzeNarrativesInBatch runs runNarrativeAnalysis over the narratives with at most concurrency analyses
+// in flight. Every generation call the analyses make (per chunk, sample, critique, repair and stage) is
+// paced to at most requestsPerMinute across the whole batch. Outcomes are returned in input order.
+func (h *Handler) analyzeNarrativesInBatch(ctx context.Context, narratives []*models.Narrative, concurrency, requestsPerMinute int, options AnalysisOptions) []NarrativeAnalysisOutcome {
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	if concurrency > maxBatchConcurrency {
+		concurrency = maxBatchConcurrency
+	}
+	if requestsPerMinute <= 0 {
+		requestsPerMinute = defaultBatchRequestsPerMinute
+	}
+
+	outcomes := make([]NarrativeAnalysisOutcome, len(narratives))
+	if len(narratives) == 0 {
+		return outcomes
+	}
+
+	// The batch shares one throttle on top of the server-wide one. It only paces: the provider underneath
+	// already retries temporary failures.
+	batch := *h
+	batch.llm = llm.WithRetry(h.llm, llm.NewThrottle(float64(requestsPerMinute), 1, 0, 1, 0, 0))
+
+	log.Printf("Batch analysis: %d pending narratives, concurrency %d, %d LLM requests/minute", len(narratives), concurrency, requestsPerMinute)
+
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, narrative := range narratives {
+		outcomes[i] = NarrativeAnalysisOutcome{NarrativeID: narrative.ID, Title: narrative.Title}
+
+		if ctx.Err() != nil {
+			outcomes[i].Status = "failed"
+			outcomes[i].Error = "batch cancelled: " + ctx.Err().Error()
+			continue
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			outcomes[i].Status = "failed"
+			outcomes[i].Error = "batch cancelled: " + ctx.Err().Error()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, narrative *models.Narrative) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			started := time.Now()
+			result, err := batch.runNarrativeAnalysis(ctx, narrative, options)
+			outcomes[i].DurationMs = time.Since(started).Milliseconds()
+			if err != nil {
+				log.Printf("Batch analysis failed for narrative %s: %v", narrative.ID, err)
+				outcomes[i].Status = "failed"
+				outcomes[i].Error = err.Error()
+				return
+			}
+
+			outcomes[i].Status = "succeeded"
+			outcomes[i].ChunksAnalyzed = result.ChunksAnalyzed
+			outcomes[i].SystemsCreated = result.SystemsCreated
+			outcomes[i].StocksCreated = result.StocksCreated
+			outcomes[i].FlowsCreated = result.FlowsCreated
+			outcomes[i].NodesLinked = result.NodesLinked
+			outcomes[i].RelationshipsCreated = result.RelationshipsCreated
+			outcomes[i].SelfConsistency = result.SelfConsistency
+			outcomes[i].Critique = result.Critique
+		}(i, narrative)
+	}
+	wg.Wait()
+
+	return outcomes
+}
@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+const (
+	analysisChunkMaxChars     = 6000 // Upper bound on the narrative text sent in one extraction prompt
+	analysisChunkOverlapChars = 800  // Trailing context repeated at the start of the next chunk
+	planMergeSimilarity       = 0.85 // Name embeddings above this are treated as the same element across chunks or samples
+)
+
+// NarrativeChunk is one section of a narrative analyzed in its own extraction call
+type NarrativeChunk struct {
+	Index   int    // Zero-based position of the chunk in the narrative
+	Total   int    // Number of chunks the narrative was split into
+	Content string // Chunk text, including any overlap with the previous chunk
+}
+
+var paragraphSeparator = regexp.MustCompile(`\n\s*\n`)
+var sentenceEnd = regexp.MustCompile(`[.!?]["')\]]*\s+`)
+
+// chunkNarrative splits content into paragraph-aligned chunks of at most maxChars, preferring to break
+// at Markdown headings, and repeats up to overlapChars of trailing paragraphs at the start of the next chunk.
+func chunkNarrative(content string, maxChars, overlapChars int) []NarrativeChunk {
+	content = strings.TrimSpace(content)
+	if len(content) <= maxChars {
+		return []NarrativeChunk{{Index: 0, Total: 1, Content: content}}
+	}
+
+	// Split into paragraphs, breaking oversized paragraphs at sentence boundaries
+	var paragraphs []string
+	for _, paragraph := range paragraphSeparator.Split(content, -1) {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		paragraphs = append(paragraphs, splitOversizedParagraph(paragraph, maxChars)...)
+	}
+
+	var chunks []string
+	var current []string
+	currentLen := 0
+	for _, paragraph := range paragraphs {
+		isHeading := strings.HasPrefix(paragraph, "#")
+		startsNewSection := isHeading && currentLen >= maxChars/2
+		if len(current) > 0 && (currentLen+len(paragraph)+2 > maxChars || startsNewSection) {
+			chunks = append(chunks, strings.Join(current, "\n\n"))
+			current = overlapTail(current, overlapChars)
+			currentLen = joinedLength(current)
+			// Drop the overlap if it would not leave room for the next paragraph
+			if currentLen+len(paragraph)+2 > maxChars {
+				current, currentLen = nil, 0
+			}
+		}
+		current = append(current, paragraph)
+		currentLen = joinedLength(current)
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, "\n\n"))
+	}
+
+	result := make([]NarrativeChunk, len(chunks))
+	for i, chunk := range chunks {
+		result[i] = NarrativeChunk{Index: i, Total: len(chunks), Content: chunk}
+	}
+	return result
+}
+
+// splitOversizedParagraph breaks a paragraph longer than maxChars at sentence boundaries, splitting any
+// single sentence that is still too long between words.
+func splitOversizedParagraph(paragraph string, maxChars int) []string {
+	if len(paragraph) <= maxChars {
+		return []string{paragraph}
+	}
+
+	var sentences []string
+	last := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(paragraph, -1) {
+		sentences = append(sentences, paragraph[last:loc[1]])
+		last = loc[1]
+	}
+	if last < len(paragraph) {
+		sentences = append(sentences, paragraph[last:])
+	}
+
+	var pieces []string
+	var current strings.Builder
+	for _, sentence := range sentences {
+		for len(sentence) > maxChars {
+			cut := hardSplitPoint(sentence, maxChars)
+			pieces = append(pieces, strings.TrimSpace(sentence[:cut]))
+			sentence = sentence[cut:]
+		}
+		if current.Len()+len(sentence) > maxChars {
+			pieces = append(pieces, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+		current.WriteString(sentence)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, strings.TrimSpace(current.String()))
+	}
+	return pieces
+}
+
+// hardSplitPoint returns where to cut text so the first part is at most maxChars: after the last space
+// that fits, or failing that at the last rune boundary, so a cut never splits a multi-byte character
+func hardSplitPoint(text string, maxChars int) int {
+	if cut := strings.LastIndexAny(text[:maxChars+1], " \t\n"); cut > 0 {
+		return cut
+	}
+	cut := maxChars
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		// maxChars is shorter than the first rune; take the rune whole rather than loop forever
+		_, size := utf8.DecodeRuneInString(text)
+		return size
+	}
+	return cut
+}
+
+// overlapTail returns the trailing paragraphs whose combined length fits within overlapChars
+func overlapTail(paragraphs []string, overlapChars int) []string {
+	total := 0
+	start := len(paragraphs)
+	for i := len(paragraphs) - 1; i >= 0; i-- {
+		if total+len(paragraphs[i]) > overlapChars {
+			break
+		}
+		total += len(paragraphs[i]) + 2
+		start = i
+	}
+	return append([]string(nil), paragraphs[start:]...)
+}
+
+func joinedLength(paragraphs []string) int {
+	if len(paragraphs) == 0 {
+		return 0
+	}
+	total := 2 * (len(paragraphs) - 1)
+	for _, paragraph := range paragraphs {
+		total += len(paragraph)
+	}
+	return total
+}
+
+// nodeActionTypes maps node-creating actions to the node type they create
+var nodeActionTypes = map[string]string{
+	"CreateSystemNode": "system",
+	"CreateStockNode":  "stock",
+	"CreateFlowNode":   "flow",
+	"LinkExistingNode": "", // Resolved from the action's "type" parameter
+}
+
+// relationshipNameParams lists, per relationship action, the parameters holding element names and their node type.
+// CAUSAL_LINK endpoints take their type from the fromType/toType parameters.
+var relationshipNameParams = map[string]map[string]string{
+	"CreateConstitutesRelationship":      {"subsystemName": "system", "systemName": "system"},
+	"CreateDescribesRelationship":        {"systemName": "system"},
+	"CreateDescribesStaticRelationship":  {"stockName": "stock", "systemName": "system"},
+	"CreateDescribesDynamicRelationship": {"flowName": "flow", "systemName": "system"},
+	"CreateChangesRelationship":          {"flowName": "flow", "stockName": "stock"},
+	"CreateCausalLinkRelationship":       {"fromName": "fromType", "toName": "toType"},
+}
+
+// normalizeElementName reduces a name to a comparison key so trivially different spellings unify
+func normalizeElementName(name string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+		} else if sb.Len() > 0 && !strings.HasSuffix(sb.String(), " ") {
+			sb.WriteRune(' ')
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// actionNodeType returns the node type created or linked by a node action
+func actionNodeType(action models.LLMAction) string {
+	if action.FunctionName == "LinkExistingNode" {
+		nodeType, _ := action.Parameters["type"].(string)
+		return strings.ToLower(nodeType)
+	}
+	return nodeActionTypes[action.FunctionName]
+}
+
+// mergeChunkPlans combines per-chunk plans into a single plan for the narrative. Every surviving action
+// records the chunks it was extracted from.
+func (h *Handler) mergeChunkPlans(ctx context.Context, narrativeID string, plans []models.LLMResponse) models.LLMResponse {
+	for i := range plans {
+		for j := range plans[i].Actions {
+			plans[i].Actions[j].SourceChunks = []int{i}
+		}
+	}
+	if len(plans) == 1 {
+		return plans[0]
+	}
+	merged, _ := h.alignPlans(ctx, narrativeID, "chunk_merge", plans)
+	return merged
+}
+
+// alignPlans unifies several plans into one. Node actions that share a normalized name, or whose names embed
+// within planMergeSimilarity of each other, are unified under the first name seen; relationship actions are
+// rewritten to the unified names and de-duplicated, and source chunks are combined. Alongside the merged plan
+// it returns, for each merged action, the indices of the plans it was found in.
+func (h *Handler) alignPlans(ctx context.Context, narrativeID, purpose string, plans []models.LLMResponse) (models.LLMResponse, [][]int) {
+	// Collect node actions in order, keyed by type and normalized name
+	type nodeEntry struct {
+		action  models.LLMAction
+		name    string
+		aliases []string
+		origins []int
+	}
+	nodesByKey := make(map[string]*nodeEntry)
+	var nodeOrder []string
+	for planIndex, plan := range plans {
+		for _, action := range plan.Actions {
+			if _, isNode := nodeActionTypes[action.FunctionName]; !isNode {
+				continue
+			}
+			name, _ := action.Parameters["name"].(string)
+			key := actionNodeType(action) + "|" + normalizeElementName(name)
+			if entry, exists := nodesByKey[key]; exists {
+				entry.action.SourceChunks = unionChunks(entry.action.SourceChunks, action.SourceChunks)
+				entry.aliases = append(entry.aliases, name)
+				entry.origins = unionChunks(entry.origins, []int{planIndex})
+				continue
+			}
+			nodesByKey[key] = &nodeEntry{action: action, name: name, origins: []int{planIndex}}
+			nodeOrder = append(nodeOrder, key)
+		}
+	}
+
+	// Unify near-duplicates of the same type by name embedding
+	canonical := make(map[string]string) // node key -> surviving node key
+	for _, key := range nodeOrder {
+		canonical[key] = key
+	}
+	texts := make([]string, len(nodeOrder))
+	for i, key := range nodeOrder {
+		entry := nodesByKey[key]
+		texts[i] = entry.name
+		if desc := actionDescription(entry.action); desc != "" {
+			texts[i] += ": " + desc
+		}
+	}
+	if embeddings, _, err := h.generateEmbeddingsInBatch(ctx, llm.EmbedRequest{
+		Purpose: purpose,
+		Texts:   texts,
+		Trace:   llm.Trace{NarrativeID: narrativeID},
+	}); err != nil || len(embeddings) != len(texts) {
+		log.Printf("Warning: Skipping near-duplicate merge for %s: %v", purpose, err)
+	} else {
+		for i, keyA := range nodeOrder {
+			if canonical[keyA] != keyA || embeddings[i] == nil {
+				continue
+			}
+			entryA := nodesByKey[keyA]
+			for j := i + 1; j < len(nodeOrder); j++ {
+				keyB := nodeOrder[j]
+				entryB := nodesByKey[keyB]
+				if canonical[keyB] != keyB || embeddings[j] == nil || actionNodeType(entryA.action) != actionNodeType(entryB.action) {
+					continue
+				}
+				// Never merge two different existing nodes
+				if entryA.action.FunctionName == "LinkExistingNode" && entryB.action.FunctionName == "LinkExistingNode" {
+					continue
+				}
+				score, err := cosineSimilarity(embeddings[i], embeddings[j])
+				if err != nil || score < planMergeSimilarity {
+					continue
+				}
+				log.Printf("Plan merge (%s): '%s' -> '%s' (similarity: %.4f)", purpose, entryB.name, entryA.name, score)
+				canonical[keyB] = keyA
+				entryA.action.SourceChunks = unionChunks(entryA.action.SourceChunks, entryB.action.SourceChunks)
+				entryA.origins = unionChunks(entryA.origins, entryB.origins)
+				entryA.aliases = append(entryA.aliases, append([]string{entryB.name}, entryB.aliases...)...)
+				// Prefer linking to an existing node over creating a near-duplicate of it
+				if entryB.action.FunctionName == "LinkExistingNode" {
+					entryA.action = models.LLMAction{FunctionName: entryB.action.FunctionName, Parameters: withName(entryB.action.Parameters, entryA.name), SourceChunks: entryA.action.SourceChunks}
+				}
+			}
+		}
+	}
+
+	// Map every name variant to the surviving name
+	renames := make(map[string]string) // type|name -> surviving name
+	var merged models.LLMResponse
+	var origins [][]int // Parallel to merged.Actions
+	for _, key := range nodeOrder {
+		entry := nodesByKey[key]
+		survivor := nodesByKey[canonical[key]]
+		nodeType := actionNodeType(entry.action)
+		renames[nodeType+"|"+entry.name] = survivor.name
+		for _, alias := range entry.aliases {
+			renames[nodeType+"|"+alias] = survivor.name
+		}
+		if canonical[key] == key {
+			merged.Actions = append(merged.Actions, entry.action)
+			origins = append(origins, entry.origins)
+		}
+	}
+
+	// Rewrite and de-duplicate relationship actions
+	relationshipIndex := make(map[string]int)
+	for planIndex, plan := range plans {
+		for _, action := range plan.Actions {
+			nameParams, isRelationship := relationshipNameParams[action.FunctionName]
+			if !isRelationship {
+				continue
+			}
+			params := make(map[string]interface{}, len(action.Parameters))
+			for k, v := range action.Parameters {
+				params[k] = v
+			}
+			for param, typeSource := range nameParams {
+				name, ok := params[param].(string)
+				if !ok {
+					continue
+				}
+				nodeType := typeSource
+				if action.FunctionName == "CreateCausalLinkRelationship" {
+					nodeType, _ = params[typeSource].(string)
+					nodeType = strings.ToLower(nodeType)
+				}
+				if renamed, ok := renames[nodeType+"|"+name]; ok {
+					params[param] = renamed
+				}
+			}
+
+			key := relationshipActionKey(action.FunctionName, params)
+			if idx, exists := relationshipIndex[key]; exists {
+				merged.Actions[idx].SourceChunks = unionChunks(merged.Actions[idx].SourceChunks, action.SourceChunks)
+				origins[idx] = unionChunks(origins[idx], []int{planIndex})
+				continue
+			}
+			relationshipIndex[key] = len(merged.Actions)
+			merged.Actions = append(merged.Actions, models.LLMAction{FunctionName: action.FunctionName, Parameters: params, SourceChunks: action.SourceChunks})
+			origins = append(origins, []int{planIndex})
+		}
+	}
+
+	return merged, origins
+}
+
+// relationshipActionKey identifies a relationship action by its type and endpoints
+func relationshipActionKey(functionName string, params map[string]interface{}) string {
+	var parts []string
+	for param := range relationshipNameParams[functionName] {
+		name, _ := params[param].(string)
+		parts = append(parts, param+"="+normalizeElementName(name))
+	}
+	if name, ok := params["narrativeName"].(string); ok {
+		parts = append(parts, "narrativeName="+name)
+	}
+	sort.Strings(parts)
+	return functionName + "|" + strings.Join(parts, "|")
+}
+
+func actionDescription(action models.LLMAction) string {
+	if desc, ok := action.Parameters["description"].(string); ok {
+		return desc
+	}
+	if desc, ok := action.Parameters["boundaryDescription"].(string); ok {
+		return desc
+	}
+	return ""
+}
+
+func withName(params map[string]interface{}, name string) map[string]interface{} {
+	return withParam(params, "name", name)
+}
+
+// withParam returns a copy of params with key set to value
+func withParam(params map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		copied[k] = v
+	}
+	copied[key] = value
+	return copied
+}
+
+func unionChunks(a, b []int) []int {
+	seen := make(map[int]bool)
+	var result []int
+	for _, chunk := range append(append([]int(nil), a...), b...) {
+		if !seen[chunk] {
+			seen[chunk] = true
+			result = append(result, chunk)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+// formatChunkContent prefixes a chunk with its position so the LLM knows it is seeing part of a longer text
+func formatChunkContent(chunk NarrativeChunk) string {
+	if chunk.Total == 1 {
+		return chunk.Content
+	}
+	return fmt.Sprintf("[Section %d of %d. Other sections are analyzed separately; model only what this section describes, reusing the same names for recurring concepts.]\n\n%s",
+		chunk.Index+1, chunk.Total, chunk.Content)
+}
@@ -1,31 +1,70 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
 	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
 	"github.com/gin-gonic/gin"
 )
 
 // ConsolidateGraph - Main consolidation workflow handler
 // Implements the 6-step consolidation process from phase2plan.txt
+// Only staging items approved via /api/v1/staging are consumed; the rest stay unconsolidated for review.
 func (h *Handler) ConsolidateGraph(c *gin.Context) {
-	ctx := c.Request.Context()
+	consolidationsPerformed, synthesisFailures, err := h.runConsolidation(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"message":                  "Graph consolidation completed successfully",
+		"consolidations_performed": consolidationsPerformed,
+		"synthesis_failures":       synthesisFailures,
+	}
+	h.reportAwaitingApproval(c.Request.Context(), response)
+	c.JSON(http.StatusOK, response)
+}
 
+// reportAwaitingApproval adds to a consolidation response how many staged nodes were skipped because they
+// are not approved yet, so an unreviewed staging area does not read as nothing to consolidate
+func (h *Handler) reportAwaitingApproval(ctx context.Context, response gin.H) {
+	awaiting, err := h.countNodesAwaitingApproval(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to count nodes awaiting approval: %v", err)
+		return
+	}
+	response["awaiting_approval"] = awaiting
+	if awaiting > 0 {
+		response["staging"] = fmt.Sprintf("%d nodes awaiting approval in the staging area were not consolidated", awaiting)
+	}
+}
+
+// SynthesisFailure is a node match that was merged keeping the consolidated node's name and description
+// because synthesizing new ones failed
+type SynthesisFailure struct {
+	UnconsolidatedID string `json:"unconsolidated_id"`
+	ConsolidatedID   string `json:"consolidated_id"`
+	NodeType         string `json:"node_type"`
+	Error            string `json:"error"`
+}
+
+// runConsolidation executes the consolidation workflow and returns the number of node matches applied
+// and the matches whose name synthesis failed
+func (h *Handler) runConsolidation(ctx context.Context) (int, []SynthesisFailure, error) {
 	log.Println("Starting graph consolidation workflow...")
 
 	// Step 1: Fetch All Nodes
 	unconsolidatedNodes, consolidatedNodes, err := h.fetchNodesForConsolidation(ctx)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch nodes: " + err.Error()})
-		return
+		return 0, nil, fmt.Errorf("Failed to fetch nodes: %v", err)
 	}
 
 	log.Printf("Found %d unconsolidated nodes and %d consolidated nodes", len(unconsolidatedNodes), len(consolidatedNodes))
@@ -33,55 +72,47 @@ func (h *Handler) ConsolidateGraph(c *gin.Context) {
 	// Step 2: Find Node Matches
 	nodeMatches, err := h.findNodeMatches(ctx, unconsolidatedNodes, consolidatedNodes)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find node matches: " + err.Error()})
-		return
+		return 0, nil, fmt.Errorf("Failed to find node matches: %v", err)
 	}
 
 	log.Printf("Found %d node matches for consolidation", len(nodeMatches))
 
 	// Step 3: Synthesize New Names & Descriptions
-	err = h.synthesizeNamesAndDescriptions(ctx, nodeMatches)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to synthesize names: " + err.Error()})
-		return
+	synthesisFailures := h.synthesizeNamesAndDescriptions(ctx, nodeMatches)
+	if len(synthesisFailures) > 0 {
+		log.Printf("Warning: Name synthesis failed for %d of %d node matches", len(synthesisFailures), len(nodeMatches))
 	}
 
 	// Step 4: Consolidate Nodes (Transaction 1)
 	err = h.consolidateNodes(ctx, nodeMatches, unconsolidatedNodes)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to consolidate nodes: " + err.Error()})
-		return
+		return 0, nil, fmt.Errorf("Failed to consolidate nodes: %v", err)
 	}
 
 	// Step 5: Consolidate Relationships (Transaction 2)
 	err = h.consolidateRelationships(ctx, nodeMatches)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to consolidate relationships: " + err.Error()})
-		return
+		return 0, nil, fmt.Errorf("Failed to consolidate relationships: %v", err)
 	}
 
 	// Step 6: Cleanup (Transaction 3)
-	err = h.cleanupUnconsolidatedNodes(ctx)
+	err = h.cleanupUnconsolidatedNodes(ctx, nodeMatches)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cleanup: " + err.Error()})
-		return
+		return 0, nil, fmt.Errorf("Failed to cleanup: %v", err)
 	}
 
 	log.Println("Graph consolidation workflow completed successfully")
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":                  "Graph consolidation completed successfully",
-		"consolidations_performed": len(nodeMatches),
-	})
+	return len(nodeMatches), synthesisFailures, nil
 }
 
-// Step 1: Fetch all nodes separated by consolidation status
+// Step 1: Fetch all nodes separated by consolidation status. Unconsolidated nodes are only fetched once they
+// have been approved in the staging area.
 func (h *Handler) fetchNodesForConsolidation(ctx context.Context) (map[string][]interface{}, map[string][]interface{}, error) {
 	unconsolidated := make(map[string][]interface{})
 	consolidated := make(map[string][]interface{})
 
 	// Fetch Systems
-	systemQuery := `MATCH (s:System) WHERE s.embedded = true RETURN s.id as id, s.name as name, s.boundary_description as boundary_description, s.embedding as embedding, s.consolidated as consolidated, s.consolidation_score as consolidation_score`
+	systemQuery := `MATCH (s:System) WHERE s.embedded = true AND (s.consolidated = true OR s.approved = true) RETURN s.id as id, s.name as name, s.boundary_description as boundary_description, s.embedding as embedding, s.consolidated as consolidated, s.consolidation_score as consolidation_score`
 	systemRecords, err := h.db.ExecuteRead(ctx, systemQuery, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch systems: %v", err)
@@ -104,7 +135,7 @@ func (h *Handler) fetchNodesForConsolidation(ctx context.Context) (map[string][]
 	}
 
 	// Fetch Stocks
-	stockQuery := `MATCH (st:Stock) WHERE st.embedded = true RETURN st.id as id, st.name as name, st.description as description, st.embedding as embedding, st.consolidated as consolidated, st.consolidation_score as consolidation_score`
+	stockQuery := `MATCH (st:Stock) WHERE st.embedded = true AND (st.consolidated = true OR st.approved = true) RETURN st.id as id, st.name as name, st.description as description, st.embedding as embedding, st.consolidated as consolidated, st.consolidation_score as consolidation_score`
 	stockRecords, err := h.db.ExecuteRead(ctx, stockQuery, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch stocks: %v", err)
@@ -127,7 +158,7 @@ func (h *Handler) fetchNodesForConsolidation(ctx context.Context) (map[string][]
 	}
 
 	// Fetch Flows
-	flowQuery := `MATCH (f:Flow) WHERE f.embedded = true RETURN f.id as id, f.name as name, f.description as description, f.embedding as embedding, f.consolidated as consolidated, f.consolidation_score as consolidation_score`
+	flowQuery := `MATCH (f:Flow) WHERE f.embedded = true AND (f.consolidated = true OR f.approved = true) RETURN f.id as id, f.name as name, f.description as description, f.embedding as embedding, f.consolidated as consolidated, f.consolidation_score as consolidation_score`
 	flowRecords, err := h.db.ExecuteRead(ctx, flowQuery, nil)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch flows: %v", err)
@@ -152,10 +183,13 @@ func (h *Handler) fetchNodesForConsolidation(ctx context.Context) (map[string][]
 	return unconsolidated, consolidated, nil
 }
 
+// consolidationSimilarity is the embedding similarity above which a node is merged into a consolidated one.
+// Lowered to 0.60 to capture more similar nodes.
+const consolidationSimilarity = 0.60
+
 // Step 2: Find matches between unconsolidated and consolidated nodes
 func (h *Handler) findNodeMatches(ctx context.Context, unconsolidated, consolidated map[string][]interface{}) ([]models.NodeMatch, error) {
 	var nodeMatches []models.NodeMatch
-	const similarityThreshold = 0.60 // Lowered to 0.60 to capture more similar nodes
 
 	// Process each node type
 	for nodeType := range unconsolidated {
@@ -197,7 +231,7 @@ func (h *Handler) findNodeMatches(ctx context.Context, unconsolidated, consolida
 
 					log.Printf("Similarity between %s and %s: %.4f", node1ID, node2ID, score)
 
-					if score >= similarityThreshold && score > bestScore {
+					if score >= consolidationSimilarity && score > bestScore {
 						bestScore = score
 						bestMatchID = node2ID
 					}
@@ -258,7 +292,7 @@ func (h *Handler) findNodeMatches(ctx context.Context, unconsolidated, consolida
 				}
 
 				// If above threshold, it's a match; otherwise promote to consolidated
-				if bestScore >= similarityThreshold {
+				if bestScore >= consolidationSimilarity {
 					nodeMatches = append(nodeMatches, bestMatch)
 				} else {
 					nodeMatches = append(nodeMatches, models.NodeMatch{
@@ -275,13 +309,20 @@ func (h *Handler) findNodeMatches(ctx context.Context, unconsolidated, consolida
 	return nodeMatches, nil
 }
 
-// Step 3: Synthesize new names and descriptions using Gemini
-func (h *Handler) synthesizeNamesAndDescriptions(ctx context.Context, nodeMatches []models.NodeMatch) error {
-	geminiApiKey := os.Getenv("GEMINI_API_KEY")
-	if geminiApiKey == "" {
-		return fmt.Errorf("GEMINI_API_KEY environment variable not set")
+// Step 3: Synthesize new names and descriptions using the LLM. Matches whose synthesis fails keep the
+// consolidated node's name and description and are returned as failures.
+func (h *Handler) synthesizeNamesAndDescriptions(ctx context.Context, nodeMatches []models.NodeMatch) []SynthesisFailure {
+	var failures []SynthesisFailure
+	fail := func(match *models.NodeMatch, err error) {
+		failures = append(failures, SynthesisFailure{
+			UnconsolidatedID: match.UnconsolidatedID,
+			ConsolidatedID:   match.ConsolidatedID,
+			NodeType:         match.NodeType,
+			Error:            err.Error(),
+		})
 	}
 
+	template := h.activePrompt(ctx, prompts.Synthesis)
 	for i := range nodeMatches {
 		match := &nodeMatches[i]
 
@@ -296,121 +337,55 @@ func (h *Handler) synthesizeNamesAndDescriptions(ctx context.Context, nodeMatche
 		unconsolidatedNode, err := h.fetchNodeDetails(ctx, match.UnconsolidatedID, match.NodeType)
 		if err != nil {
 			log.Printf("Warning: Could not fetch unconsolidated node %s: %v", match.UnconsolidatedID, err)
+			fail(match, fmt.Errorf("could not fetch unconsolidated node: %v", err))
 			continue
 		}
 
 		consolidatedNode, err := h.fetchNodeDetails(ctx, match.ConsolidatedID, match.NodeType)
 		if err != nil {
 			log.Printf("Warning: Could not fetch consolidated node %s: %v", match.ConsolidatedID, err)
+			fail(match, fmt.Errorf("could not fetch consolidated node: %v", err))
 			continue
 		}
 
-		// Create synthesis prompt
-		systemPrompt := "You are a Systems Analyst specializing in knowledge model normalization. Your task is to synthesize two similar concepts into a single, more universal concept. You must create a new formal name, a universal formal concept, and a concise, objective description that accurately represents both parent concepts."
-
-		userPrompt := fmt.Sprintf(`Your task is to synthesize the following two similar '%s' nodes into a single, more universal concept that gracefully merges their meaning.
-
-**Node A (Existing Consolidated Node):**
-- Name: "%s"
-- Description: "%s"
-
-**Node B (New Unconsolidated Node):**
-- Name: "%s"
-- Description: "%s"
-
-**Instructions:**
-1.  **Synthesize Name:** Create a new, objective, and timeless name.
-2.  **Synthesize Description:** Create a new description, under 15 words, that defines the component's objective function.
-
-Provide the response in this exact JSON format, with no other text:
-{
-  "name": "[new synthesized name]",
-  "description": "[new synthesized description]"
-}`,
+		// Node A is the existing consolidated node, Node B the new unconsolidated one
+		userPrompt := fmt.Sprintf(template.User,
 			match.NodeType,
-			unconsolidatedNode["name"].(string),
-			h.getDescription(unconsolidatedNode),
 			consolidatedNode["name"].(string),
-			h.getDescription(consolidatedNode))
-
-		// Call Gemini API using HTTP
-		llmApiUrl := "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent"
-
-		payload := map[string]interface{}{
-			"systemInstruction": map[string]interface{}{
-				"parts": []map[string]string{
-					{"text": systemPrompt},
-				},
-			},
-			"contents": []map[string]interface{}{
-				{
-					"parts": []map[string]string{
-						{"text": userPrompt},
-					},
-				},
-			},
-			"generationConfig": map[string]string{
-				"response_mime_type": "application/json",
-			},
-		}
-
-		llmReqBody, _ := json.Marshal(payload)
-		httpRequest, err := http.NewRequestWithContext(ctx, "POST", llmApiUrl, bytes.NewBuffer(llmReqBody))
-		if err != nil {
-			log.Printf("Warning: Failed to create synthesis request for nodes %s and %s: %v", match.UnconsolidatedID, match.ConsolidatedID, err)
-			continue
-		}
-
-		httpRequest.Header.Set("Content-Type", "application/json")
-		httpRequest.Header.Set("X-goog-api-key", geminiApiKey)
-
-		client := &http.Client{}
-		httpResponse, err := client.Do(httpRequest)
+			h.getDescription(consolidatedNode),
+			unconsolidatedNode["name"].(string),
+			h.getDescription(unconsolidatedNode))
+
+		response, err := h.llm.Generate(ctx, llm.Request{
+			Purpose:      "synthesis",
+			SystemPrompt: template.System,
+			UserPrompt:   userPrompt,
+			JSON:         true,
+			Trace:        llm.Trace{NodeIDs: []string{match.ConsolidatedID, match.UnconsolidatedID}, PromptVersion: template.Ref()},
+		})
 		if err != nil {
 			log.Printf("Warning: Failed to synthesize for nodes %s and %s: %v", match.UnconsolidatedID, match.ConsolidatedID, err)
+			fail(match, err)
 			continue
 		}
-		defer httpResponse.Body.Close()
-
-		if httpResponse.StatusCode != http.StatusOK {
-			log.Printf("Warning: Synthesis API returned status %d for nodes %s and %s", httpResponse.StatusCode, match.UnconsolidatedID, match.ConsolidatedID)
-			continue
-		}
+		log.Printf("Synthesis response: %s", response.Text)
 
-		// Parse the response
-		var geminiResponse map[string]interface{}
-		if err := json.NewDecoder(httpResponse.Body).Decode(&geminiResponse); err != nil {
-			log.Printf("Warning: Failed to parse synthesis response for nodes %s and %s: %v", match.UnconsolidatedID, match.ConsolidatedID, err)
+		// Parse the JSON response
+		var synthesis map[string]string
+		err = json.Unmarshal([]byte(response.Text), &synthesis)
+		h.recordParseOutcome(ctx, response, err)
+		if err != nil {
+			log.Printf("Warning: Failed to parse synthesis JSON for nodes %s and %s: %v", match.UnconsolidatedID, match.ConsolidatedID, err)
+			fail(match, fmt.Errorf("failed to parse synthesis: %v", err))
 			continue
 		}
-
-		// Extract the synthesized content
-		if candidates, ok := geminiResponse["candidates"].([]interface{}); ok && len(candidates) > 0 {
-			if candidate, ok := candidates[0].(map[string]interface{}); ok {
-				if content, ok := candidate["content"].(map[string]interface{}); ok {
-					if parts, ok := content["parts"].([]interface{}); ok && len(parts) > 0 {
-						if part, ok := parts[0].(map[string]interface{}); ok {
-							if text, ok := part["text"].(string); ok {
-								log.Printf("Synthesis response: %s", text)
-
-								// Parse the JSON response
-								var synthesis map[string]string
-								if err := json.Unmarshal([]byte(text), &synthesis); err == nil {
-									match.NewName = synthesis["name"]
-									match.NewDescription = synthesis["description"]
-									log.Printf("Parsed synthesis - Name: '%s', Description: '%s'", match.NewName, match.NewDescription)
-								} else {
-									log.Printf("Warning: Failed to parse synthesis JSON for nodes %s and %s: %v", match.UnconsolidatedID, match.ConsolidatedID, err)
-								}
-							}
-						}
-					}
-				}
-			}
-		}
+		match.NewName = synthesis["name"]
+		match.NewDescription = synthesis["description"]
+		match.PromptVersion = template.Ref()
+		log.Printf("Parsed synthesis - Name: '%s', Description: '%s'", match.NewName, match.NewDescription)
 	}
 
-	return nil
+	return failures
 }
 
 // Helper functions
@@ -518,9 +493,19 @@ func (h *Handler) consolidateRelationships(ctx context.Context, nodeMatches []mo
 		return fmt.Errorf("failed to fetch relationships: %v", err)
 	}
 
-	// Process each relationship
+	// Process each relationship. Only approved relationships whose endpoints are both consolidated are
+	// consolidated; the rest stay staged, following any endpoint that was merged away.
 	for _, rel := range relationships {
-		err := h.processRelationshipConsolidation(ctx, rel, nodeMapping)
+		_, fromMapped := nodeMapping[rel.FromID]
+		_, toMapped := nodeMapping[rel.ToID]
+
+		var err error
+		switch {
+		case rel.Approved && (rel.FromSettled || fromMapped) && (rel.ToSettled || toMapped):
+			err = h.processRelationshipConsolidation(ctx, rel, nodeMapping)
+		case fromMapped || toMapped:
+			err = h.repointStagedRelationship(ctx, rel, nodeMapping)
+		}
 		if err != nil {
 			log.Printf("Warning: Failed to consolidate relationship: %v", err)
 			continue
@@ -530,10 +515,48 @@ func (h *Handler) consolidateRelationships(ctx context.Context, nodeMatches []mo
 	return nil
 }
 
+// repointStagedRelationship moves a relationship that is not ready for consolidation onto the nodes its
+// endpoints were consolidated into, so it stays in the staging area when the merged nodes are cleaned up
+func (h *Handler) repointStagedRelationship(ctx context.Context, rel models.RelationshipConsolidation, nodeMapping map[string]string) error {
+	fromID, toID := rel.FromID, rel.ToID
+	if mapped, exists := nodeMapping[fromID]; exists {
+		fromID = mapped
+	}
+	if mapped, exists := nodeMapping[toID]; exists {
+		toID = mapped
+	}
+	if fromID == rel.FromID && toID == rel.ToID {
+		return nil
+	}
+
+	query := fmt.Sprintf(`
+		MATCH ()-[r:%s]->() WHERE elementId(r) = $element_id
+		MATCH (from {id: $from_id}), (to {id: $to_id})
+		CREATE (from)-[moved:%s]->(to)
+		SET moved = properties(r)
+		DELETE r
+	`, rel.RelationType, rel.RelationType)
+
+	_, err := h.db.ExecuteQuery(ctx, query, map[string]interface{}{
+		"element_id": rel.ElementID,
+		"from_id":    fromID,
+		"to_id":      toID,
+	})
+	return err
+}
+
 // Step 6: Cleanup (Transaction 3)
-func (h *Handler) cleanupUnconsolidatedNodes(ctx context.Context) error {
-	query := `MATCH (n) WHERE n.consolidated = false DETACH DELETE n`
-	_, err := h.db.ExecuteQuery(ctx, query, nil)
+// Deletes the unconsolidated nodes that were merged into consolidated ones. Nodes not yet approved stay staged.
+func (h *Handler) cleanupUnconsolidatedNodes(ctx context.Context, nodeMatches []models.NodeMatch) error {
+	merged := []string{}
+	for _, match := range nodeMatches {
+		if match.UnconsolidatedID != match.ConsolidatedID {
+			merged = append(merged, match.UnconsolidatedID)
+		}
+	}
+
+	query := `MATCH (n) WHERE n.id IN $ids AND n.consolidated = false DETACH DELETE n`
+	_, err := h.db.ExecuteQuery(ctx, query, map[string]interface{}{"ids": merged})
 	return err
 }
 
@@ -543,11 +566,14 @@ func (h *Handler) promoteNodeToConsolidated(ctx context.Context, nodeID, nodeTyp
 	var query string
 	switch nodeType {
 	case "system":
-		query = `MATCH (s:System {id: $id}) SET s.consolidated = true, s.consolidation_score = 1, s.last_consolidated_at = $timestamp`
+		query = `MATCH (s:System {id: $id}) SET s.consolidated = true, s.consolidation_score = 1, s.last_consolidated_at = $timestamp,
+			s.source_narratives = COALESCE(s.source_narratives, [x IN [s.narrative_id] WHERE x IS NOT NULL])`
 	case "stock":
-		query = `MATCH (st:Stock {id: $id}) SET st.consolidated = true, st.consolidation_score = 1, st.last_consolidated_at = $timestamp`
+		query = `MATCH (st:Stock {id: $id}) SET st.consolidated = true, st.consolidation_score = 1, st.last_consolidated_at = $timestamp,
+			st.source_narratives = COALESCE(st.source_narratives, [x IN [st.narrative_id] WHERE x IS NOT NULL])`
 	case "flow":
-		query = `MATCH (f:Flow {id: $id}) SET f.consolidated = true, f.consolidation_score = 1, f.last_consolidated_at = $timestamp`
+		query = `MATCH (f:Flow {id: $id}) SET f.consolidated = true, f.consolidation_score = 1, f.last_consolidated_at = $timestamp,
+			f.source_narratives = COALESCE(f.source_narratives, [x IN [f.narrative_id] WHERE x IS NOT NULL])`
 	default:
 		return fmt.Errorf("unknown node type: %s", nodeType)
 	}
@@ -586,9 +612,10 @@ func (h *Handler) mergeIntoConsolidatedNode(ctx context.Context, match models.No
 		query = `MATCH (s:System {id: $id}) 
 			SET s.embedding = $embedding, 
 				s.consolidation_score = s.consolidation_score + 1, 
+				s.source_narratives = COALESCE(s.source_narratives, [x IN [s.narrative_id] WHERE x IS NOT NULL]) + $source_narratives,
 				s.last_consolidated_at = $timestamp`
 		if match.NewName != "" {
-			query += `, s.name = $name`
+			query += `, s.name = $name, s.name_prompt_version = $prompt_version`
 		}
 		if match.NewDescription != "" {
 			query += `, s.boundary_description = $description`
@@ -597,9 +624,10 @@ func (h *Handler) mergeIntoConsolidatedNode(ctx context.Context, match models.No
 		query = `MATCH (st:Stock {id: $id}) 
 			SET st.embedding = $embedding, 
 				st.consolidation_score = st.consolidation_score + 1, 
+				st.source_narratives = COALESCE(st.source_narratives, [x IN [st.narrative_id] WHERE x IS NOT NULL]) + $source_narratives,
 				st.last_consolidated_at = $timestamp`
 		if match.NewName != "" {
-			query += `, st.name = $name`
+			query += `, st.name = $name, st.name_prompt_version = $prompt_version`
 		}
 		if match.NewDescription != "" {
 			query += `, st.description = $description`
@@ -608,9 +636,10 @@ func (h *Handler) mergeIntoConsolidatedNode(ctx context.Context, match models.No
 		query = `MATCH (f:Flow {id: $id}) 
 			SET f.embedding = $embedding, 
 				f.consolidation_score = f.consolidation_score + 1, 
+				f.source_narratives = COALESCE(f.source_narratives, [x IN [f.narrative_id] WHERE x IS NOT NULL]) + $source_narratives,
 				f.last_consolidated_at = $timestamp`
 		if match.NewName != "" {
-			query += `, f.name = $name`
+			query += `, f.name = $name, f.name_prompt_version = $prompt_version`
 		}
 		if match.NewDescription != "" {
 			query += `, f.description = $description`
@@ -620,13 +649,15 @@ func (h *Handler) mergeIntoConsolidatedNode(ctx context.Context, match models.No
 	}
 
 	params := map[string]interface{}{
-		"id":        match.ConsolidatedID,
-		"embedding": newEmbedding,
-		"timestamp": time.Now().Format(time.RFC3339),
+		"id":                match.ConsolidatedID,
+		"embedding":         newEmbedding,
+		"source_narratives": unconsolidatedNode.SourceNarratives,
+		"timestamp":         time.Now().Format(time.RFC3339),
 	}
 
 	if match.NewName != "" {
 		params["name"] = match.NewName
+		params["prompt_version"] = nilIfEmpty(match.PromptVersion)
 	}
 	if match.NewDescription != "" {
 		params["description"] = match.NewDescription
@@ -702,17 +733,21 @@ func (h *Handler) mergeIntoConsolidatedNode(ctx context.Context, match models.No
 type NodeEmbeddingScore struct {
 	Embedding          []float32
 	ConsolidationScore int
+	SourceNarratives   []string // IDs of the narratives whose extractions this node represents
 }
 
 func (h *Handler) getNodeEmbeddingAndScore(ctx context.Context, nodeID, nodeType string) (*NodeEmbeddingScore, error) {
 	var query string
 	switch nodeType {
 	case "system":
-		query = `MATCH (s:System {id: $id}) RETURN s.embedding as embedding, s.consolidation_score as consolidation_score`
+		query = `MATCH (s:System {id: $id}) RETURN s.embedding as embedding, s.consolidation_score as consolidation_score,
+			COALESCE(s.source_narratives, [x IN [s.narrative_id] WHERE x IS NOT NULL]) as source_narratives`
 	case "stock":
-		query = `MATCH (st:Stock {id: $id}) RETURN st.embedding as embedding, st.consolidation_score as consolidation_score`
+		query = `MATCH (st:Stock {id: $id}) RETURN st.embedding as embedding, st.consolidation_score as consolidation_score,
+			COALESCE(st.source_narratives, [x IN [st.narrative_id] WHERE x IS NOT NULL]) as source_narratives`
 	case "flow":
-		query = `MATCH (f:Flow {id: $id}) RETURN f.embedding as embedding, f.consolidation_score as consolidation_score`
+		query = `MATCH (f:Flow {id: $id}) RETURN f.embedding as embedding, f.consolidation_score as consolidation_score,
+			COALESCE(f.source_narratives, [x IN [f.narrative_id] WHERE x IS NOT NULL]) as source_narratives`
 	default:
 		return nil, fmt.Errorf("unknown node type: %s", nodeType)
 	}
@@ -732,9 +767,19 @@ func (h *Handler) getNodeEmbeddingAndScore(ctx context.Context, nodeID, nodeType
 		consolidationScore = int(score.(int64))
 	}
 
+	sourceNarratives := []string{}
+	if sources, ok := records[0]["source_narratives"].([]interface{}); ok {
+		for _, source := range sources {
+			if id, ok := source.(string); ok {
+				sourceNarratives = append(sourceNarratives, id)
+			}
+		}
+	}
+
 	return &NodeEmbeddingScore{
 		Embedding:          embedding,
 		ConsolidationScore: consolidationScore,
+		SourceNarratives:   sourceNarratives,
 	}, nil
 }
 
@@ -771,6 +816,7 @@ func (h *Handler) fetchUnconsolidatedRelationships(ctx context.Context) ([]model
 		typeRecords = []map[string]interface{}{
 			{"rel_type": "DESCRIBES"},
 			{"rel_type": "DESCRIBES_STATIC"},
+			{"rel_type": "DESCRIBES_DYNAMIC"},
 			{"rel_type": "CAUSAL_LINK"},
 			{"rel_type": "CHANGES"},
 		}
@@ -784,7 +830,10 @@ func (h *Handler) fetchUnconsolidatedRelationships(ctx context.Context) ([]model
 		query := fmt.Sprintf(`
 			MATCH (from)-[r:%s]->(to)
 			WHERE r.consolidated = false OR r.consolidated IS NULL
-			RETURN '%s' as type, from.id as from_id, to.id as to_id
+			RETURN '%s' as type, elementId(r) as element_id, from.id as from_id, to.id as to_id,
+				COALESCE(r.approved, false) as approved,
+				(from:Narrative OR from.consolidated = true) as from_settled,
+				(to:Narrative OR to.consolidated = true) as to_settled
 		`, relType, relType)
 
 		records, err := h.db.ExecuteRead(ctx, query, nil)
@@ -798,6 +847,10 @@ func (h *Handler) fetchUnconsolidatedRelationships(ctx context.Context) ([]model
 				RelationType: record["type"].(string),
 				FromID:       record["from_id"].(string),
 				ToID:         record["to_id"].(string),
+				ElementID:    record["element_id"].(string),
+				Approved:     record["approved"].(bool),
+				FromSettled:  record["from_settled"].(bool),
+				ToSettled:    record["to_settled"].(bool),
 			})
 		}
 
@@ -832,17 +885,42 @@ func (h *Handler) processRelationshipConsolidation(ctx context.Context, rel mode
 	// Case 1: Neither node was consolidated (e.g., both are Narratives, or other non-consolidating types)
 	// Just mark the existing relationship as consolidated
 	if !fromWasConsolidated && !toWasConsolidated {
+		// Grounded extraction can link two existing consolidated nodes; fold the new
+		// relationship into an existing consolidated one instead of duplicating it
+		foldQuery := fmt.Sprintf(`
+			MATCH (from)-[r:%s]->(to) WHERE elementId(r) = $element_id
+			MATCH (from)-[existing:%s]->(to)
+			WHERE existing.consolidated = true
+			WITH existing, collect(DISTINCT r) as duplicates
+			SET existing.consolidation_score = COALESCE(existing.consolidation_score, 0) + size(duplicates),
+				existing.source_narratives = COALESCE(existing.source_narratives, []) +
+					reduce(sources = [], d IN duplicates | sources + COALESCE(d.source_narratives, [x IN [d.narrative_id] WHERE x IS NOT NULL]))
+			FOREACH (d IN duplicates | DELETE d)
+			RETURN size(duplicates) as folded
+		`, rel.RelationType, rel.RelationType)
+
+		foldRecords, err := h.db.ExecuteRead(ctx, foldQuery, map[string]interface{}{
+			"element_id": rel.ElementID,
+		})
+		if err != nil {
+			return err
+		}
+		if len(foldRecords) > 0 {
+			log.Printf("Folded %s relationship %s -> %s into existing consolidated relationship", rel.RelationType, rel.FromID, rel.ToID)
+			return nil
+		}
+
 		query := fmt.Sprintf(`
-			MATCH (from {id: $from_id})-[r:%s]->(to {id: $to_id})
-			SET r.consolidated = true, r.consolidation_score = 1
+			MATCH ()-[r:%s]->() WHERE elementId(r) = $element_id
+			SET r.consolidated = true, r.consolidation_score = 1,
+				r.source_narratives = COALESCE(r.source_narratives, [x IN [r.narrative_id] WHERE x IS NOT NULL])
 		`, rel.RelationType)
 
 		params := map[string]interface{}{
-			"from_id": rel.FromID,
-			"to_id":   rel.ToID,
+			"element_id": rel.ElementID,
 		}
 
-		_, err := h.db.ExecuteQuery(ctx, query, params)
+		_, err = h.db.ExecuteQuery(ctx, query, params)
 		return err
 	}
 
@@ -850,16 +928,22 @@ func (h *Handler) processRelationshipConsolidation(ctx context.Context, rel mode
 	// Create/update consolidated relationship and delete the old unconsolidated one
 
 	// First, create or update the consolidated relationship
+	// The original relationship's provenance is carried over to the consolidated one
 	mergeQuery := fmt.Sprintf(`
 		MATCH (from {id: $consolidated_from_id}), (to {id: $consolidated_to_id})
+		OPTIONAL MATCH ()-[original:%s]->() WHERE elementId(original) = $element_id
+		WITH from, to, head(collect(original)) as original
+		WITH from, to, COALESCE(original.source_narratives, [x IN [original.narrative_id] WHERE x IS NOT NULL]) as sources
 		MERGE (from)-[r:%s]->(to)
-		ON CREATE SET r.consolidated = true, r.consolidation_score = 1
-		ON MATCH SET r.consolidated = true, r.consolidation_score = COALESCE(r.consolidation_score, 0) + 1
-	`, rel.RelationType)
+		ON CREATE SET r.consolidated = true, r.consolidation_score = 1, r.source_narratives = sources
+		ON MATCH SET r.consolidated = true, r.consolidation_score = COALESCE(r.consolidation_score, 0) + 1,
+			r.source_narratives = COALESCE(r.source_narratives, []) + sources
+	`, rel.RelationType, rel.RelationType)
 
 	mergeParams := map[string]interface{}{
 		"consolidated_from_id": consolidatedFrom,
 		"consolidated_to_id":   consolidatedTo,
+		"element_id":           rel.ElementID,
 	}
 
 	_, err := h.db.ExecuteQuery(ctx, mergeQuery, mergeParams)
@@ -871,13 +955,12 @@ func (h *Handler) processRelationshipConsolidation(ctx context.Context, rel mode
 	// Second, delete the old unconsolidated relationship (only if nodes actually changed)
 	if consolidatedFrom != rel.FromID || consolidatedTo != rel.ToID {
 		deleteQuery := fmt.Sprintf(`
-			MATCH (from {id: $original_from_id})-[r:%s]->(to {id: $original_to_id})
+			MATCH ()-[r:%s]->() WHERE elementId(r) = $element_id
 			DELETE r
 		`, rel.RelationType)
 
 		deleteParams := map[string]interface{}{
-			"original_from_id": rel.FromID,
-			"original_to_id":   rel.ToID,
+			"element_id": rel.ElementID,
 		}
 
 		_, err = h.db.ExecuteQuery(ctx, deleteQuery, deleteParams)
@@ -908,14 +991,15 @@ func (h *Handler) processRelationshipConsolidation(ctx context.Context, rel mode
 }
 
 // ResetConsolidation - Reset all nodes to unconsolidated status for re-consolidation
+// Previously consolidated nodes and relationships stay approved so the next consolidation consumes them again.
 func (h *Handler) ResetConsolidation(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	// Reset all nodes to unconsolidated
 	nodeQueries := []string{
-		`MATCH (s:System) WHERE s.embedded = true SET s.consolidated = false, s.consolidation_score = 0`,
-		`MATCH (st:Stock) WHERE st.embedded = true SET st.consolidated = false, st.consolidation_score = 0`,
-		`MATCH (f:Flow) WHERE f.embedded = true SET f.consolidated = false, f.consolidation_score = 0`,
+		`MATCH (s:System) WHERE s.embedded = true SET s.approved = (s.consolidated = true OR COALESCE(s.approved, false)), s.consolidated = false, s.consolidation_score = 0`,
+		`MATCH (st:Stock) WHERE st.embedded = true SET st.approved = (st.consolidated = true OR COALESCE(st.approved, false)), st.consolidated = false, st.consolidation_score = 0`,
+		`MATCH (f:Flow) WHERE f.embedded = true SET f.approved = (f.consolidated = true OR COALESCE(f.approved, false)), f.consolidated = false, f.consolidation_score = 0`,
 	}
 
 	for _, query := range nodeQueries {
@@ -928,10 +1012,11 @@ func (h *Handler) ResetConsolidation(c *gin.Context) {
 
 	// Reset all relationships to unconsolidated (using actual relationship types)
 	relationshipQueries := []string{
-		`MATCH ()-[r:DESCRIBES]->() SET r.consolidated = false, r.consolidation_score = 0`,
-		`MATCH ()-[r:DESCRIBES_STATIC]->() SET r.consolidated = false, r.consolidation_score = 0`,
-		`MATCH ()-[r:CAUSAL_LINK]->() SET r.consolidated = false, r.consolidation_score = 0`,
-		`MATCH ()-[r:CHANGES]->() SET r.consolidated = false, r.consolidation_score = 0`,
+		`MATCH ()-[r:DESCRIBES]->() SET r.approved = (r.consolidated = true OR COALESCE(r.approved, false)), r.consolidated = false, r.consolidation_score = 0`,
+		`MATCH ()-[r:DESCRIBES_STATIC]->() SET r.approved = (r.consolidated = true OR COALESCE(r.approved, false)), r.consolidated = false, r.consolidation_score = 0`,
+		`MATCH ()-[r:DESCRIBES_DYNAMIC]->() SET r.approved = (r.consolidated = true OR COALESCE(r.approved, false)), r.consolidated = false, r.consolidation_score = 0`,
+		`MATCH ()-[r:CAUSAL_LINK]->() SET r.approved = (r.consolidated = true OR COALESCE(r.approved, false)), r.consolidated = false, r.consolidation_score = 0`,
+		`MATCH ()-[r:CHANGES]->() SET r.approved = (r.consolidated = true OR COALESCE(r.approved, false)), r.consolidated = false, r.consolidation_score = 0`,
 	}
 
 	for _, query := range relationshipQueries {
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
+)
+
+// Critic modes: skip the critique, report violations, or ask the LLM to repair them before execution
+const (
+	CriticOff    = "off"
+	CriticFlag   = "flag"
+	CriticRepair = "repair"
+)
+
+// Extraction rules checked by the critic, named as in the critique and repair prompts
+const (
+	ruleFormalName           = "formal_name"
+	ruleDescriptionLength    = "description_length"
+	ruleObjectiveDescription = "objective_description"
+	ruleFlowChangesStock     = "flow_changes_stock"
+	ruleResearchQuestion     = "research_question"
+)
+
+const (
+	maxDescriptionWords = 14 // Descriptions must be under 15 words
+	maxNameWords        = 6  // Longer names read as sentences rather than formal concepts
+)
+
+var criticRules = map[string]bool{
+	ruleFormalName: true, ruleDescriptionLength: true, ruleObjectiveDescription: true, ruleFlowChangesStock: true, ruleResearchQuestion: true,
+}
+
+// firstPersonWords matches personal framing. "I" and "us" are case-sensitive so numerals and "US" pass.
+var firstPersonWords = regexp.MustCompile(`\b(I|I'm|I've|I'd|us)\b|(?i:\b(me|my|mine|myself|we|our|ours)\b)`)
+var momentWords = regexp.MustCompile(`(?i)\b(today|tonight|yesterday|tomorrow|recently|nowadays|last (night|week|month|year)|this (morning|evening|week|month|year))\b`)
+
+// CritiqueViolation is one action that breaks an extraction rule
+type CritiqueViolation struct {
+	Action       int    `json:"action"` // Index of the action in the extracted plan
+	FunctionName string `json:"function_name"`
+	Name         string `json:"name,omitempty"`
+	Rule         string `json:"rule"`
+	Message      string `json:"message"`
+	Source       string `json:"source"` // "check" for deterministic checks, "llm" for the LLM critique
+	Status       string `json:"status"` // "flagged" or "repaired"
+}
+
+// CritiqueReport lists the rule violations found in an extracted plan and what became of them
+type CritiqueReport struct {
+	Mode       string              `json:"mode"`
+	Violations []CritiqueViolation `json:"violations"`
+	Flagged    int                 `json:"flagged"`
+	Repaired   int                 `json:"repaired"`
+	Error      string              `json:"error,omitempty"` // LLM critique or repair failure; deterministic checks still apply
+}
+
+// resolveCriticMode returns the requested critic mode, or EXTRACTION_CRITIC (default "off") when none was requested
+func resolveCriticMode(requested string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(requested))
+	if mode == "" {
+		mode = strings.ToLower(os.Getenv("EXTRACTION_CRITIC"))
+	}
+	switch mode {
+	case "", CriticOff:
+		return CriticOff, nil
+	case CriticFlag, CriticRepair:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown critic mode %q: use off, flag or repair", mode)
+	}
+}
+
+// critiquePlan checks a plan against the extraction rules, deterministically and with an LLM critique. In repair
+// mode the LLM rewrites the violating actions and the repaired plan is returned; otherwise the plan is returned
+// unchanged with its violations flagged. LLM failures are reported and leave the deterministic findings in place.
+func (h *Handler) critiquePlan(ctx context.Context, narrative *models.Narrative, plan models.LLMResponse, mode string) (models.LLMResponse, *CritiqueReport) {
+	report := &CritiqueReport{Mode: mode, Violations: checkPlanRules(plan)}
+	llmViolations, err := h.llmCritique(ctx, narrative, plan)
+	if err != nil {
+		log.Printf("Warning: LLM critique failed for narrative %s: %v", narrative.ID, err)
+		report.Error = "critique: " + err.Error()
+	}
+	report.Violations = mergeViolations(report.Violations, llmViolations)
+
+	if mode == CriticRepair && len(report.Violations) > 0 {
+		repaired, rewritten, err := h.repairPlan(ctx, narrative, plan, report.Violations)
+		if err != nil {
+			log.Printf("Warning: Plan repair failed for narrative %s: %v", narrative.ID, err)
+			if report.Error != "" {
+				report.Error += "; "
+			}
+			report.Error += "repair: " + err.Error()
+		} else {
+			// A violation is repaired when its action was rewritten and the checks no longer find it
+			remaining := make(map[string]bool)
+			for _, violation := range checkPlanRules(repaired) {
+				remaining[violationKey(violation)] = true
+			}
+			for i, violation := range report.Violations {
+				fixed := rewritten[violation.Action] || violation.Rule == ruleFlowChangesStock
+				if fixed && !remaining[violationKey(violation)] {
+					report.Violations[i].Status = "repaired"
+				}
+			}
+			plan = repaired
+		}
+	}
+
+	for _, violation := range report.Violations {
+		if violation.Status == "repaired" {
+			report.Repaired++
+		} else {
+			report.Flagged++
+		}
+	}
+	if len(report.Violations) > 0 {
+		log.Printf("Critique for narrative %s (%s): %d violations, %d repaired, %d flagged",
+			narrative.ID, mode, len(report.Violations), report.Repaired, report.Flagged)
+	}
+	return plan, report
+}
+
+// checkPlanRules runs the deterministic rule checks over every action of a plan
+func checkPlanRules(plan models.LLMResponse) []CritiqueViolation {
+	var violations []CritiqueViolation
+	flag := func(index int, action models.LLMAction, rule, message string) {
+		name, _ := action.Parameters["name"].(string)
+		violations = append(violations, CritiqueViolation{
+			Action: index, FunctionName: action.FunctionName, Name: name,
+			Rule: rule, Message: message, Source: "check", Status: "flagged",
+		})
+	}
+
+	changedFlows := make(map[string]bool)
+	for _, action := range plan.Actions {
+		if action.FunctionName == "CreateChangesRelationship" {
+			flowName, _ := action.Parameters["flowName"].(string)
+			changedFlows[normalizeElementName(flowName)] = true
+		}
+	}
+
+	for i, action := range plan.Actions {
+		switch action.FunctionName {
+		case "CreateSystemNode", "CreateStockNode", "CreateFlowNode":
+			name, _ := action.Parameters["name"].(string)
+			if message := checkFormalName(name); message != "" {
+				flag(i, action, ruleFormalName, message)
+			}
+			description := actionDescription(action)
+			if words := len(strings.Fields(description)); words > maxDescriptionWords {
+				flag(i, action, ruleDescriptionLength, fmt.Sprintf("description has %d words; it must be under 15", words))
+			}
+			if firstPersonWords.MatchString(description) {
+				flag(i, action, ruleObjectiveDescription, "description uses personal framing instead of the component's objective function")
+			}
+			if action.FunctionName == "CreateFlowNode" && !changedFlows[normalizeElementName(name)] {
+				flag(i, action, ruleFlowChangesStock, "flow does not change any stock")
+			}
+		case "CreateCausalLinkRelationship":
+			question, _ := action.Parameters["curiosity"].(string)
+			question = strings.TrimSpace(question)
+			if !strings.HasSuffix(question, "?") {
+				flag(i, action, ruleResearchQuestion, "curiosity is not phrased as a question")
+			} else if firstPersonWords.MatchString(question) {
+				flag(i, action, ruleResearchQuestion, "curiosity uses personal framing instead of a formal research question")
+			}
+		}
+	}
+	return violations
+}
+
+// checkFormalName explains why a name is not objective, formal and timeless, or returns ""
+func checkFormalName(name string) string {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "":
+		return "name is empty"
+	case firstPersonWords.MatchString(name):
+		return "name uses personal framing"
+	case momentWords.MatchString(name):
+		return "name refers to a specific moment rather than a timeless concept"
+	case strings.ContainsAny(name[len(name)-1:], ".!?"):
+		return "name reads as a sentence"
+	case len(strings.Fields(name)) > maxNameWords:
+		return fmt.Sprintf("name has %d words; formal names are short noun phrases", len(strings.Fields(name)))
+	case unicode.IsLower([]rune(name)[0]):
+		return "name is not capitalized like a formal concept"
+	}
+	return ""
+}
+
+// llmCritique asks the LLM which actions break the extraction rules
+func (h *Handler) llmCritique(ctx context.Context, narrative *models.Narrative, plan models.LLMResponse) ([]CritiqueViolation, error) {
+	if len(plan.Actions) == 0 {
+		return nil, nil
+	}
+	template := h.activePrompt(ctx, prompts.Critique)
+	response, err := h.llm.Generate(ctx, llm.Request{
+		Purpose:      "critique",
+		SystemPrompt: template.System,
+		UserPrompt:   fmt.Sprintf(template.User, formatNumberedActions(plan.Actions)),
+		JSON:         true,
+		Trace:        llm.Trace{NarrativeID: narrative.ID, PromptVersion: template.Ref()},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var critique struct {
+		Violations []struct {
+			Action  int    `json:"action"`
+			Rule    string `json:"rule"`
+			Message string `json:"message"`
+		} `json:"violations"`
+	}
+	err = json.Unmarshal([]byte(response.Text), &critique)
+	h.recordParseOutcome(ctx, response, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse critique: %v", err)
+	}
+
+	var violations []CritiqueViolation
+	for _, found := range critique.Violations {
+		if found.Action < 0 || found.Action >= len(plan.Actions) || !criticRules[found.Rule] {
+			continue
+		}
+		action := plan.Actions[found.Action]
+		name, _ := action.Parameters["name"].(string)
+		violations = append(violations, CritiqueViolation{
+			Action: found.Action, FunctionName: action.FunctionName, Name: name,
+			Rule: found.Rule, Message: found.Message, Source: "llm", Status: "flagged",
+		})
+	}
+	return violations, nil
+}
+
+// repairPlan asks the LLM to rewrite the violating actions and applies its corrections to a copy of the plan.
+// Renamed nodes are renamed in the relationships that refer to them. It also returns the rewritten action indices.
+func (h *Handler) repairPlan(ctx context.Context, narrative *models.Narrative, plan models.LLMResponse, violations []CritiqueViolation) (models.LLMResponse, map[int]bool, error) {
+	byAction := make(map[int][]CritiqueViolation)
+	var indices []int
+	for _, violation := range violations {
+		if _, seen := byAction[violation.Action]; !seen {
+			indices = append(indices, violation.Action)
+		}
+		byAction[violation.Action] = append(byAction[violation.Action], violation)
+	}
+	sort.Ints(indices)
+
+	var toRepair strings.Builder
+	for _, index := range indices {
+		actionJSON, _ := json.Marshal(plan.Actions[index])
+		fmt.Fprintf(&toRepair, "[%d] %s\n", index, actionJSON)
+		for _, violation := range byAction[index] {
+			fmt.Fprintf(&toRepair, "  - %s: %s\n", violation.Rule, violation.Message)
+		}
+	}
+
+	template := h.activePrompt(ctx, prompts.Repair)
+	response, err := h.llm.Generate(ctx, llm.Request{
+		Purpose:      "repair",
+		SystemPrompt: template.System,
+		UserPrompt:   fmt.Sprintf(template.User, formatNumberedActions(plan.Actions), toRepair.String()),
+		JSON:         true,
+		Trace:        llm.Trace{NarrativeID: narrative.ID, PromptVersion: template.Ref()},
+	})
+	if err != nil {
+		return plan, nil, err
+	}
+
+	var repair struct {
+		Actions []struct {
+			Index        int                    `json:"index"`
+			FunctionName string                 `json:"function_name"`
+			Parameters   map[string]interface{} `json:"parameters"`
+		} `json:"actions"`
+	}
+	err = json.Unmarshal([]byte(response.Text), &repair)
+	h.recordParseOutcome(ctx, response, err)
+	if err != nil {
+		return plan, nil, fmt.Errorf("failed to parse repair: %v", err)
+	}
+
+	repaired := models.LLMResponse{Actions: append([]models.LLMAction(nil), plan.Actions...)}
+	rewritten := make(map[int]bool)
+	for _, fix := range repair.Actions {
+		if len(fix.Parameters) == 0 {
+			continue
+		}
+		if fix.Index == -1 && fix.FunctionName == "CreateChangesRelationship" {
+			repaired.Actions = append(repaired.Actions, models.LLMAction{FunctionName: fix.FunctionName, Parameters: fix.Parameters})
+			continue
+		}
+		// Only the actions sent for repair may change, and only their parameters
+		if _, requested := byAction[fix.Index]; !requested {
+			continue
+		}
+		original := plan.Actions[fix.Index]
+		if fix.FunctionName != original.FunctionName {
+			continue
+		}
+		oldName, _ := original.Parameters["name"].(string)
+		newName, _ := fix.Parameters["name"].(string)
+		repaired.Actions[fix.Index] = models.LLMAction{
+			FunctionName:  original.FunctionName,
+			Parameters:    fix.Parameters,
+			SourceChunks:  original.SourceChunks,
+			Confidence:    original.Confidence,
+			PromptVersion: original.PromptVersion,
+		}
+		rewritten[fix.Index] = true
+		if _, isNode := nodeActionTypes[original.FunctionName]; isNode && oldName != "" && newName != "" && newName != oldName {
+			renameInRelationships(repaired.Actions, actionNodeType(original), oldName, newName)
+		}
+	}
+	return repaired, rewritten, nil
+}
+
+// renameInRelationships points relationship actions that name oldName as a nodeType endpoint at newName
+func renameInRelationships(actions []models.LLMAction, nodeType, oldName, newName string) {
+	for i, action := range actions {
+		nameParams, isRelationship := relationshipNameParams[action.FunctionName]
+		if !isRelationship {
+			continue
+		}
+		for param, typeSource := range nameParams {
+			endpointType := typeSource
+			if action.FunctionName == "CreateCausalLinkRelationship" {
+				endpointType, _ = action.Parameters[typeSource].(string)
+				endpointType = strings.ToLower(endpointType)
+			}
+			if name, _ := action.Parameters[param].(string); endpointType == nodeType && name == oldName {
+				actions[i].Parameters = withParam(actions[i].Parameters, param, newName)
+			}
+		}
+	}
+}
+
+// mergeViolations appends the LLM's findings that the deterministic checks did not already report
+func mergeViolations(checked, critiqued []CritiqueViolation) []CritiqueViolation {
+	seen := make(map[string]bool)
+	for _, violation := range checked {
+		seen[violationKey(violation)] = true
+	}
+	for _, violation := range critiqued {
+		if !seen[violationKey(violation)] {
+			seen[violationKey(violation)] = true
+			checked = append(checked, violation)
+		}
+	}
+	return checked
+}
+
+func violationKey(violation CritiqueViolation) string {
+	return fmt.Sprintf("%d|%s", violation.Action, violation.Rule)
+}
+
+// formatNumberedActions lists actions one per line as "[index] {json}", without provenance fields
+func formatNumberedActions(actions []models.LLMAction) string {
+	var sb strings.Builder
+	for i, action := range actions {
+		actionJSON, _ := json.Marshal(models.LLMAction{FunctionName: action.FunctionName, Parameters: action.Parameters})
+		fmt.Fprintf(&sb, "[%d] %s\n", i, actionJSON)
+	}
+	return sb.String()
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+func TestCheckPlanRulesReportsEachRuleSeparately(t *testing.T) {
+	stock := func(name, description string) models.LLMAction {
+		return models.LLMAction{FunctionName: "CreateStockNode", Parameters: map[string]interface{}{"name": name, "description": description, "type": "qualitative"}}
+	}
+	tests := []struct {
+		name   string
+		action models.LLMAction
+		want   []string
+	}{
+		{"clean", stock("Technical Debt", "Accumulated cost of expedient implementation shortcuts."), nil},
+		{"personal name", stock("My Technical Debt", "Accumulated cost of expedient implementation shortcuts."), []string{ruleFormalName}},
+		{"long description", stock("Technical Debt", "The accumulated cost of every expedient design and implementation shortcut taken while shipping software features quickly."), []string{ruleDescriptionLength}},
+		{"personal description", stock("Technical Debt", "Shortcuts we took that slow our work."), []string{ruleObjectiveDescription}},
+		{"long and personal description", stock("Technical Debt", "All of the shortcuts we took over the years that keep slowing our team down every single sprint."), []string{ruleDescriptionLength, ruleObjectiveDescription}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, violation := range checkPlanRules(models.LLMResponse{Actions: []models.LLMAction{tt.action}}) {
+				got = append(got, violation.Rule)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("rules = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,13 +1,13 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
 	"github.com/gin-gonic/gin"
 )
 
@@ -178,113 +178,36 @@ func (h *Handler) DebugSynthesis(c *gin.Context) {
 		return
 	}
 
-	// Test synthesis directly
-	geminiApiKey := os.Getenv("GEMINI_API_KEY")
-	if geminiApiKey == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "GEMINI_API_KEY not set"})
-		return
-	}
-
-	// Create synthesis prompt
-	systemPrompt := "You are an expert in systems thinking and knowledge synthesis. Your task is to combine two related concepts into a single, coherent name and description."
-
-	userPrompt := fmt.Sprintf(`Synthesize a new, concise name and a comprehensive description that accurately combines the concepts of these two %s nodes:
-
-Node A - Name: %s, Description: %s
-Node B - Name: %s, Description: %s
-
-Please provide the response in this exact JSON format:
-{
-  "name": "[new synthesized name]",
-  "description": "[new synthesized description]"
-}`,
+	// Render the active synthesis prompt exactly as consolidation does
+	template := h.activePrompt(ctx, prompts.Synthesis)
+	userPrompt := fmt.Sprintf(template.User,
 		node1.NodeType,
 		node1.Name, node1.Description,
 		node2.Name, node2.Description)
 
-	// Call Gemini API using HTTP
-	llmApiUrl := "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent"
-
-	payload := map[string]interface{}{
-		"systemInstruction": map[string]interface{}{
-			"parts": []map[string]string{
-				{"text": systemPrompt},
-			},
-		},
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": userPrompt},
-				},
-			},
-		},
-		"generationConfig": map[string]string{
-			"response_mime_type": "application/json",
-		},
-	}
-
-	llmReqBody, _ := json.Marshal(payload)
-	httpRequest, err := http.NewRequestWithContext(ctx, "POST", llmApiUrl, bytes.NewBuffer(llmReqBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request: " + err.Error()})
-		return
-	}
-
-	httpRequest.Header.Set("Content-Type", "application/json")
-	httpRequest.Header.Set("X-goog-api-key", geminiApiKey)
-
-	client := &http.Client{}
-	httpResponse, err := client.Do(httpRequest)
+	response, err := h.llm.Generate(ctx, llm.Request{
+		Purpose:      "synthesis",
+		SystemPrompt: template.System,
+		UserPrompt:   userPrompt,
+		JSON:         true,
+		Trace:        llm.Trace{NodeIDs: []string{node1.ID, node2.ID}, PromptVersion: template.Ref()},
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Gemini API call failed: " + err.Error(),
-			"prompt": userPrompt,
-		})
-		return
-	}
-	defer httpResponse.Body.Close()
-
-	if httpResponse.StatusCode != http.StatusOK {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  fmt.Sprintf("Gemini API returned status %d", httpResponse.StatusCode),
-			"prompt": userPrompt,
+			"error":          "LLM call failed: " + err.Error(),
+			"prompt":         userPrompt,
+			"prompt_version": template.Ref(),
 		})
 		return
 	}
 
-	// Parse the response
-	var geminiResponse map[string]interface{}
-	if err := json.NewDecoder(httpResponse.Body).Decode(&geminiResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to parse response: " + err.Error(),
-			"prompt": userPrompt,
-		})
-		return
-	}
-
-	var content string
 	var name, description string
-
-	// Extract the synthesized content
-	if candidates, ok := geminiResponse["candidates"].([]interface{}); ok && len(candidates) > 0 {
-		if candidate, ok := candidates[0].(map[string]interface{}); ok {
-			if contentObj, ok := candidate["content"].(map[string]interface{}); ok {
-				if parts, ok := contentObj["parts"].([]interface{}); ok && len(parts) > 0 {
-					if part, ok := parts[0].(map[string]interface{}); ok {
-						if text, ok := part["text"].(string); ok {
-							content = text
-
-							// Parse the JSON response
-							var synthesis map[string]string
-							if err := json.Unmarshal([]byte(text), &synthesis); err == nil {
-								name = synthesis["name"]
-								description = synthesis["description"]
-							}
-						}
-					}
-				}
-			}
-		}
+	var synthesis map[string]string
+	err = json.Unmarshal([]byte(response.Text), &synthesis)
+	h.recordParseOutcome(ctx, response, err)
+	if err == nil {
+		name = synthesis["name"]
+		description = synthesis["description"]
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -301,7 +224,8 @@ Please provide the response in this exact JSON format:
 			"type":        node2.NodeType,
 		},
 		"prompt":                  userPrompt,
-		"raw_response":            content,
+		"prompt_version":          template.Ref(),
+		"raw_response":            response.Text,
 		"synthesized_name":        name,
 		"synthesized_description": description,
 	})
@@ -314,7 +238,7 @@ func (h *Handler) DebugRelationshipConsolidationStatus(c *gin.Context) {
 	// Query all relationships with their consolidation status
 	query := `
 		MATCH (from)-[r]-(to)
-		WHERE type(r) IN ['DESCRIBES', 'CONSTITUTES']
+		WHERE type(r) IN ['DESCRIBES', 'CONSTITUTES', 'DESCRIBES_DYNAMIC']
 		RETURN type(r) as relationship_type,
 		       from.id as from_id,
 		       to.id as to_id,
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+// maxDiffCells bounds the LCS table; larger inputs fall back to a whole-text replacement
+const maxDiffCells = 4_000_000
+
+// diffLines computes a line-based diff from a to b using the longest common subsequence of lines.
+func diffLines(a, b string) []models.DiffLine {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+	n, m := len(aLines), len(bLines)
+
+	if n*m > maxDiffCells {
+		var diff []models.DiffLine
+		for _, line := range aLines {
+			diff = append(diff, models.DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range bLines {
+			diff = append(diff, models.DiffLine{Op: "insert", Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] is the LCS length of aLines[i:] and bLines[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []models.DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case aLines[i] == bLines[j]:
+			diff = append(diff, models.DiffLine{Op: "equal", Text: aLines[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, models.DiffLine{Op: "delete", Text: aLines[i]})
+			i++
+		default:
+			diff = append(diff, models.DiffLine{Op: "insert", Text: bLines[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diff = append(diff, models.DiffLine{Op: "delete", Text: aLines[i]})
+	}
+	for ; j < m; j++ {
+		diff = append(diff, models.DiffLine{Op: "insert", Text: bLines[j]})
+	}
+	return diff
+}
+
+// formatUnifiedDiff renders a diff with "+", "-" and " " line prefixes
+func formatUnifiedDiff(diff []models.DiffLine) string {
+	var sb strings.Builder
+	for _, line := range diff {
+		switch line.Op {
+		case "insert":
+			sb.WriteString("+")
+		case "delete":
+			sb.WriteString("-")
+		default:
+			sb.WriteString(" ")
+		}
+		sb.WriteString(line.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// MODEL ELEMENTS - REST CRUD FOR SYSTEMS, STOCKS AND FLOWS
+// =============================================================================
+
+const (
+	defaultElementLimit = 50
+	maxElementLimit     = 500
+)
+
+// ElementRelationship is a relationship of a System, Stock or Flow, seen from that element. Its id is the
+// Neo4j element id.
+type ElementRelationship struct {
+	ID                 string   `json:"id"`
+	Type               string   `json:"type"`
+	Direction          string   `json:"direction"` // "outgoing" or "incoming"
+	OtherID            string   `json:"otherId"`
+	OtherType          string   `json:"otherType"` // "narrative", "system", "stock" or "flow"
+	OtherName          string   `json:"otherName"`
+	Polarity           *float64 `json:"polarity,omitempty"`
+	Question           string   `json:"question,omitempty"`
+	CuriosityScore     *float64 `json:"curiosityScore,omitempty"`
+	Consolidated       bool     `json:"consolidated"`
+	ConsolidationScore int      `json:"consolidationScore"`
+}
+
+// elementReturn reads a System, Stock or Flow bound to n; the embedding itself is left out of responses
+const elementReturn = `
+	RETURN n.id as id, n.name as name, COALESCE(n.boundary_description, n.description, '') as description, n.type as stock_type,
+	       COALESCE(n.embedded, false) as embedded, COALESCE(n.consolidated, false) as consolidated,
+	       COALESCE(n.consolidation_score, 0) as consolidation_score, n.last_consolidated_at as last_consolidated_at,
+	       n.created_at as created_at`
+
+// elementFromRecord converts a record read with elementReturn into a models.System, models.Stock or models.Flow
+func elementFromRecord(nodeType string, record map[string]interface{}) interface{} {
+	embedded, _ := record["embedded"].(bool)
+	consolidated, _ := record["consolidated"].(bool)
+	score := int(getInt64Value(record, "consolidation_score"))
+	var createdAt, lastConsolidatedAt time.Time
+	if parsed, err := time.Parse(time.RFC3339, getStringValue(record, "created_at")); err == nil {
+		createdAt = parsed
+	}
+	if parsed, err := time.Parse(time.RFC3339, getStringValue(record, "last_consolidated_at")); err == nil {
+		lastConsolidatedAt = parsed
+	}
+
+	switch nodeType {
+	case "system":
+		return models.System{
+			ID:                  getStringValue(record, "id"),
+			Name:                getStringValue(record, "name"),
+			BoundaryDescription: getStringValue(record, "description"),
+			Embedded:            embedded,
+			Consolidated:        consolidated,
+			ConsolidationScore:  score,
+			LastConsolidatedAt:  lastConsolidatedAt,
+			CreatedAt:           createdAt,
+		}
+	case "stock":
+		return models.Stock{
+			ID:                 getStringValue(record, "id"),
+			Name:               getStringValue(record, "name"),
+			Description:        getStringValue(record, "description"),
+			Type:               getStringValue(record, "stock_type"),
+			Embedded:           embedded,
+			Consolidated:       consolidated,
+			ConsolidationScore: score,
+			LastConsolidatedAt: lastConsolidatedAt,
+			CreatedAt:          createdAt,
+		}
+	default:
+		return models.Flow{
+			ID:                 getStringValue(record, "id"),
+			Name:               getStringValue(record, "name"),
+			Description:        getStringValue(record, "description"),
+			Embedded:           embedded,
+			Consolidated:       consolidated,
+			ConsolidationScore: score,
+			LastConsolidatedAt: lastConsolidatedAt,
+			CreatedAt:          createdAt,
+		}
+	}
+}
+
+// getElement reads a System, Stock or Flow by id, returning nil when there is no such element
+func (h *Handler) getElement(ctx context.Context, nodeType, id string) (interface{}, error) {
+	query := fmt.Sprintf(`MATCH (n:%s {id: $id})`, nodeLabel(nodeType)) + elementReturn
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return elementFromRecord(nodeType, records[0]), nil
+}
+
+// getElementRelationships reads every relationship of the element with the given id
+func (h *Handler) getElementRelationships(ctx context.Context, id string) ([]ElementRelationship, error) {
+	query := `MATCH (n {id: $id})-[r]-(other)
+		WHERE other:Narrative OR other:System OR other:Stock OR other:Flow
+		RETURN elementId(r) as id, type(r) as type, startNode(r) = n as outgoing,
+		       other.id as other_id, [l IN labels(other) WHERE l IN ['Narrative', 'System', 'Stock', 'Flow']][0] as other_label,
+		       COALESCE(other.name, other.title) as other_name,
+		       r.polarity as polarity, r.question as question, r.curiosity_score as curiosity_score,
+		       COALESCE(r.consolidated, false) as consolidated, COALESCE(r.consolidation_score, 0) as consolidation_score
+		ORDER BY type, other_name`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read relationships: %v", err)
+	}
+
+	relationships := make([]ElementRelationship, 0, len(records))
+	for _, record := range records {
+		relationship := ElementRelationship{
+			ID:                 getStringValue(record, "id"),
+			Type:               getStringValue(record, "type"),
+			Direction:          "incoming",
+			OtherID:            getStringValue(record, "other_id"),
+			OtherType:          strings.ToLower(getStringValue(record, "other_label")),
+			OtherName:          getStringValue(record, "other_name"),
+			Question:           getStringValue(record, "question"),
+			ConsolidationScore: int(getInt64Value(record, "consolidation_score")),
+		}
+		if outgoing, _ := record["outgoing"].(bool); outgoing {
+			relationship.Direction = "outgoing"
+		}
+		relationship.Consolidated, _ = record["consolidated"].(bool)
+		if polarity, ok := record["polarity"].(float64); ok {
+			relationship.Polarity = &polarity
+		}
+		if score, ok := record["curiosity_score"].(float64); ok {
+			relationship.CuriosityScore = &score
+		}
+		relationships = append(relationships, relationship)
+	}
+	return relationships, nil
+}
+
+// embedElement embeds a System, Stock or Flow from its name and description the same way ProcessEmbeddings
+// does. On failure the element stays unembedded, so the next ProcessEmbeddings run picks it up.
+func (h *Handler) embedElement(ctx context.Context, nodeType, id, name, description string) bool {
+	text := name
+	if description != "" {
+		text += ": " + description
+	}
+	embedding, err := h.generateEmbedding(ctx, "node_embedding", text, llm.Trace{NodeIDs: []string{id}})
+	if err != nil {
+		log.Printf("Warning: Failed to embed %s %s, leaving it for ProcessEmbeddings: %v", nodeType, id, err)
+		return false
+	}
+
+	query := fmt.Sprintf(`MATCH (n:%s {id: $id}) SET n.embedding = $embedding, n.embedded = true`, nodeLabel(nodeType))
+	if _, err := h.db.ExecuteQuery(ctx, query, map[string]interface{}{"id": id, "embedding": embedding}); err != nil {
+		log.Printf("Warning: Failed to store embedding of %s %s: %v", nodeType, id, err)
+		return false
+	}
+	return true
+}
+
+func validStockType(stockType string) bool {
+	return stockType == "qualitative" || stockType == "quantitative"
+}
+
+// ListElements - Lists Systems, Stocks or Flows by name, without embeddings.
+// Query parameters: consolidated (true/false), limit (default 50) and offset.
+func (h *Handler) ListElements(nodeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var consolidated interface{}
+		if consolidatedParam := c.Query("consolidated"); consolidatedParam != "" {
+			value, err := strconv.ParseBool(consolidatedParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "consolidated must be true or false"})
+				return
+			}
+			consolidated = value
+		}
+		limit, offset, err := parsePagination(c, defaultElementLimit, maxElementLimit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		params := map[string]interface{}{"consolidated": consolidated, "limit": limit, "offset": offset}
+		filter := fmt.Sprintf(`MATCH (n:%s)
+			WHERE $consolidated IS NULL OR COALESCE(n.consolidated, false) = $consolidated`, nodeLabel(nodeType))
+
+		totalRecords, err := h.db.ExecuteRead(ctx, filter+` RETURN count(n) as total`, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count %ss: %v", nodeType, err)})
+			return
+		}
+		records, err := h.db.ExecuteRead(ctx, filter+elementReturn+`
+			ORDER BY toLower(name), id
+			SKIP $offset LIMIT $limit`, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list %ss: %v", nodeType, err)})
+			return
+		}
+
+		elements := make([]interface{}, 0, len(records))
+		for _, record := range records {
+			elements = append(elements, elementFromRecord(nodeType, record))
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			nodeType + "s": elements,
+			"total":        countFromRecords(totalRecords, "total"),
+			"limit":        limit,
+			"offset":       offset,
+		})
+	}
+}
+
+// GetElement - Reads a System, Stock or Flow by ID together with its relationships
+func (h *Handler) GetElement(nodeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		element, err := h.getElement(ctx, nodeType, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if element == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": nodeLabel(nodeType) + " not found"})
+			return
+		}
+
+		relationships, err := h.getElementRelationships(ctx, c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{nodeType: element, "relationships": relationships})
+	}
+}
+
+// CreateElement - Creates a System, Stock or Flow by hand. It starts unconsolidated but approved, so the next
+// consolidation merges it into the model, and is embedded right away.
+func (h *Handler) CreateElement(nodeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		props := map[string]interface{}{"approved": true}
+
+		var element interface{}
+		switch nodeType {
+		case "system":
+			var req models.SystemRequest
+			if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+				return
+			}
+			req.Name = strings.TrimSpace(req.Name)
+			system, err := h.createSystemInDB(ctx, req, props)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			system.Embedded = h.embedElement(ctx, nodeType, system.ID, system.Name, system.BoundaryDescription)
+			system.Embedding = nil
+			element = system
+		case "stock":
+			var req models.StockRequest
+			if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+				return
+			}
+			if !validStockType(req.Type) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type must be qualitative or quantitative"})
+				return
+			}
+			req.Name = strings.TrimSpace(req.Name)
+			stock, err := h.createStockInDB(ctx, req, props)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			stock.Embedded = h.embedElement(ctx, nodeType, stock.ID, stock.Name, stock.Description)
+			stock.Embedding = nil
+			element = stock
+		case "flow":
+			var req models.FlowRequest
+			if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+				return
+			}
+			req.Name = strings.TrimSpace(req.Name)
+			flow, err := h.createFlowInDB(ctx, req, props)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			flow.Embedded = h.embedElement(ctx, nodeType, flow.ID, flow.Name, flow.Description)
+			flow.Embedding = nil
+			element = flow
+		}
+
+		c.JSON(http.StatusCreated, element)
+	}
+}
+
+// UpdateElement - Edits a System, Stock or Flow. Changing the name or description re-embeds it.
+func (h *Handler) UpdateElement(nodeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		id := c.Param("id")
+
+		var req models.ElementUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+
+		var sets []string
+		params := map[string]interface{}{"id": id}
+		if req.Name != nil {
+			if strings.TrimSpace(*req.Name) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+				return
+			}
+			sets = append(sets, "n.name = $name")
+			params["name"] = strings.TrimSpace(*req.Name)
+		}
+		description := req.Description
+		if nodeType == "system" {
+			if req.Description != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "systems have a boundaryDescription, not a description"})
+				return
+			}
+			description = req.BoundaryDescription
+		} else if req.BoundaryDescription != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "boundaryDescription only applies to systems"})
+			return
+		}
+		if description != nil {
+			if nodeType == "system" {
+				sets = append(sets, "n.boundary_description = $description")
+			} else {
+				sets = append(sets, "n.description = $description")
+			}
+			params["description"] = *description
+		}
+		if req.Type != nil {
+			if nodeType != "stock" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type only applies to stocks"})
+				return
+			}
+			if !validStockType(*req.Type) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "type must be qualitative or quantitative"})
+				return
+			}
+			sets = append(sets, "n.type = $stock_type")
+			params["stock_type"] = *req.Type
+		}
+		if len(sets) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+			return
+		}
+		reembed := req.Name != nil || description != nil
+		if reembed {
+			// Until the new embedding is stored the element is left for ProcessEmbeddings
+			sets = append(sets, "n.embedded = false", "n.embedding = []")
+		}
+
+		query := fmt.Sprintf(`MATCH (n:%s {id: $id}) SET %s RETURN n.name as name, COALESCE(n.boundary_description, n.description, '') as description`,
+			nodeLabel(nodeType), strings.Join(sets, ", "))
+		records, err := h.db.ExecuteRead(ctx, query, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(records) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": nodeLabel(nodeType) + " not found"})
+			return
+		}
+		if reembed {
+			h.embedElement(ctx, nodeType, id, getStringValue(records[0], "name"), getStringValue(records[0], "description"))
+		}
+
+		element, err := h.getElement(ctx, nodeType, id)
+		if err != nil || element == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read updated " + nodeType})
+			return
+		}
+		c.JSON(http.StatusOK, element)
+	}
+}
+
+// DeleteElement - Deletes a System, Stock or Flow together with its relationships
+func (h *Handler) DeleteElement(nodeType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := fmt.Sprintf(`MATCH (n:%s {id: $id})
+			OPTIONAL MATCH (n)-[r]-()
+			WITH n, count(r) as relationships
+			DETACH DELETE n
+			RETURN relationships`, nodeLabel(nodeType))
+		records, err := h.db.ExecuteRead(c.Request.Context(), query, map[string]interface{}{"id": c.Param("id")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(records) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": nodeLabel(nodeType) + " not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":               nodeLabel(nodeType) + " deleted successfully",
+			"relationships_deleted": countFromRecords(records, "relationships"),
+		})
+	}
+}
@@ -5,93 +5,77 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"os"
 
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
 )
 
-const geminiEmbeddingModel = "models/text-embedding-004"
+// maxEmbeddingBatchSize is the most texts batchEmbedContents accepts in one request
+const maxEmbeddingBatchSize = 100
 
-// generateEmbedding takes a single string and returns its vector embedding using the genai client library.
-func generateEmbedding(ctx context.Context, text string) ([]float32, error) {
-	geminiApiKey := os.Getenv("GEMINI_API_KEY")
-	if geminiApiKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
-	}
-
-	// Create a new client with your API key.
-	client, err := genai.NewClient(ctx, option.WithAPIKey(geminiApiKey))
-	if err != nil {
-		log.Printf("Failed to create genai client: %v", err)
-		return nil, err
-	}
-	defer client.Close()
-
-	// Access the embedding model.
-	em := client.EmbeddingModel(geminiEmbeddingModel)
-
-	// Call the model to embed the content.
-	res, err := em.EmbedContent(ctx, genai.Text(text))
+// generateEmbedding returns the vector embedding of a single text
+func (h *Handler) generateEmbedding(ctx context.Context, purpose, text string, trace llm.Trace) ([]float32, error) {
+	embeddings, _, err := h.generateEmbeddingsInBatch(ctx, llm.EmbedRequest{Purpose: purpose, Texts: []string{text}, Trace: trace})
 	if err != nil {
-		log.Printf("Failed to generate embedding: %v", err)
 		return nil, err
 	}
-
-	// Check for a valid response and return the embedding.
-	if res.Embedding == nil || len(res.Embedding.Values) == 0 {
+	if len(embeddings[0]) == 0 {
 		return nil, fmt.Errorf("received an empty embedding from the API")
 	}
-
-	return res.Embedding.Values, nil
+	return embeddings[0], nil
 }
 
-// generateEmbeddingsInBatch takes a slice of strings and returns their vector embeddings in a single API call.
-func generateEmbeddingsInBatch(ctx context.Context, texts []string) ([][]float32, error) {
-	geminiApiKey := os.Getenv("GEMINI_API_KEY")
-	if geminiApiKey == "" {
-		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
-	}
-
-	client, err := genai.NewClient(ctx, option.WithAPIKey(geminiApiKey))
-	if err != nil {
-		log.Printf("Failed to create genai client: %v", err)
-		return nil, err
-	}
-	defer client.Close()
-
-	em := client.EmbeddingModel(geminiEmbeddingModel)
-
-	// Create a batch request from the slice of strings.
-	batch := em.NewBatch()
-	for _, text := range texts {
-		batch.AddContent(genai.Text(text))
+// generateEmbeddingsInBatch returns the vector embeddings of req.Texts in order, sending them in chunks of
+// at most maxEmbeddingBatchSize. A text that could not be embedded, even after retries, gets a nil vector and
+// failures holds why at the same index; failures is nil when every text was embedded. err is only set when
+// no text could be embedded at all.
+func (h *Handler) generateEmbeddingsInBatch(ctx context.Context, req llm.EmbedRequest) (embeddings [][]float32, failures []error, err error) {
+	if h.embedder == nil {
+		return nil, nil, fmt.Errorf("no embedding model configured")
 	}
 
-	// Call the model with the batch of content.
-	res, err := em.BatchEmbedContents(ctx, batch)
-	if err != nil {
-		log.Printf("Failed to generate batch embeddings: %v", err)
-		return nil, err
+	embeddings = make([][]float32, len(req.Texts))
+	embedded := 0
+	var firstErr error
+	fail := func(i int, err error) {
+		if failures == nil {
+			failures = make([]error, len(req.Texts))
+		}
+		failures[i] = err
+		if firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	// Check for a valid response.
-	if res == nil || res.Embeddings == nil {
-		return nil, fmt.Errorf("received a nil response from the batch embedding API")
-	}
+	for start := 0; start < len(req.Texts); start += maxEmbeddingBatchSize {
+		end := min(start+maxEmbeddingBatchSize, len(req.Texts))
+		chunkReq := req
+		chunkReq.Texts = req.Texts[start:end]
+		if req.NodeIDs != nil {
+			chunkReq.NodeIDs = req.NodeIDs[start:end]
+		}
 
-	// Extract the float slices from the response.
-	var embeddings [][]float32
-	for _, e := range res.Embeddings {
-		if e != nil && len(e.Values) > 0 {
-			embeddings = append(embeddings, e.Values)
-		} else {
-			// Add a nil or empty slice to maintain order if one text fails.
-			embeddings = append(embeddings, nil)
+		response, err := h.embedder.Embed(ctx, chunkReq)
+		if err != nil {
+			log.Printf("Warning: Failed to embed texts %d-%d of %d: %v", start+1, end, len(req.Texts), err)
+			for i := start; i < end; i++ {
+				fail(i, err)
+			}
+			continue
+		}
+		for i := start; i < end; i++ {
+			if i-start < len(response.Vectors) && len(response.Vectors[i-start]) > 0 {
+				embeddings[i] = response.Vectors[i-start]
+				embedded++
+			} else {
+				fail(i, fmt.Errorf("no embedding returned"))
+			}
 		}
 	}
 
-	return embeddings, nil
+	if embedded == 0 && len(req.Texts) > 0 {
+		return nil, nil, firstErr
+	}
+	return embeddings, failures, nil
 }
 
 // cosineSimilarity calculates the similarity between two vectors, returning a score between -1 and 1.
@@ -124,17 +108,34 @@ type NodeForEmbedding struct {
 	Text        string // Combined text for embedding
 }
 
-// processNodeEmbeddingsInBatch fetches all unconsolidated nodes, generates embeddings, and updates them
-func (h *Handler) processNodeEmbeddingsInBatch(ctx context.Context) error {
+// EmbeddingReport tallies what processNodeEmbeddingsInBatch embedded
+type EmbeddingReport struct {
+	Nodes    int                `json:"nodes"`
+	Embedded int                `json:"embedded"`
+	Failures []EmbeddingFailure `json:"failures,omitempty"`
+}
+
+// EmbeddingFailure is a node left without an embedding; it is retried the next time embeddings are processed
+type EmbeddingFailure struct {
+	NodeID   string `json:"node_id"`
+	NodeType string `json:"node_type"`
+	Name     string `json:"name"`
+	Error    string `json:"error"`
+}
+
+// processNodeEmbeddingsInBatch fetches all unconsolidated nodes, generates embeddings, and updates them.
+// Nodes that fail are listed in the report; an error is only returned when nothing could be embedded.
+func (h *Handler) processNodeEmbeddingsInBatch(ctx context.Context) (*EmbeddingReport, error) {
 	// Step 1: Fetch all unconsolidated nodes
 	nodes, err := h.fetchUnconsolidatedNodes(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to fetch unconsolidated nodes: %v", err)
+		return nil, fmt.Errorf("failed to fetch unconsolidated nodes: %v", err)
 	}
 
+	report := &EmbeddingReport{Nodes: len(nodes)}
 	if len(nodes) == 0 {
 		log.Println("No unconsolidated nodes found - all embeddings are up to date")
-		return nil
+		return report, nil
 	}
 
 	log.Printf("Found %d unconsolidated nodes to process", len(nodes))
@@ -146,13 +147,31 @@ func (h *Handler) processNodeEmbeddingsInBatch(ctx context.Context) error {
 	}
 
 	// Step 3: Generate embeddings in batch
-	embeddings, err := generateEmbeddingsInBatch(ctx, texts)
+	nodeIDs := make([]string, len(nodes))
+	for i, node := range nodes {
+		nodeIDs[i] = node.ID
+	}
+	embeddings, failures, err := h.generateEmbeddingsInBatch(ctx, llm.EmbedRequest{
+		Purpose: "node_embedding",
+		Texts:   texts,
+		Trace:   llm.Trace{NodeIDs: nodeIDs},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to generate embeddings: %v", err)
+		return nil, fmt.Errorf("failed to generate embeddings: %v", err)
+	}
+	for i, failure := range failures {
+		if failure != nil {
+			report.addFailure(nodes[i], failure)
+		}
 	}
 
 	// Step 4: Update nodes with embeddings and mark as consolidated
-	return h.updateNodesWithEmbeddings(ctx, nodes, embeddings)
+	h.updateNodesWithEmbeddings(ctx, nodes, embeddings, report)
+	return report, nil
+}
+
+func (r *EmbeddingReport) addFailure(node NodeForEmbedding, err error) {
+	r.Failures = append(r.Failures, EmbeddingFailure{NodeID: node.ID, NodeType: node.NodeType, Name: node.Name, Error: err.Error()})
 }
 
 // fetchUnconsolidatedNodes retrieves all nodes that don't have embeddings yet
@@ -246,12 +265,9 @@ func (h *Handler) fetchUnconsolidatedNodes(ctx context.Context) ([]NodeForEmbedd
 	return nodes, nil
 }
 
-// updateNodesWithEmbeddings updates nodes in the database with their embeddings and marks them as consolidated
-func (h *Handler) updateNodesWithEmbeddings(ctx context.Context, nodes []NodeForEmbedding, embeddings [][]float32) error {
-	if len(nodes) != len(embeddings) {
-		return fmt.Errorf("mismatch between nodes count (%d) and embeddings count (%d)", len(nodes), len(embeddings))
-	}
-
+// updateNodesWithEmbeddings updates nodes in the database with their embeddings and marks them as embedded,
+// counting them in report. Nodes without an embedding are skipped; nodes that fail to update are reported.
+func (h *Handler) updateNodesWithEmbeddings(ctx context.Context, nodes []NodeForEmbedding, embeddings [][]float32, report *EmbeddingReport) {
 	for i, node := range nodes {
 		if embeddings[i] == nil {
 			log.Printf("Warning: No embedding generated for %s node '%s', skipping", node.NodeType, node.Name)
@@ -282,11 +298,11 @@ func (h *Handler) updateNodesWithEmbeddings(ctx context.Context, nodes []NodeFor
 		_, err := h.db.ExecuteQuery(ctx, query, params)
 		if err != nil {
 			log.Printf("Error updating %s node '%s' with embedding: %v", node.NodeType, node.Name, err)
+			report.addFailure(node, fmt.Errorf("failed to store embedding: %v", err))
 			continue
 		}
 
+		report.Embedded++
 		log.Printf("Successfully updated %s node '%s' with embedding", node.NodeType, node.Name)
 	}
-
-	return nil
 }
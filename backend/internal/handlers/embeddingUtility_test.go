@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+)
+
+// batchEmbedder embeds each text as a one-element vector holding its index, records the size of every
+// batch, and leaves out the texts and batches the test tells it to fail
+type batchEmbedder struct {
+	batches       []int
+	failText      int // Index of a text that gets no vector, or -1
+	failBatch     int // Index of a batch that fails as a whole, or -1
+	nodeIDBatches [][]string
+}
+
+func (e *batchEmbedder) Embed(ctx context.Context, req llm.EmbedRequest) (*llm.EmbedResponse, error) {
+	batch := len(e.batches)
+	offset := 0
+	for _, size := range e.batches {
+		offset += size
+	}
+	e.batches = append(e.batches, len(req.Texts))
+	e.nodeIDBatches = append(e.nodeIDBatches, req.NodeIDs)
+	if batch == e.failBatch {
+		return nil, &llm.Error{Message: "batch failed"}
+	}
+	vectors := make([][]float32, len(req.Texts))
+	for i := range req.Texts {
+		if offset+i != e.failText {
+			vectors[i] = []float32{float32(offset + i)}
+		}
+	}
+	return &llm.EmbedResponse{Vectors: vectors, Model: e.Model()}, nil
+}
+
+func (e *batchEmbedder) Model() string { return "models/test-embedding" }
+
+func TestGenerateEmbeddingsInBatch(t *testing.T) {
+	texts := make([]string, 250)
+	nodeIDs := make([]string, len(texts))
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text %d", i)
+		nodeIDs[i] = fmt.Sprintf("node_%d", i)
+	}
+
+	tests := []struct {
+		name       string
+		failText   int
+		failBatch  int
+		wantFailed []int
+	}{
+		{"all embedded", -1, -1, nil},
+		{"one text without a vector", 142, -1, []int{142}},
+		{"failed batch", -1, 1, rangeOf(100, 200)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder := &batchEmbedder{failText: tt.failText, failBatch: tt.failBatch}
+			h := &Handler{embedder: embedder}
+			embeddings, failures, err := h.generateEmbeddingsInBatch(context.Background(), llm.EmbedRequest{Purpose: "test", Texts: texts, Trace: llm.Trace{NodeIDs: nodeIDs}})
+			if err != nil {
+				t.Fatalf("generateEmbeddingsInBatch() error = %v", err)
+			}
+			if !slices.Equal(embedder.batches, []int{100, 100, 50}) {
+				t.Errorf("batch sizes = %v, want [100 100 50]", embedder.batches)
+			}
+			for b, ids := range embedder.nodeIDBatches {
+				if ids[0] != nodeIDs[b*maxEmbeddingBatchSize] {
+					t.Errorf("batch %d starts with node %s, want %s", b, ids[0], nodeIDs[b*maxEmbeddingBatchSize])
+				}
+			}
+			if len(embeddings) != len(texts) {
+				t.Fatalf("len(embeddings) = %d, want %d", len(embeddings), len(texts))
+			}
+
+			if tt.wantFailed == nil {
+				if failures != nil {
+					t.Errorf("failures = %v, want nil", failures)
+				}
+			} else if len(failures) != len(texts) {
+				t.Fatalf("len(failures) = %d, want %d", len(failures), len(texts))
+			}
+			for i := range texts {
+				failed := slices.Contains(tt.wantFailed, i)
+				switch {
+				case failed && (embeddings[i] != nil || failures[i] == nil):
+					t.Errorf("text %d: embedding %v, failure %v, want a failure and no embedding", i, embeddings[i], failures[i])
+				case !failed && (len(embeddings[i]) != 1 || embeddings[i][0] != float32(i)):
+					t.Errorf("text %d: embedding %v, want [%d]", i, embeddings[i], i)
+				case !failed && failures != nil && failures[i] != nil:
+					t.Errorf("text %d: failure %v, want none", i, failures[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateEmbeddingsInBatchFailsWhenNothingEmbedded(t *testing.T) {
+	h := &Handler{embedder: &batchEmbedder{failText: 0, failBatch: -1}}
+	embeddings, failures, err := h.generateEmbeddingsInBatch(context.Background(), llm.EmbedRequest{Purpose: "test", Texts: []string{"only"}})
+	if err == nil || embeddings != nil || failures != nil {
+		t.Errorf("generateEmbeddingsInBatch() = %v, %v, %v, want only an error", embeddings, failures, err)
+	}
+
+	h = &Handler{embedder: &batchEmbedder{failText: -1, failBatch: 0}}
+	_, _, err = h.generateEmbeddingsInBatch(context.Background(), llm.EmbedRequest{Purpose: "test", Texts: []string{"only"}})
+	var llmErr *llm.Error
+	if !errors.As(err, &llmErr) || llmErr.Message != "batch failed" {
+		t.Errorf("generateEmbeddingsInBatch() error = %v, want the batch failure", err)
+	}
+}
+
+// rangeOf returns the integers from start up to but not including end
+func rangeOf(start, end int) []int {
+	var values []int
+	for i := start; i < end; i++ {
+		values = append(values, i)
+	}
+	return values
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultExtractionRunLimit = 20
+	maxExtractionRunLimit     = 200
+)
+
+// Extraction run statuses
+const (
+	RunStatusRunning   = "running"
+	RunStatusFailed    = "failed"
+	RunStatusExtracted = "extracted" // Every stage succeeded; the plan has not been written to the graph
+	RunStatusApplied   = "applied"
+)
+
+// Extraction stage statuses
+const (
+	StageStatusPending   = "pending"
+	StageStatusSucceeded = "succeeded"
+	StageStatusFailed    = "failed"
+)
+
+// =============================================================================
+// EXTRACTION RUNS - STAGED EXTRACTIONS WITH INSPECTABLE, RE-RUNNABLE STAGES
+// =============================================================================
+
+// ExtractionRun is one staged extraction of a narrative, stored as an ExtractionRun node with one
+// ExtractionStage node per stage
+type ExtractionRun struct {
+	ID          string             `json:"id"`
+	NarrativeID string             `json:"narrativeId"`
+	Status      string             `json:"status"`
+	Error       string             `json:"error,omitempty"`
+	ChunkCount  int                `json:"chunkCount"`
+	Grounding   []GroundingConcept `json:"grounding"` // Existing concepts offered to every stage, kept so reruns see the same ones
+	CreatedAt   string             `json:"createdAt"`
+	UpdatedAt   string             `json:"updatedAt"`
+	Stages      []ExtractionStage  `json:"stages"`
+}
+
+// ExtractionStage is the persisted outcome of one stage of a run
+type ExtractionStage struct {
+	Number        int                `json:"number"`
+	Name          string             `json:"name"`
+	Status        string             `json:"status"`
+	PromptVersion string             `json:"promptVersion,omitempty"`
+	Actions       []models.LLMAction `json:"actions,omitempty"`  // Validated actions, passed on to later stages
+	Rejected      []RejectedAction   `json:"rejected,omitempty"` // Actions that failed validation
+	Error         string             `json:"error,omitempty"`
+	Attempts      int                `json:"attempts"`
+	StartedAt     string             `json:"startedAt,omitempty"`
+	FinishedAt    string             `json:"finishedAt,omitempty"`
+}
+
+// RejectedAction is an extracted action a stage dropped during validation
+type RejectedAction struct {
+	Action models.LLMAction `json:"action"`
+	Reason string           `json:"reason"`
+}
+
+// extractedPlan concatenates the validated actions of every stage into the run's plan. Its prompt version
+// lists the stage prompts; each action also carries the prompt of its own stage.
+func (run *ExtractionRun) extractedPlan() *ExtractedPlan {
+	extracted := &ExtractedPlan{Grounding: run.Grounding, ChunkCount: run.ChunkCount, ExtractionRunID: run.ID}
+	versions := make([]string, 0, len(run.Stages))
+	for _, stage := range run.Stages {
+		extracted.Plan.Actions = append(extracted.Plan.Actions, stage.Actions...)
+		if stage.PromptVersion != "" {
+			versions = append(versions, stage.PromptVersion)
+		}
+	}
+	extracted.PromptVersion = strings.Join(versions, ",")
+	return extracted
+}
+
+// startExtractionRun records a new run of the narrative with every stage pending
+func (h *Handler) startExtractionRun(ctx context.Context, narrative *models.Narrative, grounding []GroundingConcept) (*ExtractionRun, error) {
+	now := time.Now().Format(time.RFC3339)
+	run := &ExtractionRun{
+		ID:          uuid.New().String(),
+		NarrativeID: narrative.ID,
+		Status:      RunStatusRunning,
+		ChunkCount:  len(chunkNarrative(narrative.Content, analysisChunkMaxChars, analysisChunkOverlapChars)),
+		Grounding:   grounding,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for i, spec := range extractionStages {
+		run.Stages = append(run.Stages, ExtractionStage{Number: i + 1, Name: spec.Name, Status: StageStatusPending})
+	}
+
+	groundingJSON, _ := json.Marshal(grounding)
+	query := `MATCH (n:Narrative {id: $narrative_id})
+		CREATE (n)-[:HAS_EXTRACTION_RUN]->(r:ExtractionRun {
+			id: $id, narrative_id: $narrative_id, status: $status, chunk_count: $chunk_count,
+			grounding: $grounding, created_at: $created_at, updated_at: $created_at
+		})
+		WITH r
+		UNWIND $stages as stage
+		CREATE (r)-[:HAS_STAGE]->(:ExtractionStage {run_id: r.id, number: stage.number, name: stage.name, status: stage.status, attempts: 0})
+		RETURN r.id as id`
+	stages := make([]map[string]interface{}, len(run.Stages))
+	for i, stage := range run.Stages {
+		stages[i] = map[string]interface{}{"number": stage.Number, "name": stage.Name, "status": stage.Status}
+	}
+	params := map[string]interface{}{
+		"id":           run.ID,
+		"narrative_id": narrative.ID,
+		"status":       run.Status,
+		"chunk_count":  run.ChunkCount,
+		"grounding":    string(groundingJSON),
+		"created_at":   now,
+		"stages":       stages,
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create extraction run: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("failed to create extraction run: narrative %s not found", narrative.ID)
+	}
+	return run, nil
+}
+
+// saveExtractionRun writes the status of a run and of all its stages
+func (h *Handler) saveExtractionRun(ctx context.Context, run *ExtractionRun) error {
+	run.UpdatedAt = time.Now().Format(time.RFC3339)
+	stages := make([]map[string]interface{}, len(run.Stages))
+	for i, stage := range run.Stages {
+		actionsJSON, _ := json.Marshal(stage.Actions)
+		rejectedJSON, _ := json.Marshal(stage.Rejected)
+		stages[i] = map[string]interface{}{
+			"number":         stage.Number,
+			"status":         stage.Status,
+			"prompt_version": nilIfEmpty(stage.PromptVersion),
+			"actions":        string(actionsJSON),
+			"rejected":       string(rejectedJSON),
+			"error":          nilIfEmpty(stage.Error),
+			"attempts":       stage.Attempts,
+			"started_at":     nilIfEmpty(stage.StartedAt),
+			"finished_at":    nilIfEmpty(stage.FinishedAt),
+		}
+	}
+
+	query := `MATCH (r:ExtractionRun {id: $id})
+		SET r.status = $status, r.error = $error, r.updated_at = $updated_at
+		WITH r
+		UNWIND $stages as stage
+		MATCH (r)-[:HAS_STAGE]->(s:ExtractionStage {number: stage.number})
+		SET s.status = stage.status, s.prompt_version = stage.prompt_version, s.actions = stage.actions,
+			s.rejected = stage.rejected, s.error = stage.error, s.attempts = stage.attempts,
+			s.started_at = stage.started_at, s.finished_at = stage.finished_at`
+	params := map[string]interface{}{
+		"id":         run.ID,
+		"status":     run.Status,
+		"error":      nilIfEmpty(run.Error),
+		"updated_at": run.UpdatedAt,
+		"stages":     stages,
+	}
+	// Written even when the request is cancelled, so an interrupted run still records how far it got
+	if _, err := h.db.ExecuteQuery(context.WithoutCancel(ctx), query, params); err != nil {
+		return fmt.Errorf("failed to save extraction run %s: %v", run.ID, err)
+	}
+	return nil
+}
+
+// getExtractionRun reads a run with its stages. It returns nil when there is no such run.
+func (h *Handler) getExtractionRun(ctx context.Context, id string) (*ExtractionRun, error) {
+	query := `MATCH (r:ExtractionRun {id: $id})
+		OPTIONAL MATCH (r)-[:HAS_STAGE]->(s:ExtractionStage)
+		WITH r, s ORDER BY s.number
+		RETURN r.id as id, r.narrative_id as narrative_id, r.status as status, r.error as error,
+		       r.chunk_count as chunk_count, r.grounding as grounding, r.created_at as created_at, r.updated_at as updated_at,
+		       collect(s {.number, .name, .status, .prompt_version, .actions, .rejected, .error, .attempts, .started_at, .finished_at}) as stages`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	record := records[0]
+	run := extractionRunFromRecord(record)
+	json.Unmarshal([]byte(getStringValue(record, "grounding")), &run.Grounding)
+	stages, _ := record["stages"].([]interface{})
+	for _, item := range stages {
+		stageMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		stage := ExtractionStage{
+			Number:        int(getInt64Value(stageMap, "number")),
+			Name:          getStringValue(stageMap, "name"),
+			Status:        getStringValue(stageMap, "status"),
+			PromptVersion: getStringValue(stageMap, "prompt_version"),
+			Error:         getStringValue(stageMap, "error"),
+			Attempts:      int(getInt64Value(stageMap, "attempts")),
+			StartedAt:     getStringValue(stageMap, "started_at"),
+			FinishedAt:    getStringValue(stageMap, "finished_at"),
+		}
+		json.Unmarshal([]byte(getStringValue(stageMap, "actions")), &stage.Actions)
+		json.Unmarshal([]byte(getStringValue(stageMap, "rejected")), &stage.Rejected)
+		run.Stages = append(run.Stages, stage)
+	}
+	return run, nil
+}
+
+func extractionRunFromRecord(record map[string]interface{}) *ExtractionRun {
+	return &ExtractionRun{
+		ID:          getStringValue(record, "id"),
+		NarrativeID: getStringValue(record, "narrative_id"),
+		Status:      getStringValue(record, "status"),
+		Error:       getStringValue(record, "error"),
+		ChunkCount:  int(getInt64Value(record, "chunk_count")),
+		CreatedAt:   getStringValue(record, "created_at"),
+		UpdatedAt:   getStringValue(record, "updated_at"),
+	}
+}
+
+// markExtractionRunApplied records that a run's plan has been written to the graph
+func (h *Handler) markExtractionRunApplied(ctx context.Context, id string) {
+	query := `MATCH (r:ExtractionRun {id: $id}) SET r.status = $status, r.updated_at = $updated_at`
+	params := map[string]interface{}{"id": id, "status": RunStatusApplied, "updated_at": time.Now().Format(time.RFC3339)}
+	if _, err := h.db.ExecuteQuery(context.WithoutCancel(ctx), query, params); err != nil {
+		log.Printf("Warning: Failed to mark extraction run %s as applied: %v", id, err)
+	}
+}
+
+// ListExtractionRuns - Lists staged extraction runs, newest first, with the status of each stage.
+// Query parameters: narrative_id, status, limit (default 20) and offset.
+func (h *Handler) ListExtractionRuns(c *gin.Context) {
+	limit, offset, err := parsePagination(c, defaultExtractionRunLimit, maxExtractionRunLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `MATCH (r:ExtractionRun)
+		WHERE ($narrative_id IS NULL OR r.narrative_id = $narrative_id)
+		  AND ($status IS NULL OR r.status = $status)
+		WITH r ORDER BY r.created_at DESC SKIP $offset LIMIT $limit
+		OPTIONAL MATCH (r)-[:HAS_STAGE]->(s:ExtractionStage)
+		WITH r, s ORDER BY s.number
+		RETURN r.id as id, r.narrative_id as narrative_id, r.status as status, r.error as error,
+		       r.chunk_count as chunk_count, r.created_at as created_at, r.updated_at as updated_at,
+		       collect(s {.number, .name, .status, .attempts}) as stages
+		ORDER BY created_at DESC`
+	params := map[string]interface{}{
+		"narrative_id": nilIfEmpty(c.Query("narrative_id")),
+		"status":       nilIfEmpty(c.Query("status")),
+		"limit":        limit,
+		"offset":       offset,
+	}
+	records, err := h.db.ExecuteRead(c.Request.Context(), query, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list extraction runs: " + err.Error()})
+		return
+	}
+
+	runs := make([]*ExtractionRun, 0, len(records))
+	for _, record := range records {
+		run := extractionRunFromRecord(record)
+		stages, _ := record["stages"].([]interface{})
+		for _, item := range stages {
+			if stageMap, ok := item.(map[string]interface{}); ok {
+				run.Stages = append(run.Stages, ExtractionStage{
+					Number:   int(getInt64Value(stageMap, "number")),
+					Name:     getStringValue(stageMap, "name"),
+					Status:   getStringValue(stageMap, "status"),
+					Attempts: int(getInt64Value(stageMap, "attempts")),
+				})
+			}
+		}
+		runs = append(runs, run)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs, "limit": limit, "offset": offset})
+}
+
+// GetExtractionRun - Reads a run with the grounding it used and, per stage, the validated and rejected actions
+func (h *Handler) GetExtractionRun(c *gin.Context) {
+	run, err := h.getExtractionRun(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Extraction run not found"})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// RerunExtractionStage - Reruns one stage of an extraction run (by number or name) and every stage after it.
+// Once all stages have succeeded the run's plan is written to the graph. Applied runs cannot be rerun.
+func (h *Handler) RerunExtractionStage(c *gin.Context) {
+	var req models.RerunExtractionStageRequest
+	// An empty body is allowed and reruns with the default critic
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+			return
+		}
+	}
+	critic, err := resolveCriticMode(req.Critic)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stageNumber, ok := parseExtractionStage(c.Param("stage"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("stage must be 1-%d or a stage name", len(extractionStages))})
+		return
+	}
+
+	ctx := c.Request.Context()
+	run, err := h.getExtractionRun(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Extraction run not found"})
+		return
+	}
+	if run.Status == RunStatusApplied {
+		c.JSON(http.StatusConflict, gin.H{"error": "Extraction run has already been applied to the graph; analyze the narrative again instead"})
+		return
+	}
+	if len(run.Stages) != len(extractionStages) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Extraction run has %d stages, expected %d", len(run.Stages), len(extractionStages))})
+		return
+	}
+	for _, stage := range run.Stages[:stageNumber-1] {
+		if stage.Status != StageStatusSucceeded {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Stage %d (%s) has not succeeded; rerun it first", stage.Number, stage.Name)})
+			return
+		}
+	}
+
+	narrative, err := h.getNarrativeByIDFromDB(ctx, run.NarrativeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Narrative with ID '%s' not found", run.NarrativeID)})
+		return
+	}
+
+	if err := h.runExtractionStages(ctx, narrative, run, stageNumber); err != nil {
+		status := http.StatusInternalServerError
+		if llmErr, ok := err.(*llm.Error); ok {
+			status = llmErr.Status
+		}
+		c.JSON(status, gin.H{"error": err.Error(), "run": run})
+		return
+	}
+
+	extracted := run.extractedPlan()
+	h.critiqueExtractedPlan(ctx, narrative, extracted, critic)
+	result := h.applyAnalysisPlan(ctx, narrative, extracted)
+	run.Status = RunStatusApplied
+	response := analysisResponse("Extraction run completed and applied", result)
+	response["narrativeId"] = narrative.ID
+	response["run"] = run
+	c.JSON(http.StatusOK, response)
+}
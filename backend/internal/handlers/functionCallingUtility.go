@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
+)
+
+// Extraction modes: the model writes a JSON action plan, calls the graph-building operations as functions, or
+// builds the plan over the persisted stages of an extraction run
+const (
+	ExtractionModeJSON      = "json"
+	ExtractionModeFunctions = "functions"
+	ExtractionModeStaged    = "staged"
+)
+
+// resolveExtractionMode returns the requested extraction mode, or EXTRACTION_MODE (default "json") when none
+// was requested
+func resolveExtractionMode(requested string) (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(requested))
+	if mode == "" {
+		mode = strings.ToLower(os.Getenv("EXTRACTION_MODE"))
+	}
+	switch mode {
+	case "", ExtractionModeJSON:
+		return ExtractionModeJSON, nil
+	case ExtractionModeFunctions, ExtractionModeStaged:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown extraction mode %q: use json, functions or staged", mode)
+	}
+}
+
+// extractionPromptName returns the prompt template used by an extraction mode
+func extractionPromptName(mode string) string {
+	if mode == ExtractionModeFunctions {
+		return prompts.ExtractionFunctions
+	}
+	return prompts.Extraction
+}
+
+// extractionTools declares the graph-building operations of the extraction prompt as functions with typed
+// parameters. Their names and parameter names match the actions executeLLMPlan runs.
+var extractionTools = []llm.Tool{
+	functionTool("LinkExistingNode", "Reuse a System, Stock or Flow from the Existing Concepts list instead of creating a new node.",
+		enumParam("type", "Type of the existing node.", "System", "Stock", "Flow"),
+		stringParam("id", "Id of the node, exactly as given in the Existing Concepts list."),
+		stringParam("name", "Name used to refer to the node in relationships.")),
+	functionTool("CreateSystemNode", "Create a System: a container for the dynamics the narrative describes.",
+		stringParam("name", "Objective, formal and timeless name."),
+		stringParam("boundaryDescription", "The system's boundary and objective function, under 15 words.")),
+	functionTool("CreateStockNode", "Create a Stock: an accumulation or quality that describes the state of a system.",
+		stringParam("name", "Objective, formal and timeless name."),
+		stringParam("description", "The stock's objective function, under 15 words."),
+		enumParam("type", "Whether the stock is measured in quantities or qualities.", "qualitative", "quantitative")),
+	functionTool("CreateFlowNode", "Create a Flow: a process or activity that changes stocks.",
+		stringParam("name", "Objective, formal and timeless name."),
+		stringParam("description", "The flow's objective function, under 15 words.")),
+	functionTool("CreateDescribesRelationship", "Link the narrative to a top-level system it describes.",
+		stringParam("narrativeName", "Title of the narrative."),
+		stringParam("systemName", "Name of the system.")),
+	functionTool("CreateConstitutesRelationship", "Nest a subsystem inside a larger system.",
+		stringParam("subsystemName", "Name of the subsystem."),
+		stringParam("systemName", "Name of the containing system.")),
+	functionTool("CreateDescribesStaticRelationship", "Link a stock to the system whose state it describes.",
+		stringParam("stockName", "Name of the stock."),
+		stringParam("systemName", "Name of the system.")),
+	functionTool("CreateDescribesDynamicRelationship", "Link a flow to the system whose dynamics it describes.",
+		stringParam("flowName", "Name of the flow."),
+		stringParam("systemName", "Name of the system.")),
+	functionTool("CreateChangesRelationship", "Record that a flow directly changes a stock.",
+		stringParam("flowName", "Name of the flow."),
+		stringParam("stockName", "Name of the stock."),
+		numberParam("polarity", "+1.0 when the flow increases the stock, -1.0 when it decreases it.")),
+	functionTool("CreateCausalLinkRelationship", "Record a hypothesized or uncertain connection between two stocks or flows.",
+		enumParam("fromType", "Type of the cause.", "Stock", "Flow"),
+		stringParam("fromName", "Name of the cause."),
+		enumParam("toType", "Type of the effect.", "Stock", "Flow"),
+		stringParam("toName", "Name of the effect."),
+		stringParam("curiosity", "The author's curiosity, framed as a formal research question."),
+		numberParam("curiosityScore", "1.0 for a direct question, 0.5 for uncertainty, 0.1 for an assertion without mechanism.")),
+}
+
+// toolParam is one named parameter of a function declaration
+type toolParam struct {
+	name   string
+	schema map[string]interface{}
+}
+
+func stringParam(name, description string) toolParam {
+	return toolParam{name: name, schema: map[string]interface{}{"type": "string", "description": description}}
+}
+
+func numberParam(name, description string) toolParam {
+	return toolParam{name: name, schema: map[string]interface{}{"type": "number", "description": description}}
+}
+
+func enumParam(name, description string, values ...string) toolParam {
+	return toolParam{name: name, schema: map[string]interface{}{"type": "string", "description": description, "enum": values}}
+}
+
+// functionTool declares a function whose parameters are all required
+func functionTool(name, description string, params ...toolParam) llm.Tool {
+	properties := make(map[string]interface{}, len(params))
+	required := make([]string, len(params))
+	for i, param := range params {
+		properties[param.name] = param.schema
+		required[i] = param.name
+	}
+	return llm.Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  map[string]interface{}{"type": "object", "properties": properties, "required": required},
+	}
+}
+
+// planFromToolCalls turns the model's function calls into an action plan. Calls to undeclared functions are
+// logged and skipped.
+func planFromToolCalls(toolCalls []llm.ToolCall) (models.LLMResponse, error) {
+	declared := make(map[string]bool, len(extractionTools))
+	for _, tool := range extractionTools {
+		declared[tool.Name] = true
+	}
+
+	var plan models.LLMResponse
+	for _, call := range toolCalls {
+		if !declared[call.Name] {
+			log.Printf("Warning: Skipping call to undeclared extraction function %s", call.Name)
+			continue
+		}
+		plan.Actions = append(plan.Actions, models.LLMAction{FunctionName: call.Name, Parameters: call.Arguments})
+	}
+	if len(plan.Actions) == 0 {
+		return plan, fmt.Errorf("model returned no extraction function calls")
+	}
+	return plan, nil
+}
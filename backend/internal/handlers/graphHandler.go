@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// GRAPH VIEWS - SUBGRAPHS IN A CYTOSCAPE.JS / D3 FRIENDLY SHAPE
+// =============================================================================
+
+const (
+	defaultNeighborhoodDepth = 1
+	maxNeighborhoodDepth     = 3
+	defaultGraphNodeLimit    = 100
+	maxGraphNodeLimit        = 500
+)
+
+// graphNodeCondition restricts a node variable (%[1]s) to the labels graph views include
+const graphNodeCondition = `(%[1]s:Narrative OR %[1]s:System OR %[1]s:Stock OR %[1]s:Flow)`
+
+// GraphElements is a subgraph in the shape Cytoscape.js takes as its elements option; for D3, nodes and edges
+// map directly onto nodes and links
+type GraphElements struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	Data GraphNodeData `json:"data"`
+}
+
+type GraphNodeData struct {
+	ID         string                 `json:"id"`
+	Label      string                 `json:"label"`    // Name, or title for narratives
+	NodeType   string                 `json:"nodeType"` // "narrative", "system", "stock" or "flow"
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type GraphEdge struct {
+	Data GraphEdgeData `json:"data"`
+}
+
+type GraphEdgeData struct {
+	ID         string                 `json:"id"` // Neo4j element id
+	Source     string                 `json:"source"`
+	Target     string                 `json:"target"`
+	Label      string                 `json:"label"` // Relationship type
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// parseRelationshipTypes reads a comma-separated list of relationship types, defaulting to every type
+// extraction creates
+func parseRelationshipTypes(param string) ([]string, error) {
+	if param == "" {
+		return stagedRelationshipTypes, nil
+	}
+	var types []string
+	for _, relType := range strings.Split(param, ",") {
+		relType = strings.ToUpper(strings.TrimSpace(relType))
+		if !slices.Contains(stagedRelationshipTypes, relType) {
+			return nil, fmt.Errorf("unknown relationship type %q; expected %s", relType, strings.Join(stagedRelationshipTypes, ", "))
+		}
+		types = append(types, relType)
+	}
+	return types, nil
+}
+
+// graphProperties copies node or relationship properties for a response, leaving out embeddings
+func graphProperties(record map[string]interface{}) map[string]interface{} {
+	properties, _ := record["properties"].(map[string]interface{})
+	copied := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		if key != "embedding" {
+			copied[key] = value
+		}
+	}
+	return copied
+}
+
+// graphEdgeFilter narrows the relationships fetchGraphElements returns
+type graphEdgeFilter struct {
+	Consolidated interface{} // nil for any relationship, or true/false for that consolidation status
+	NarrativeID  string      // Only relationships extracted from or supported by this narrative, if set
+}
+
+// fetchGraphElements reads the nodes with the given ids and the relationships of the given types among them
+// that pass filter
+func (h *Handler) fetchGraphElements(ctx context.Context, ids, types []string, filter graphEdgeFilter) (*GraphElements, error) {
+	elements := &GraphElements{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	if len(ids) == 0 {
+		return elements, nil
+	}
+	params := map[string]interface{}{
+		"ids":          ids,
+		"types":        types,
+		"consolidated": filter.Consolidated,
+		"narrative_id": nilIfEmpty(filter.NarrativeID),
+	}
+
+	nodeQuery := `MATCH (n) WHERE n.id IN $ids AND ` + fmt.Sprintf(graphNodeCondition, "n") + `
+		RETURN n.id as id, [l IN labels(n) WHERE l IN ['Narrative', 'System', 'Stock', 'Flow']][0] as label,
+		       COALESCE(n.name, n.title, n.id) as name, properties(n) as properties
+		ORDER BY id`
+	nodeRecords, err := h.db.ExecuteRead(ctx, nodeQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph nodes: %v", err)
+	}
+	for _, record := range nodeRecords {
+		elements.Nodes = append(elements.Nodes, GraphNode{Data: GraphNodeData{
+			ID:         getStringValue(record, "id"),
+			Label:      getStringValue(record, "name"),
+			NodeType:   strings.ToLower(getStringValue(record, "label")),
+			Properties: graphProperties(record),
+		}})
+	}
+
+	edgeQuery := `MATCH (a)-[r]->(b)
+		WHERE a.id IN $ids AND b.id IN $ids AND type(r) IN $types
+		  AND ($consolidated IS NULL OR COALESCE(r.consolidated, false) = $consolidated)
+		  AND ($narrative_id IS NULL OR r.narrative_id = $narrative_id OR $narrative_id IN COALESCE(r.source_narratives, []))
+		RETURN elementId(r) as id, type(r) as type, a.id as source, b.id as target, properties(r) as properties
+		ORDER BY type, source, target`
+	edgeRecords, err := h.db.ExecuteRead(ctx, edgeQuery, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graph edges: %v", err)
+	}
+	for _, record := range edgeRecords {
+		elements.Edges = append(elements.Edges, GraphEdge{Data: GraphEdgeData{
+			ID:         getStringValue(record, "id"),
+			Source:     getStringValue(record, "source"),
+			Target:     getStringValue(record, "target"),
+			Label:      getStringValue(record, "type"),
+			Properties: graphProperties(record),
+		}})
+	}
+
+	return elements, nil
+}
+
+// GetGraphNeighborhood - Returns the subgraph within depth hops of a node, for visualization.
+// Query parameters: id (required), depth (default 1, at most 3), types (comma-separated relationship types),
+// consolidated (true keeps only consolidated nodes and relationships) and limit (most nodes, default 100).
+// truncated is set when the node limit cut the neighborhood short.
+func (h *Handler) GetGraphNeighborhood(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	id := c.Query("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id query parameter is required"})
+		return
+	}
+	depth := defaultNeighborhoodDepth
+	if depthParam := c.Query("depth"); depthParam != "" {
+		value, err := strconv.Atoi(depthParam)
+		if err != nil || value < 0 || value > maxNeighborhoodDepth {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("depth must be between 0 and %d", maxNeighborhoodDepth)})
+			return
+		}
+		depth = value
+	}
+	types, err := parseRelationshipTypes(c.Query("types"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	consolidatedOnly := false
+	if consolidatedParam := c.Query("consolidated"); consolidatedParam != "" {
+		if consolidatedOnly, err = strconv.ParseBool(consolidatedParam); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "consolidated must be true or false"})
+			return
+		}
+	}
+	limit, _, err := parsePagination(c, defaultGraphNodeLimit, maxGraphNodeLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	centerQuery := `MATCH (n {id: $id}) WHERE ` + fmt.Sprintf(graphNodeCondition, "n") + ` RETURN n.id as id`
+	centerRecords, err := h.db.ExecuteRead(ctx, centerQuery, map[string]interface{}{"id": id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(centerRecords) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return
+	}
+
+	// Breadth-first, one query per hop, so the node limit bounds the work as well as the response
+	visited := []string{id}
+	frontier := []string{id}
+	truncated := false
+	levelQuery := `MATCH (n)-[r]-(m)
+		WHERE n.id IN $frontier AND type(r) IN $types AND NOT m.id IN $visited AND ` + fmt.Sprintf(graphNodeCondition, "m") + `
+		  AND ($consolidated_only = false OR (r.consolidated = true AND (m:Narrative OR m.consolidated = true)))
+		RETURN DISTINCT m.id as id
+		ORDER BY id
+		LIMIT $remaining`
+	for hop := 0; hop < depth && len(frontier) > 0 && !truncated; hop++ {
+		remaining := limit - len(visited)
+		records, err := h.db.ExecuteRead(ctx, levelQuery, map[string]interface{}{
+			"frontier":          frontier,
+			"visited":           visited,
+			"types":             types,
+			"consolidated_only": consolidatedOnly,
+			"remaining":         remaining + 1,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to expand neighborhood: " + err.Error()})
+			return
+		}
+		if len(records) > remaining {
+			records = records[:remaining]
+			truncated = true
+		}
+		next := make([]string, 0, len(records))
+		for _, record := range records {
+			next = append(next, getStringValue(record, "id"))
+		}
+		visited = append(visited, next...)
+		frontier = next
+	}
+
+	filter := graphEdgeFilter{}
+	if consolidatedOnly {
+		filter.Consolidated = true
+	}
+	elements, err := h.fetchGraphElements(ctx, visited, types, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"center":    id,
+		"depth":     depth,
+		"elements":  elements,
+		"truncated": truncated,
+	})
+}
+
+// Narrative graph views
+const (
+	NarrativeGraphRaw          = "raw"          // What analysis extracted from the narrative, before consolidation
+	NarrativeGraphConsolidated = "consolidated" // The consolidated concepts the narrative supports
+)
+
+// GetNarrativeGraph - Returns the mental model a narrative contributed: the Systems it DESCRIBES, their stocks
+// and flows, and the relationships among them, in the same shape as the neighborhood view.
+// The view query parameter picks raw (the unconsolidated extraction) or consolidated (the consolidated concepts
+// the narrative supports); by default it is consolidated once the narrative has been consolidated, raw before.
+func (h *Handler) GetNarrativeGraph(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	view := c.Query("view")
+	if view != "" && view != NarrativeGraphRaw && view != NarrativeGraphConsolidated {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "view must be raw or consolidated"})
+		return
+	}
+
+	records, err := h.db.ExecuteRead(ctx, `MATCH (n:Narrative {id: $id})
+		OPTIONAL MATCH (n)-[d:DESCRIBES]->(:System) WHERE d.consolidated = true
+		RETURN count(d) > 0 as consolidated`, map[string]interface{}{"id": id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
+	}
+	if view == "" {
+		view = NarrativeGraphRaw
+		if consolidated, _ := records[0]["consolidated"].(bool); consolidated {
+			view = NarrativeGraphConsolidated
+		}
+	}
+	consolidated := view == NarrativeGraphConsolidated
+
+	// The described systems, and the stocks and flows describing them that come from this narrative or that
+	// it linked to them. A reused concept is consolidated even in the raw view, so it is found by the
+	// relationship the narrative created rather than by its own status.
+	query := `MATCH (:Narrative {id: $id})-[d:DESCRIBES]->(s:System)
+		WHERE COALESCE(d.consolidated, false) = $consolidated
+		OPTIONAL MATCH (s)<-[r:DESCRIBES_STATIC|DESCRIBES_DYNAMIC]-(e)
+		WHERE (COALESCE(e.consolidated, false) = $consolidated
+		       AND (e.narrative_id = $id OR $id IN COALESCE(e.source_narratives, [])))
+		   OR (COALESCE(r.consolidated, false) = $consolidated
+		       AND (r.narrative_id = $id OR $id IN COALESCE(r.source_narratives, [])))
+		RETURN s.id as system_id, collect(e.id) as element_ids`
+	records, err = h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id, "consolidated": consolidated})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read narrative graph: " + err.Error()})
+		return
+	}
+	var ids []string
+	for _, record := range records {
+		ids = append(ids, getStringValue(record, "system_id"))
+		ids = append(ids, getStringList(record, "element_ids")...)
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	elements, err := h.fetchGraphElements(ctx, ids, modelRelationshipTypes, graphEdgeFilter{Consolidated: consolidated, NarrativeID: id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"narrative_id": id,
+		"view":         view,
+		"elements":     elements,
+	})
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+)
+
+const (
+	groundingTopKPerType   = 8    // Maximum existing concepts offered per node type
+	groundingMinSimilarity = 0.45 // Concepts below this similarity to the narrative are not offered
+	groundingMaxTextChars  = 8000 // Keeps the narrative within the embedding model's input limit
+)
+
+// GroundingConcept is a consolidated node offered to the LLM as existing vocabulary
+type GroundingConcept struct {
+	ID          string  `json:"id"`
+	NodeType    string  `json:"nodeType"` // "system", "stock", "flow"
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Similarity  float64 `json:"similarity"`
+}
+
+// retrieveGroundingConcepts embeds the narrative text and returns the consolidated
+// Systems, Stocks and Flows most similar to it, best matches first within each type.
+func (h *Handler) retrieveGroundingConcepts(ctx context.Context, narrativeID, text string) ([]GroundingConcept, error) {
+	if len(text) > groundingMaxTextChars {
+		// Back up to the start of a rune so the cut never leaves invalid UTF-8
+		cut := groundingMaxTextChars
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut]
+	}
+
+	_, consolidated, err := h.fetchNodesForConsolidation(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch consolidated nodes: %v", err)
+	}
+	if len(consolidated) == 0 {
+		return nil, nil
+	}
+
+	narrativeEmbedding, err := h.generateEmbedding(ctx, "grounding", text, llm.Trace{NarrativeID: narrativeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed narrative: %v", err)
+	}
+
+	var concepts []GroundingConcept
+	for _, nodeType := range []string{"system", "stock", "flow"} {
+		var candidates []GroundingConcept
+		for _, node := range consolidated[nodeType] {
+			nodeMap := node.(map[string]interface{})
+			score, err := cosineSimilarity(narrativeEmbedding, h.convertEmbedding(nodeMap["embedding"]))
+			if err != nil || score < groundingMinSimilarity {
+				continue
+			}
+			name, _ := nodeMap["name"].(string)
+			candidates = append(candidates, GroundingConcept{
+				ID:          nodeMap["id"].(string),
+				NodeType:    nodeType,
+				Name:        name,
+				Description: h.getDescription(nodeMap),
+				Similarity:  score,
+			})
+		}
+
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Similarity > candidates[j].Similarity })
+		if len(candidates) > groundingTopKPerType {
+			candidates = candidates[:groundingTopKPerType]
+		}
+		concepts = append(concepts, candidates...)
+	}
+
+	log.Printf("Grounding: offering %d existing concepts to the analysis prompt", len(concepts))
+	return concepts, nil
+}
+
+// formatGroundingVocabulary renders the grounding concepts as the vocabulary section of the user prompt
+func formatGroundingVocabulary(concepts []GroundingConcept) string {
+	if len(concepts) == 0 {
+		return "None yet. Create new nodes for every concept."
+	}
+
+	var sb strings.Builder
+	for _, concept := range concepts {
+		fmt.Fprintf(&sb, "- [%s] id: %s | name: %s | description: %s\n",
+			nodeLabel(concept.NodeType), concept.ID, concept.Name, concept.Description)
+	}
+	return sb.String()
+}
+
+// indexGroundingConcepts maps concept IDs to their concepts for validating LinkExistingNode actions
+func indexGroundingConcepts(concepts []GroundingConcept) map[string]GroundingConcept {
+	index := make(map[string]GroundingConcept, len(concepts))
+	for _, concept := range concepts {
+		index[concept.ID] = concept
+	}
+	return index
+}
@@ -1,18 +1,22 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
 	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"github.com/gin-gonic/gin"
@@ -20,11 +24,74 @@ import (
 )
 
 type Handler struct {
-	db *database.DB
+	db       *database.DB
+	llm      llm.Provider
+	embedder llm.Embedder
+	cache    llm.CacheStore // nil when the LLM cache is disabled
 }
 
+// NewHandler returns a Handler using the LLM provider and embedder configured in the environment.
+// Every call that reaches them is recorded in the LLMCall audit log, including each retried attempt;
+// cache hits never do. With LLM_FIXTURES=replay no model is configured at all: recorded responses answer
+// every call, and nothing is audited or cached.
 func NewHandler(db *database.DB) *Handler {
-	return &Handler{db: db}
+	// Record or replay every exchange with the models, for deterministic offline runs of the pipeline
+	fixtures, err := llm.NewFixturesFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure LLM fixtures:", err)
+	}
+	if fixtures != nil && fixtures.Replaying() {
+		log.Println("LLM fixtures: replaying recorded responses, no model will be called")
+		return NewHandlerWithProvider(db, fixtures.Provider(nil), fixtures.Embedder(nil))
+	}
+
+	provider, err := llm.NewFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure LLM provider:", err)
+	}
+	embedder, err := llm.NewEmbedderFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure embedding model:", err)
+	}
+
+	callStore := &llmCallStore{db: db}
+	provider = llm.WithAudit(provider, callStore)
+	embedder = llm.WithEmbedAudit(embedder, callStore)
+
+	// Pace and retry calls to the model service
+	throttle, err := llm.NewThrottleFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure LLM rate limits:", err)
+	}
+	provider = llm.WithRetry(provider, throttle)
+	embedder = llm.WithEmbedRetry(embedder, throttle)
+
+	cache, ttl, err := llmCacheFromEnv(db)
+	if err != nil {
+		log.Fatal("Failed to configure LLM cache:", err)
+	}
+	if cache != nil {
+		provider = llm.WithCache(provider, cache, ttl)
+		embedder = llm.WithEmbedCache(embedder, cache, ttl)
+	}
+
+	// Recording wraps everything else, so responses served from the cache are recorded too
+	if fixtures != nil {
+		log.Println("LLM fixtures: recording every model response")
+		provider = fixtures.Provider(provider)
+		embedder = fixtures.Embedder(embedder)
+	}
+
+	h := NewHandlerWithProvider(db, provider, embedder)
+	h.cache = cache
+	return h
+}
+
+// NewHandlerWithProvider returns a Handler that sends prompts to provider and texts to embedder. db may be
+// nil for offline use such as evaluation, which only calls ExtractNarrativePlan. Without an embedder,
+// near-duplicate merging across chunks is skipped.
+func NewHandlerWithProvider(db *database.DB, provider llm.Provider, embedder llm.Embedder) *Handler {
+	return &Handler{db: db, llm: provider, embedder: embedder}
 }
 
 // Helper functions for type conversion
@@ -37,6 +104,19 @@ func getStringValue(record map[string]interface{}, key string) string {
 	return ""
 }
 
+// nodeLabel maps the internal node type ("system", "stock", "flow") to its Neo4j label
+func nodeLabel(nodeType string) string {
+	switch strings.ToLower(nodeType) {
+	case "system":
+		return "System"
+	case "stock":
+		return "Stock"
+	case "flow":
+		return "Flow"
+	}
+	return ""
+}
+
 // Health check handler
 func (h *Handler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
@@ -215,29 +295,16 @@ func (h *Handler) CreateNarrativeNode(c *gin.Context) {
 		UpdatedAt:    now,
 	}
 
-	query := `CREATE (n:Narrative {
-		id: $id, 
-		title: $title, 
-		content: $content,
-		extrapolated: $extrapolated, 
-		created_at: $created_at, 
-		updated_at: $updated_at
-	})`
-	params := map[string]interface{}{
-		"id":           narrative.ID,
-		"title":        narrative.Title,
-		"content":      narrative.Content,
-		"extrapolated": narrative.Extrapolated,
-		"created_at":   narrative.CreatedAt.Format(time.RFC3339),
-		"updated_at":   narrative.UpdatedAt.Format(time.RFC3339),
-	}
-
-	_, err := h.db.ExecuteQuery(context.Background(), query, params)
+	err := h.createNarrativeInDB(context.Background(), &narrative, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if _, err := h.recordNarrativeRevision(context.Background(), narrative.ID, c.GetString("userID"), 0); err != nil {
+		log.Printf("Warning: Failed to record initial revision of narrative %s: %v", narrative.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, narrative)
 }
 
@@ -245,7 +312,7 @@ func (h *Handler) CreateNarrativeNode(c *gin.Context) {
 func (h *Handler) GetNarrativeByID(c *gin.Context) {
 	id := c.Param("id")
 	query := `MATCH (n:Narrative {id: $id}) 
-			  RETURN n.id, n.title, n.content, n.extrapolated, n.created_at, n.updated_at`
+			  RETURN n.id, n.title, n.content, n.extrapolated, n.slug, n.tags, n.created_at, n.updated_at`
 	params := map[string]interface{}{"id": id}
 
 	records, err := h.db.ExecuteRead(context.Background(), query, params)
@@ -272,6 +339,7 @@ func (h *Handler) GetNarrativeByID(c *gin.Context) {
 	} else {
 		narrative.Extrapolated = false // default value if not set
 	}
+	applyImportMetadata(&narrative, record)
 
 	if createdAtStr := getStringValue(record, "n.created_at"); createdAtStr != "" {
 		if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
@@ -291,7 +359,7 @@ func (h *Handler) GetNarrativeByID(c *gin.Context) {
 // Get Narratives - Reads all narratives
 func (h *Handler) GetNarratives(c *gin.Context) {
 	query := `MATCH (n:Narrative)
-			  RETURN n.id, n.title, n.content, n.extrapolated, n.created_at, n.updated_at`
+			  RETURN n.id, n.title, n.content, n.extrapolated, n.slug, n.tags, n.created_at, n.updated_at`
 	params := map[string]interface{}{}
 
 	records, err := h.db.ExecuteRead(context.Background(), query, params)
@@ -314,6 +382,7 @@ func (h *Handler) GetNarratives(c *gin.Context) {
 		} else {
 			narrative.Extrapolated = false // default value if not set
 		}
+		applyImportMetadata(&narrative, record)
 
 		if createdAtStr := getStringValue(record, "n.created_at"); createdAtStr != "" {
 			if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
@@ -342,59 +411,77 @@ func (h *Handler) UpdateNarrativeNode(c *gin.Context) {
 		return
 	}
 
-	updatedAt := time.Now()
+	if _, err := h.getNarrativeByIDFromDB(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
+	}
 
-	query := `MATCH (n:Narrative {id: $id})
-			  SET n.title = $title, n.content = $content, n.updated_at = $updated_at
-			  RETURN n.id, n.title, n.content, n.created_at, n.updated_at`
-	params := map[string]interface{}{
-		"id":         id,
-		"title":      req.Title,
-		"content":    req.Content,
-		"updated_at": updatedAt.Format(time.RFC3339),
+	// Every update is kept as an immutable revision attributed to the authenticated editor
+	revision, err := h.updateNarrativeContent(c.Request.Context(), id, req.Title, req.Content, c.GetString("userID"), 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	records, err := h.db.ExecuteRead(context.Background(), query, params)
+	updatedNarrative, err := h.getNarrativeByIDFromDB(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if len(records) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+	c.Header("X-Narrative-Revision", strconv.Itoa(revision.Number))
+	c.JSON(http.StatusOK, updatedNarrative)
+}
+
+// DeleteNarrative - Deletes a narrative, its revision history, extraction runs and analysis drafts.
+// The mode query parameter controls the derived graph: keep (default) leaves it untouched, unconsolidated also
+// deletes the unconsolidated nodes and relationships extracted from the narrative, and retract additionally
+// withdraws the narrative's support from consolidated ones, deleting those no other narrative supports.
+func (h *Handler) DeleteNarrativeNode(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	mode := c.DefaultQuery("mode", DeleteModeKeepDerived)
+	if mode != DeleteModeKeepDerived && mode != DeleteModeUnconsolidatedDerived && mode != DeleteModeRetract {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be keep, unconsolidated or retract"})
 		return
 	}
 
-	record := records[0]
-	updatedNarrative := models.Narrative{
-		ID:        record["n.id"].(string),
-		Title:     record["n.title"].(string),
-		Content:   record["n.content"].(string),
-		UpdatedAt: updatedAt,
+	if _, err := h.getNarrativeByIDFromDB(ctx, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
 	}
 
-	if createdAtStr := getStringValue(record, "n.created_at"); createdAtStr != "" {
-		if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
-			updatedNarrative.CreatedAt = createdAt
+	// Derived data is cleaned up first; the retract queries still need the narrative's DESCRIBES links
+	report := NarrativeDeletionReport{Mode: mode}
+	if mode == DeleteModeRetract {
+		if err := h.retractConsolidatedSupport(ctx, id, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+			return
+		}
+	}
+	if mode == DeleteModeUnconsolidatedDerived || mode == DeleteModeRetract {
+		if err := h.deleteUnconsolidatedDerived(ctx, id, &report); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+			return
 		}
 	}
 
-	c.JSON(http.StatusOK, updatedNarrative)
-}
-
-// DeleteNarrative - Deletes a narrative
-func (h *Handler) DeleteNarrativeNode(c *gin.Context) {
-	id := c.Param("id")
-	query := `MATCH (n:Narrative {id: $id}) DETACH DELETE n`
+	query := `MATCH (n:Narrative {id: $id})
+		OPTIONAL MATCH (n)-[:HAS_REVISION]->(r:NarrativeRevision)
+		OPTIONAL MATCH (n)-[:HAS_EXTRACTION_RUN]->(run:ExtractionRun)
+		OPTIONAL MATCH (run)-[:HAS_STAGE]->(stage:ExtractionStage)
+		OPTIONAL MATCH (n)-[:HAS_ANALYSIS_DRAFT]->(draft:AnalysisDraft)
+		DETACH DELETE n, r, run, stage, draft`
 	params := map[string]interface{}{"id": id}
 
-	_, err := h.db.ExecuteQuery(context.Background(), query, params)
+	_, err := h.db.ExecuteQuery(ctx, query, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Narrative deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Narrative deleted successfully", "report": report})
 }
 
 // AnalyzeNarrative takes a narrative ID in the request body, sends its content to an LLM for analysis,
@@ -411,109 +498,386 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 		return
 	}
 
-	// --- Step 1: Get API Key and Narrative Content ---
-	geminiApiKey := os.Getenv("GEMINI_API_KEY")
-	if geminiApiKey == "" {
-		log.Println("ERROR: GEMINI_API_KEY environment variable not set.")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server configuration error: missing API key"})
+	options, err := newAnalysisOptions(req.ExtractionMode, req.SelfConsistency, req.Critic)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// --- Step 1: Get the narrative content ---
 	narrative, err := h.getNarrativeByIDFromDB(c.Request.Context(), req.NarrativeID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Narrative with ID '%s' not found", req.NarrativeID)})
 		return
 	}
 
-	// --- Step 2: Build and Send Request to Gemini API ---
-	llmApiUrl := "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent"
-	userPrompt := fmt.Sprintf(userPromptTemplate, narrative.Title, narrative.Content)
-
-	// The new payload has a dedicated "systemInstruction" field
-	payload := map[string]interface{}{
-		"systemInstruction": map[string]interface{}{
-			"parts": []map[string]string{
-				{"text": systemInstruction},
-			},
-		},
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]string{
-					{"text": userPrompt},
-				},
-			},
-		},
-		"generationConfig": map[string]string{
-			"response_mime_type": "application/json",
-		},
-	}
-	llmReqBody, _ := json.Marshal(payload)
-
-	httpRequest, err := http.NewRequestWithContext(c.Request.Context(), "POST", llmApiUrl, bytes.NewBuffer(llmReqBody))
-	if err != nil {
-		log.Printf("ERROR: Failed to create Gemini request: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request to LLM service"})
+	// --- Steps 2-7: Extract, merge, critique and execute the plan ---
+	result, err := h.runNarrativeAnalysis(c.Request.Context(), narrative, options)
+	if err != nil {
+		respondWithAnalysisError(c, err)
 		return
 	}
-	httpRequest.Header.Set("Content-Type", "application/json")
-	httpRequest.Header.Set("X-goog-api-key", geminiApiKey)
 
-	client := &http.Client{}
-	httpResponse, err := client.Do(httpRequest)
-	if err != nil {
-		log.Printf("ERROR: Gemini API request failed: %v", err)
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not connect to the LLM service"})
-		return
+	// --- Step 8: Final Response ---
+	response := analysisResponse("Narrative analysis completed successfully", result)
+	response["narrativeId"] = req.NarrativeID
+	c.JSON(http.StatusOK, response)
+}
+
+// analysisResponse reports what an analysis wrote to the graph
+func analysisResponse(message string, result *AnalysisResult) gin.H {
+	response := gin.H{
+		"message":               message,
+		"chunks_analyzed":       result.ChunksAnalyzed,
+		"systems_created":       result.SystemsCreated,
+		"stocks_created":        result.StocksCreated,
+		"flows_created":         result.FlowsCreated,
+		"nodes_linked":          result.NodesLinked,
+		"relationships_created": result.RelationshipsCreated,
 	}
-	defer httpResponse.Body.Close()
+	if result.SelfConsistency != nil {
+		response["self_consistency"] = result.SelfConsistency
+	}
+	if result.Critique != nil {
+		response["critique"] = result.Critique
+	}
+	if result.ExtractionRunID != "" {
+		response["extraction_run_id"] = result.ExtractionRunID
+	}
+	return response
+}
 
-	if httpResponse.StatusCode != http.StatusOK {
-		log.Printf("ERROR: Gemini API returned non-200 status: %d", httpResponse.StatusCode)
-		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("LLM service returned status code %d", httpResponse.StatusCode)})
+// respondWithAnalysisError reports an analysis failure with the status carried by LLM errors
+func respondWithAnalysisError(c *gin.Context, err error) {
+	if llmErr, ok := err.(*llm.Error); ok {
+		c.JSON(llmErr.Status, gin.H{"error": llmErr.Message})
 		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// AnalysisResult summarizes what one narrative analysis wrote to the graph
+type AnalysisResult struct {
+	NarrativeID          string
+	ChunksAnalyzed       int
+	SystemsCreated       int
+	StocksCreated        int
+	FlowsCreated         int
+	NodesLinked          int
+	RelationshipsCreated int
+	SelfConsistency      *SelfConsistencyReport // Nil unless self-consistency extraction was requested
+	Critique             *CritiqueReport        // Nil when the critic is off
+	ExtractionRunID      string                 // Set when the plan was built by a staged extraction run
+}
+
+// AnalysisOptions select the optional stages of a narrative analysis
+type AnalysisOptions struct {
+	ExtractionMode  string                         // ExtractionModeJSON, ExtractionModeFunctions or ExtractionModeStaged
+	SelfConsistency *models.SelfConsistencyOptions // Normalized; nil extracts once
+	Critic          string                         // CriticOff, CriticFlag or CriticRepair
+}
 
-	// --- Step 3: Parse Gemini API Response ---
-	var geminiAPIResponse struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-		} `json:"candidates"`
+// newAnalysisOptions validates the optional stages requested for an analysis and fills in their defaults
+func newAnalysisOptions(extractionMode string, selfConsistency *models.SelfConsistencyOptions, critic string) (AnalysisOptions, error) {
+	mode, err := resolveExtractionMode(extractionMode)
+	if err != nil {
+		return AnalysisOptions{}, err
 	}
-	if err := json.NewDecoder(httpResponse.Body).Decode(&geminiAPIResponse); err != nil {
-		log.Printf("ERROR: Failed to decode Gemini API response: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid response from LLM service"})
-		return
+	normalized, err := normalizeSelfConsistency(selfConsistency)
+	if err != nil {
+		return AnalysisOptions{}, err
 	}
-	if len(geminiAPIResponse.Candidates) == 0 || len(geminiAPIResponse.Candidates[0].Content.Parts) == 0 {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "LLM service returned no content"})
-		return
+	if mode == ExtractionModeStaged && normalized != nil {
+		return AnalysisOptions{}, fmt.Errorf("selfConsistency is not supported with staged extraction")
+	}
+	criticMode, err := resolveCriticMode(critic)
+	if err != nil {
+		return AnalysisOptions{}, err
+	}
+	return AnalysisOptions{ExtractionMode: mode, SelfConsistency: normalized, Critic: criticMode}, nil
+}
+
+// runNarrativeAnalysis extracts a plan from the narrative with prepareAnalysisPlan and writes it to the graph
+// with applyAnalysisPlan
+func (h *Handler) runNarrativeAnalysis(ctx context.Context, narrative *models.Narrative, options AnalysisOptions) (*AnalysisResult, error) {
+	extracted, err := h.prepareAnalysisPlan(ctx, narrative, options)
+	if err != nil {
+		return nil, err
+	}
+	return h.applyAnalysisPlan(ctx, narrative, extracted), nil
+}
+
+// ExtractedPlan is a plan extracted from a narrative, with everything needed to write it to the graph later
+type ExtractedPlan struct {
+	Plan            models.LLMResponse
+	Grounding       []GroundingConcept // Existing concepts the plan may link to
+	PromptVersion   string
+	ChunkCount      int
+	SelfConsistency *SelfConsistencyReport // Nil unless self-consistency extraction was requested
+	Critique        *CritiqueReport        // Nil when the critic is off
+	ExtractionRunID string                 // Set when the plan was built by a staged extraction run
+}
+
+// prepareAnalysisPlan splits the narrative into chunks, extracts a plan from each and merges the plans, without
+// writing anything to the graph. With self-consistency the plan is the agreement of several sampled
+// extractions; in staged mode it is built over the stages of a persisted extraction run. With a critic it is
+// checked against the extraction rules, and optionally repaired.
+func (h *Handler) prepareAnalysisPlan(ctx context.Context, narrative *models.Narrative, options AnalysisOptions) (*ExtractedPlan, error) {
+	// Ground the extraction in the consolidated graph so the LLM can reuse existing concepts
+	groundingConcepts, err := h.retrieveGroundingConcepts(ctx, narrative.ID, narrative.Title+"\n\n"+narrative.Content)
+	if err != nil {
+		log.Printf("Warning: Proceeding without grounding concepts: %v", err)
+	}
+
+	// --- Step 2-4: Extract a plan from each chunk and merge them ---
+	var extracted *ExtractedPlan
+	if options.ExtractionMode == ExtractionModeStaged {
+		run, err := h.startExtractionRun(ctx, narrative, groundingConcepts)
+		if err != nil {
+			return nil, err
+		}
+		if err := h.runExtractionStages(ctx, narrative, run, 1); err != nil {
+			return nil, err
+		}
+		extracted = run.extractedPlan()
+	} else {
+		vocabulary := formatGroundingVocabulary(groundingConcepts)
+		extractionPrompts := extractionPromptsFromTemplate(h.activePrompt(ctx, extractionPromptName(options.ExtractionMode)))
+		extracted = &ExtractedPlan{Grounding: groundingConcepts, PromptVersion: extractionPrompts.Version}
+		if options.SelfConsistency != nil {
+			extracted.Plan, extracted.ChunkCount, extracted.SelfConsistency, err = h.extractSelfConsistentPlan(ctx, narrative, extractionPrompts, vocabulary, options.SelfConsistency)
+		} else {
+			extracted.Plan, extracted.ChunkCount, err = h.extractChunkedPlan(ctx, narrative, extractionPrompts, vocabulary, extractionSample{})
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	llmPlanJSON := geminiAPIResponse.Candidates[0].Content.Parts[0].Text
+	// --- Step 5: Critique the plan before anything is written ---
+	h.critiqueExtractedPlan(ctx, narrative, extracted, options.Critic)
+	return extracted, nil
+}
+
+// critiqueExtractedPlan checks the plan against the extraction rules unless the critic is off
+func (h *Handler) critiqueExtractedPlan(ctx context.Context, narrative *models.Narrative, extracted *ExtractedPlan, critic string) {
+	if critic != "" && critic != CriticOff {
+		extracted.Plan, extracted.Critique = h.critiquePlan(ctx, narrative, extracted.Plan, critic)
+	}
+}
+
+// applyAnalysisPlan executes an extracted plan, marks the narrative as extrapolated and, for a staged
+// extraction, marks its run as applied
+func (h *Handler) applyAnalysisPlan(ctx context.Context, narrative *models.Narrative, extracted *ExtractedPlan) *AnalysisResult {
+	// --- Step 6: Execute the plan ---
+	execution := h.executeLLMPlan(ctx, narrative, extracted.Plan, indexGroundingConcepts(extracted.Grounding), extracted.PromptVersion)
+
+	// --- Step 7: Mark narrative as extrapolated ---
+	// Update the narrative to mark it as extrapolated after successful analysis
+	// and remember which revision the extraction was based on
+	updateQuery := `MATCH (n:Narrative {id: $id}) 
+		OPTIONAL MATCH (n)-[:HAS_REVISION]->(r:NarrativeRevision)
+		WITH n, max(r.number) as revision
+		SET n.extrapolated = true, n.chunk_count = $chunk_count, n.analyzed_revision = revision,
+			n.analyzed_prompt_version = $prompt_version, n.updated_at = $updated_at`
+	updateParams := map[string]interface{}{
+		"id":             narrative.ID,
+		"chunk_count":    extracted.ChunkCount,
+		"prompt_version": extracted.PromptVersion,
+		"updated_at":     time.Now().Format(time.RFC3339),
+	}
+	_, err := h.db.ExecuteQuery(context.Background(), updateQuery, updateParams)
+	if err != nil {
+		log.Printf("Warning: Failed to mark narrative as extrapolated: %v", err)
+	}
+	if extracted.ExtractionRunID != "" {
+		h.markExtractionRunApplied(ctx, extracted.ExtractionRunID)
+	}
+
+	return &AnalysisResult{
+		NarrativeID:          narrative.ID,
+		ChunksAnalyzed:       extracted.ChunkCount,
+		SystemsCreated:       execution.SystemsCreated,
+		StocksCreated:        execution.StocksCreated,
+		FlowsCreated:         execution.FlowsCreated,
+		NodesLinked:          execution.NodesLinked,
+		RelationshipsCreated: execution.RelationshipsCreated,
+		SelfConsistency:      extracted.SelfConsistency,
+		Critique:             extracted.Critique,
+		ExtractionRunID:      extracted.ExtractionRunID,
+	}
+}
+
+// ExtractionPrompts are the system instruction and user prompt template used to extract a plan.
+// UserTemplate is formatted with the existing-concepts vocabulary, the narrative title and the chunk content.
+type ExtractionPrompts struct {
+	Version         string // Stamped as prompt_version on everything created from the plan
+	System          string
+	UserTemplate    string
+	FunctionCalling bool // The model answers by calling extractionTools instead of writing a JSON plan
+}
+
+// DefaultExtractionPrompts returns the built-in extraction prompts
+func DefaultExtractionPrompts() ExtractionPrompts {
+	return extractionPromptsFromTemplate(prompts.BuiltinDefault(prompts.Extraction))
+}
+
+func extractionPromptsFromTemplate(template prompts.Template) ExtractionPrompts {
+	return ExtractionPrompts{
+		Version:         template.Ref(),
+		System:          template.System,
+		UserTemplate:    template.User,
+		FunctionCalling: template.Name == prompts.ExtractionFunctions,
+	}
+}
+
+// ExtractNarrativePlan runs extraction over a narrative and returns the merged plan without grounding it in
+// the graph or executing it. Used to evaluate prompts offline.
+func (h *Handler) ExtractNarrativePlan(ctx context.Context, narrative *models.Narrative, prompts ExtractionPrompts) (*models.LLMResponse, error) {
+	plan, _, err := h.extractChunkedPlan(ctx, narrative, prompts, formatGroundingVocabulary(nil), extractionSample{})
+	if err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+// extractChunkedPlan splits the narrative into chunks, extracts a plan from each and merges them.
+// It returns the merged plan and the number of chunks analyzed.
+func (h *Handler) extractChunkedPlan(ctx context.Context, narrative *models.Narrative, prompts ExtractionPrompts, vocabulary string, sample extractionSample) (models.LLMResponse, int, error) {
+	chunks := chunkNarrative(narrative.Content, analysisChunkMaxChars, analysisChunkOverlapChars)
+	plans := make([]models.LLMResponse, 0, len(chunks))
+	for _, chunk := range chunks {
+		plan, err := h.extractPlan(ctx, narrative, prompts, vocabulary, chunk, sample)
+		if err != nil {
+			return models.LLMResponse{}, 0, err
+		}
+		plans = append(plans, *plan)
+	}
+	if len(chunks) > 1 {
+		log.Printf("Analyzed narrative %s in %d chunks", narrative.ID, len(chunks))
+	}
+
+	return h.mergeChunkPlans(ctx, narrative.ID, plans), len(chunks), nil
+}
+
+// extractPlan sends one chunk of a narrative to the LLM and parses the returned action plan.
+func (h *Handler) extractPlan(ctx context.Context, narrative *models.Narrative, prompts ExtractionPrompts, vocabulary string, chunk NarrativeChunk, sample extractionSample) (*models.LLMResponse, error) {
+	userPrompt := fmt.Sprintf(prompts.UserTemplate, vocabulary, narrative.Title, formatChunkContent(chunk))
+	request := llm.Request{
+		Purpose:      "extraction",
+		SystemPrompt: prompts.System,
+		UserPrompt:   userPrompt,
+		JSON:         true,
+		Temperature:  sample.Temperature,
+		Model:        sample.Model,
+		Sample:       sample.Index,
+		Trace:        llm.Trace{NarrativeID: narrative.ID, PromptVersion: prompts.Version},
+	}
+	if prompts.FunctionCalling {
+		request.JSON = false
+		request.Tools = extractionTools
+	}
+	response, err := h.llm.Generate(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	llmPlanJSON := response.Text
+
 	var llmPlan models.LLMResponse
-	if err := json.Unmarshal([]byte(llmPlanJSON), &llmPlan); err != nil {
-		log.Printf("ERROR: Failed to unmarshal LLM plan from content string: %v. Content was: %s", err, llmPlanJSON)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse LLM's structured plan"})
-		return
+	if prompts.FunctionCalling {
+		llmPlan, err = planFromToolCalls(response.ToolCalls)
+		h.recordParseOutcome(ctx, response, err)
+		if err != nil {
+			log.Printf("ERROR: Failed to read LLM plan from function calls: %v. Text was: %s", err, response.Text)
+			return nil, &llm.Error{Status: http.StatusInternalServerError, Message: "LLM did not call the extraction functions"}
+		}
+		planJSON, _ := json.Marshal(llmPlan)
+		llmPlanJSON = string(planJSON)
+	} else {
+		err = json.Unmarshal([]byte(llmPlanJSON), &llmPlan)
+		h.recordParseOutcome(ctx, response, err)
+		if err != nil {
+			log.Printf("ERROR: Failed to unmarshal LLM plan from content string: %v. Content was: %s", err, llmPlanJSON)
+			return nil, &llm.Error{Status: http.StatusInternalServerError, Message: "Failed to parse LLM's structured plan"}
+		}
 	}
 
 	// Log the LLM response for debugging/analysis
-	log.Printf("LLM_RESPONSE [Narrative: %s] [Timestamp: %s]: %s",
-		req.NarrativeID,
+	log.Printf("LLM_RESPONSE [Narrative: %s] [Chunk: %d/%d] [Timestamp: %s]: %s",
+		narrative.ID,
+		chunk.Index+1, chunk.Total,
 		time.Now().Format(time.RFC3339),
 		llmPlanJSON)
 
-	// --- Step 4 & 5: Execute the Plan (Two-Pass Orchestration) ---
+	return &llmPlan, nil
+}
+
+// PlanExecution tallies what executeLLMPlan wrote to the graph
+type PlanExecution struct {
+	SystemsCreated       int
+	StocksCreated        int
+	FlowsCreated         int
+	NodesLinked          int
+	RelationshipsCreated int
+}
+
+// actionProvenance returns the properties recording which narrative, chunks and prompt version an element came
+// from, and its self-consistency confidence when it has one. An action's own prompt version takes precedence
+// over the plan's. With STAGING_AUTO_APPROVE set, the element is also approved for consolidation right away.
+func actionProvenance(narrativeID, promptVersion string, action models.LLMAction) map[string]interface{} {
+	if action.PromptVersion != "" {
+		promptVersion = action.PromptVersion
+	}
+	sourceChunks := make([]int64, len(action.SourceChunks))
+	for i, chunk := range action.SourceChunks {
+		sourceChunks[i] = int64(chunk)
+	}
+	props := map[string]interface{}{
+		"narrative_id":   narrativeID,
+		"source_chunks":  sourceChunks,
+		"prompt_version": promptVersion,
+	}
+	if action.Confidence > 0 {
+		props["confidence"] = action.Confidence
+	}
+	if stagingAutoApprove() {
+		props["approved"] = true
+	}
+	return props
+}
+
+// executeLLMPlan runs a plan in two passes: nodes first, then the relationships between them by name.
+// Malformed or unresolvable actions are logged and skipped.
+func (h *Handler) executeLLMPlan(ctx context.Context, narrative *models.Narrative, llmPlan models.LLMResponse, groundingIndex map[string]GroundingConcept, promptVersion string) PlanExecution {
+	var execution PlanExecution
 	narrativeIDs, systemIDs, stockIDs, flowIDs := make(map[string]string), make(map[string]string), make(map[string]string), make(map[string]string)
 	narrativeIDs[narrative.Title] = narrative.ID // Pre-populate with existing narrative
 	// PASS 1: Create All Nodes
 	for _, action := range llmPlan.Actions {
 		params := action.Parameters
+		props := actionProvenance(narrative.ID, promptVersion, action)
 		switch action.FunctionName {
+		case "LinkExistingNode":
+			name, ok1 := params["name"].(string)
+			nodeType, ok2 := params["type"].(string)
+			id, ok3 := params["id"].(string)
+			if !ok1 || !ok2 || !ok3 {
+				log.Printf("Warning: Skipping LinkExistingNode due to malformed parameters: %+v", params)
+				continue
+			}
+			concept, ok := groundingIndex[id]
+			if !ok || !strings.EqualFold(concept.NodeType, nodeType) {
+				log.Printf("Warning: Skipping LinkExistingNode for unknown %s id '%s'", nodeType, id)
+				continue
+			}
+			// Register both the name the LLM used and the canonical name so relationships resolve either way
+			idsByType := map[string]map[string]string{"system": systemIDs, "stock": stockIDs, "flow": flowIDs}[concept.NodeType]
+			idsByType[name] = concept.ID
+			idsByType[concept.Name] = concept.ID
+			if err := h.addNarrativeSupport(ctx, concept.ID, narrative.ID); err != nil {
+				log.Printf("Warning: Failed to record '%s' as a source of %s '%s': %v", narrative.ID, concept.NodeType, concept.Name, err)
+			}
+			execution.NodesLinked++
 		case "CreateSystemNode":
 			name, ok1 := params["name"].(string)
 			desc, ok2 := params["boundaryDescription"].(string)
@@ -521,12 +885,13 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 				log.Printf("Warning: Skipping CreateSystemNode due to malformed parameters: %+v", params)
 				continue
 			}
-			system, err := h.createSystemInDB(c.Request.Context(), models.SystemRequest{Name: name, BoundaryDescription: desc})
+			system, err := h.createSystemInDB(ctx, models.SystemRequest{Name: name, BoundaryDescription: desc}, props)
 			if err != nil {
 				log.Printf("Error creating system '%s': %v", name, err)
 				continue
 			}
 			systemIDs[name] = system.ID
+			execution.SystemsCreated++
 		case "CreateStockNode":
 			name, ok1 := params["name"].(string)
 			desc, ok2 := params["description"].(string)
@@ -535,12 +900,13 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 				log.Printf("Warning: Skipping CreateStockNode due to malformed parameters: %+v", params)
 				continue
 			}
-			stock, err := h.createStockInDB(c.Request.Context(), models.StockRequest{Name: name, Description: desc, Type: stockType})
+			stock, err := h.createStockInDB(ctx, models.StockRequest{Name: name, Description: desc, Type: stockType}, props)
 			if err != nil {
 				log.Printf("Error creating stock '%s': %v", name, err)
 				continue
 			}
 			stockIDs[name] = stock.ID
+			execution.StocksCreated++
 		case "CreateFlowNode":
 			name, ok1 := params["name"].(string)
 			desc, ok2 := params["description"].(string)
@@ -548,18 +914,27 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 				log.Printf("Warning: Skipping CreateFlowNode due to malformed parameters: %+v", params)
 				continue
 			}
-			flow, err := h.createFlowInDB(c.Request.Context(), models.FlowRequest{Name: name, Description: desc})
+			flow, err := h.createFlowInDB(ctx, models.FlowRequest{Name: name, Description: desc}, props)
 			if err != nil {
 				log.Printf("Error creating flow '%s': %v", name, err)
 				continue
 			}
 			flowIDs[name] = flow.ID
+			execution.FlowsCreated++
 		}
 	}
 
 	// PASS 2: Create All Relationships
+	recordRelationship := func(created int64, err error) {
+		if err != nil {
+			log.Printf("Error creating relationship: %v", err)
+			return
+		}
+		execution.RelationshipsCreated += int(created)
+	}
 	for _, action := range llmPlan.Actions {
 		params := action.Parameters
+		props := actionProvenance(narrative.ID, promptVersion, action)
 		switch action.FunctionName {
 		case "CreateDescribesRelationship":
 			narrativeName, ok1 := params["narrativeName"].(string)
@@ -569,7 +944,7 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 			}
 			if systemID, ok2 := systemIDs[systemName]; ok2 {
 				if narrativeID, ok1 := narrativeIDs[narrativeName]; ok1 {
-					h.createDescribesRelationshipInDB(c.Request.Context(), narrativeID, systemID)
+					recordRelationship(h.createDescribesRelationshipInDB(ctx, narrativeID, systemID, props))
 				}
 			}
 		case "CreateConstitutesRelationship":
@@ -580,7 +955,7 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 			}
 			if subsystemID, ok1 := systemIDs[subsystemName]; ok1 {
 				if systemID, ok2 := systemIDs[systemName]; ok2 {
-					h.createConstitutesRelationshipInDB(c.Request.Context(), subsystemID, systemID)
+					recordRelationship(h.createConstitutesRelationshipInDB(ctx, subsystemID, systemID, props))
 				}
 			}
 		case "CreateDescribesStaticRelationship":
@@ -591,7 +966,18 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 			}
 			if stockID, ok1 := stockIDs[stockName]; ok1 {
 				if systemID, ok2 := systemIDs[systemName]; ok2 {
-					h.createDescribesStaticRelationshipInDB(c.Request.Context(), stockID, systemID)
+					recordRelationship(h.createDescribesStaticRelationshipInDB(ctx, stockID, systemID, props))
+				}
+			}
+		case "CreateDescribesDynamicRelationship":
+			flowName, ok1 := params["flowName"].(string)
+			systemName, ok2 := params["systemName"].(string)
+			if !ok1 || !ok2 {
+				continue
+			}
+			if flowID, ok1 := flowIDs[flowName]; ok1 {
+				if systemID, ok2 := systemIDs[systemName]; ok2 {
+					recordRelationship(h.createDescribesDynamicRelationshipInDB(ctx, flowID, systemID, props))
 				}
 			}
 		case "CreateChangesRelationship":
@@ -603,7 +989,7 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 			}
 			if flowID, ok1 := flowIDs[flowName]; ok1 {
 				if stockID, ok2 := stockIDs[stockName]; ok2 {
-					h.createChangesRelationshipInDB(c.Request.Context(), flowID, stockID, float32(polarity))
+					recordRelationship(h.createChangesRelationshipInDB(ctx, flowID, stockID, float32(polarity), props))
 				}
 			}
 		case "CreateCausalLinkRelationship":
@@ -619,97 +1005,14 @@ func (h *Handler) AnalyzeNarrative(c *gin.Context) {
 			fromID, toID := getIDFromNameAndType(fromName, fromType, stockIDs, flowIDs), getIDFromNameAndType(toName, toType, stockIDs, flowIDs)
 			if fromID != "" && toID != "" {
 				linkReq := models.CausalLink{FromID: fromID, FromType: fromType, ToID: toID, ToType: toType, Question: question, CuriosityScore: float32(score)}
-				h.createCausalLinkInDB(c.Request.Context(), linkReq)
+				recordRelationship(h.createCausalLinkInDB(ctx, linkReq, props))
 			}
 		}
 	}
 
-	// --- Step 6: Mark narrative as extrapolated ---
-	// Update the narrative to mark it as extrapolated after successful analysis
-	updateQuery := `MATCH (n:Narrative {id: $id}) 
-		SET n.extrapolated = true, n.updated_at = $updated_at`
-	updateParams := map[string]interface{}{
-		"id":         req.NarrativeID,
-		"updated_at": time.Now().Format(time.RFC3339),
-	}
-	_, err = h.db.ExecuteQuery(context.Background(), updateQuery, updateParams)
-	if err != nil {
-		log.Printf("Warning: Failed to mark narrative as extrapolated: %v", err)
-	}
-
-	// --- Step 7: Final Response ---
-	c.JSON(http.StatusOK, gin.H{
-		"message":         "Narrative analysis completed successfully",
-		"narrativeId":     req.NarrativeID,
-		"systems_created": len(systemIDs),
-		"stocks_created":  len(stockIDs),
-		"flows_created":   len(flowIDs),
-	})
+	return execution
 }
 
-const systemInstruction = `
-1. Your Role and Mission
-You are a Systems Analyst. Your mission is to analyze unstructured text to reverse-engineer the author's implicit mental model of how a system works. You will formalize their observations, beliefs, and questions into a structured graph of objective, universal components (Systems, Stocks, Flows). You must remain completely detached from the author's personal experience and focus only on the underlying mechanics they are describing.
-
-2. Core Principles of Analysis
-
-Principle of Universalization: Your primary task is to find the universal principle or system behind any specific anecdote. A story about a specific job is evidence for a model of a Workplace Environment. A feeling of sadness after a setback is evidence for a model of Emotional Response Systems.
-Strict Naming Convention: All names for Systems, Stocks, and Flows must be objective, formal, and timeless. Avoid subjective or personal framing (e.g., use Cognitive Resource Depletion, not I was tired).
-Concise Functional Descriptions: All boundaryDescription and description fields must be under 15 words and describe the component's objective function, not the author's feelings.
-
-3. The Cognitive Workflow
-You must follow these guidelines in the exact sequence of analysis:
-Deconstruct & Universalize: Break the narrative into key observations. For each, state the universal principle it represents. (e.g., Observation: "I stayed up late and couldn't debug code." -> Principle: "Cognitive effort depletes a finite pool of mental energy, which is restored by rest.")
-Identify Formal Systems: Based on the principles, identify the formal systems at play (Software Development Lifecycle, Human Cognitive System, etc.). Create CreateSystemNode actions.
-Model System Components: Extract the formal Stocks (Mental Energy) and Flows (Cognitive Exertion, Restorative Sleep) that make up these systems. Create the CreateStockNode and CreateFlowNode actions.
-Map Connections: Link components to their systems (CreateDescribesStaticRelationship) and model known mechanisms (CreateChangesRelationship).
-Formulate Hypotheses: Identify the author's curiosities about how components interact and create CreateCausalLinkRelationship actions. The curiosity question must be framed as a formal research question.
-
-Overall Follow this framework
-Identify Systems: First, read the text to identify the primary containers for the narrative's dynamics. These can be concrete (Business Corporation) or abstract (Workplace Culture). Create CreateSystemNode actions and CreateConstitutesRelationship actions for any nested systems.
-Link Narrative: Create a CreateDescribesRelationship action to link the source narrative to each top-level system you identified.
-Identify Stocks: Next, identify the state variables that describe each system. These are the accumulations or qualities of the system. Create CreateStockNode actions and CreateDescribesStaticRelationship actions to link them to their parent system.
-Identify Flows: Now, identify the processes or activities that cause stocks to change. Create CreateFlowNode actions. For each flow that directly affects a stock, create a CreateChangesRelationship action, specifying the polarity (+1.0 for increase, -1.0 for decrease).
-Identify Causal Links: Finally, identify all hypothesized or uncertain connections between any two elements (Stock or Flow). For each, create a CreateCausalLinkRelationship action. You must provide a summarized curiosity question and a curiosityScore based on the following scale:
-1.0 (Direct Question): Used for explicit questions (e.g., "I wonder why...", "How does...?").
-0.5 (Uncertainty): Used for speculative statements (e.g., "It seems like...", "Perhaps...", "I think...").
-0.1 (Assertion without Mechanism): Used for statements of causality where the "how" is not explained (e.g., "X leads to Y.").
-
-4. Function API
-You will call these functions to build the graph:
-
-CreateSystemNode(name: string, boundaryDescription: string)
-CreateDescribesRelationship(narrativeName: string, systemName: string)
-CreateStockNode(name: string, description: string, type: string) (type is 'qualitative' or 'quantitative')
-CreateFlowNode(name: string, description: string)
-CreateConstitutesRelationship(subsystemName: string, systemName: string)
-CreateDescribesStaticRelationship(stockName: string, systemName:string)
-CreateChangesRelationship(flowName: string, stockName: string, polarity: float)
-CreateCausalLinkRelationship(fromType: string, fromName: string, toType: string, toName: string, curiosity: string, curiosityScore: float)
-
-5. Your Task & Output Format
-Your output must be a single, valid JSON object with a key named "actions". The value must be an array of objects, where each object represents a single function call with "function__name" and "parameters" keys. Do not provide any other explanatory text. Ensure that all objects in the 'actions' array are separate and correctly formatted, with no nesting of action objects inside the parameters of other actions. The response will be parsed automatically and must be perfect.
-Example valid output:
-{
-	"actions": [
-		{
-			"function_name": "CreateSystemNode",
-			"parameters": { "name": "System A", "boundaryDescription": "..." }
-		},
-		{
-			"function_name": "CreateStockNode",
-			"parameters": { "name": "Stock B", "description": "...", "type": "qualitative" }
-		}
-	]
-}
-Analyze the following narrative:	
-`
-
-const userPromptTemplate = `
-	Narrative Title: %s
-	Narrative Content: %s
-`
-
 // getIDFromNameAndType is a helper to find an ID from the correct map.
 func getIDFromNameAndType(name, nodeType string, stockIDs, flowIDs map[string]string) string {
 	if strings.EqualFold(nodeType, "Stock") {
@@ -729,8 +1032,70 @@ func getIDFromNameAndType(name, nodeType string, stockIDs, flowIDs map[string]st
 // ====== DATABASE LOGIC HELPERS ======
 // These functions contain the core database logic, making them reusable.
 
+// nonNilProps guards the "SET x += $props" clauses against a nil map, which Cypher rejects
+func nonNilProps(props map[string]interface{}) map[string]interface{} {
+	if props == nil {
+		return map[string]interface{}{}
+	}
+	return props
+}
+
+// contentHash fingerprints narrative text so re-imports of identical content can be detected
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// applyImportMetadata copies the optional slug and tags of imported narratives from a record
+func applyImportMetadata(narrative *models.Narrative, record map[string]interface{}) {
+	narrative.Slug = getStringValue(record, "n.slug")
+	if tags, ok := record["n.tags"].([]interface{}); ok {
+		for _, tag := range tags {
+			if s, ok := tag.(string); ok {
+				narrative.Tags = append(narrative.Tags, s)
+			}
+		}
+	}
+}
+
+func (h *Handler) createNarrativeInDB(ctx context.Context, narrative *models.Narrative, props map[string]interface{}) error {
+	query := `CREATE (n:Narrative {
+		id: $id, 
+		title: $title, 
+		content: $content,
+		content_hash: $content_hash,
+		extrapolated: $extrapolated, 
+		slug: $slug,
+		tags: $tags,
+		created_at: $created_at, 
+		updated_at: $updated_at
+	}) SET n += $props`
+	params := map[string]interface{}{
+		"props":        nonNilProps(props),
+		"id":           narrative.ID,
+		"title":        narrative.Title,
+		"content":      narrative.Content,
+		"content_hash": contentHash(narrative.Content),
+		"extrapolated": narrative.Extrapolated,
+		"slug":         nilIfEmpty(narrative.Slug),
+		"tags":         nonNilTags(narrative.Tags),
+		"created_at":   narrative.CreatedAt.Format(time.RFC3339),
+		"updated_at":   narrative.UpdatedAt.Format(time.RFC3339),
+	}
+	_, err := h.db.ExecuteQuery(ctx, query, params)
+	return err
+}
+
+// nilIfEmpty stores an empty optional string as a missing property rather than ""
+func nilIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 func (h *Handler) getNarrativeByIDFromDB(ctx context.Context, id string) (*models.Narrative, error) {
-	query := `MATCH (n:Narrative {id: $id}) RETURN n.id, n.title, n.content, n.extrapolated, n.created_at`
+	query := `MATCH (n:Narrative {id: $id}) RETURN n.id, n.title, n.content, n.extrapolated, n.slug, n.tags, n.created_at, n.updated_at`
 	params := map[string]interface{}{"id": id}
 	records, err := h.db.ExecuteRead(ctx, query, params)
 	if err != nil {
@@ -752,11 +1117,23 @@ func (h *Handler) getNarrativeByIDFromDB(ctx context.Context, id string) (*model
 	} else {
 		narrative.Extrapolated = false // default value if not set
 	}
+	applyImportMetadata(narrative, record)
+
+	if createdAtStr := getStringValue(record, "n.created_at"); createdAtStr != "" {
+		if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
+			narrative.CreatedAt = createdAt
+		}
+	}
+	if updatedAtStr := getStringValue(record, "n.updated_at"); updatedAtStr != "" {
+		if updatedAt, err := time.Parse(time.RFC3339, updatedAtStr); err == nil {
+			narrative.UpdatedAt = updatedAt
+		}
+	}
 
 	return narrative, nil
 }
 
-func (h *Handler) createSystemInDB(ctx context.Context, req models.SystemRequest) (*models.System, error) {
+func (h *Handler) createSystemInDB(ctx context.Context, req models.SystemRequest, props map[string]interface{}) (*models.System, error) {
 	system := &models.System{
 		ID:                  uuid.New().String(),
 		Name:                req.Name,
@@ -776,8 +1153,9 @@ func (h *Handler) createSystemInDB(ctx context.Context, req models.SystemRequest
 		consolidated: $consolidated,
 		consolidation_score: $consolidation_score,
 		created_at: $created_at
-	})`
+	}) SET s += $props`
 	params := map[string]interface{}{
+		"props":                nonNilProps(props),
 		"id":                   system.ID,
 		"name":                 system.Name,
 		"boundary_description": system.BoundaryDescription,
@@ -791,7 +1169,7 @@ func (h *Handler) createSystemInDB(ctx context.Context, req models.SystemRequest
 	return system, err
 }
 
-func (h *Handler) createStockInDB(ctx context.Context, req models.StockRequest) (*models.Stock, error) {
+func (h *Handler) createStockInDB(ctx context.Context, req models.StockRequest, props map[string]interface{}) (*models.Stock, error) {
 	stock := &models.Stock{
 		ID:                 uuid.New().String(),
 		Name:               req.Name,
@@ -813,8 +1191,9 @@ func (h *Handler) createStockInDB(ctx context.Context, req models.StockRequest)
 		consolidated: $consolidated,
 		consolidation_score: $consolidation_score,
 		created_at: $created_at
-	})`
+	}) SET st += $props`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"id":                  stock.ID,
 		"name":                stock.Name,
 		"description":         stock.Description,
@@ -829,7 +1208,7 @@ func (h *Handler) createStockInDB(ctx context.Context, req models.StockRequest)
 	return stock, err
 }
 
-func (h *Handler) createFlowInDB(ctx context.Context, req models.FlowRequest) (*models.Flow, error) {
+func (h *Handler) createFlowInDB(ctx context.Context, req models.FlowRequest, props map[string]interface{}) (*models.Flow, error) {
 	flow := &models.Flow{
 		ID:                 uuid.New().String(),
 		Name:               req.Name,
@@ -849,8 +1228,9 @@ func (h *Handler) createFlowInDB(ctx context.Context, req models.FlowRequest) (*
 		consolidated: $consolidated,
 		consolidation_score: $consolidation_score,
 		created_at: $created_at
-	})`
+	}) SET f += $props`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"id":                  flow.ID,
 		"name":                flow.Name,
 		"description":         flow.Description,
@@ -864,60 +1244,100 @@ func (h *Handler) createFlowInDB(ctx context.Context, req models.FlowRequest) (*
 	return flow, err
 }
 
-func (h *Handler) createDescribesRelationshipInDB(ctx context.Context, narrativeID, systemID string) error {
+// createDescribesRelationshipInDB, like the other create*RelationshipInDB functions, returns how many
+// relationships it created: none when either endpoint is missing, as MATCH then finds nothing
+func (h *Handler) createDescribesRelationshipInDB(ctx context.Context, narrativeID, systemID string, props map[string]interface{}) (int64, error) {
 	query := `MATCH (n:Narrative {id: $narrative_id}), (s:System {id: $system_id}) 
-		CREATE (n)-[:DESCRIBES {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(s)`
+		CREATE (n)-[r:DESCRIBES {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(s) SET r += $props
+		RETURN count(r) as created`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"narrative_id":        narrativeID,
 		"system_id":           systemID,
 		"consolidated":        false,
 		"consolidation_score": 0,
 	}
-	_, err := h.db.ExecuteQuery(ctx, query, params)
-	return err
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return countFromRecords(records, "created"), nil
 }
 
-func (h *Handler) createConstitutesRelationshipInDB(ctx context.Context, subsystemID, systemID string) error {
+func (h *Handler) createConstitutesRelationshipInDB(ctx context.Context, subsystemID, systemID string, props map[string]interface{}) (int64, error) {
 	query := `MATCH (sub:System {id: $subsystem_id}), (sys:System {id: $system_id}) 
-		CREATE (sub)-[:CONSTITUTES {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(sys)`
+		CREATE (sub)-[r:CONSTITUTES {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(sys) SET r += $props
+		RETURN count(r) as created`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"subsystem_id":        subsystemID,
 		"system_id":           systemID,
 		"consolidated":        false,
 		"consolidation_score": 0,
 	}
-	_, err := h.db.ExecuteQuery(ctx, query, params)
-	return err
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return countFromRecords(records, "created"), nil
 }
 
-func (h *Handler) createDescribesStaticRelationshipInDB(ctx context.Context, stockID, systemID string) error {
+func (h *Handler) createDescribesStaticRelationshipInDB(ctx context.Context, stockID, systemID string, props map[string]interface{}) (int64, error) {
 	query := `MATCH (st:Stock {id: $stock_id}), (s:System {id: $system_id}) 
-		CREATE (st)-[:DESCRIBES_STATIC {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(s)`
+		CREATE (st)-[r:DESCRIBES_STATIC {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(s) SET r += $props
+		RETURN count(r) as created`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"stock_id":            stockID,
 		"system_id":           systemID,
 		"consolidated":        false,
 		"consolidation_score": 0,
 	}
-	_, err := h.db.ExecuteQuery(ctx, query, params)
-	return err
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return countFromRecords(records, "created"), nil
+}
+
+func (h *Handler) createDescribesDynamicRelationshipInDB(ctx context.Context, flowID, systemID string, props map[string]interface{}) (int64, error) {
+	query := `MATCH (f:Flow {id: $flow_id}), (s:System {id: $system_id}) 
+		CREATE (f)-[r:DESCRIBES_DYNAMIC {consolidated: $consolidated, consolidation_score: $consolidation_score}]->(s) SET r += $props
+		RETURN count(r) as created`
+	params := map[string]interface{}{
+		"props":               nonNilProps(props),
+		"flow_id":             flowID,
+		"system_id":           systemID,
+		"consolidated":        false,
+		"consolidation_score": 0,
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return countFromRecords(records, "created"), nil
 }
 
-func (h *Handler) createChangesRelationshipInDB(ctx context.Context, flowID, stockID string, polarity float32) error {
+func (h *Handler) createChangesRelationshipInDB(ctx context.Context, flowID, stockID string, polarity float32, props map[string]interface{}) (int64, error) {
 	query := `MATCH (f:Flow {id: $flow_id}), (st:Stock {id: $stock_id}) 
-		CREATE (f)-[:CHANGES {polarity: $polarity, consolidated: $consolidated, consolidation_score: $consolidation_score}]->(st)`
+		CREATE (f)-[r:CHANGES {polarity: $polarity, consolidated: $consolidated, consolidation_score: $consolidation_score}]->(st) SET r += $props
+		RETURN count(r) as created`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"flow_id":             flowID,
 		"stock_id":            stockID,
 		"polarity":            polarity,
 		"consolidated":        false,
 		"consolidation_score": 0,
 	}
-	_, err := h.db.ExecuteQuery(ctx, query, params)
-	return err
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return countFromRecords(records, "created"), nil
 }
 
-func (h *Handler) createCausalLinkInDB(ctx context.Context, req models.CausalLink) error {
+func (h *Handler) createCausalLinkInDB(ctx context.Context, req models.CausalLink, props map[string]interface{}) (int64, error) {
 	query := `MATCH (a), (b) WHERE a.id = $from_id AND b.id = $to_id 
 		CREATE (a)-[r:CAUSAL_LINK {
 			question: $question, 
@@ -925,8 +1345,10 @@ func (h *Handler) createCausalLinkInDB(ctx context.Context, req models.CausalLin
 			consolidated: $consolidated,
 			consolidation_score: $consolidation_score,
 			created_at: $created_at
-		}]->(b)`
+		}]->(b) SET r += $props
+		RETURN count(r) as created`
 	params := map[string]interface{}{
+		"props":               nonNilProps(props),
 		"from_id":             req.FromID,
 		"to_id":               req.ToID,
 		"question":            req.Question,
@@ -935,10 +1357,16 @@ func (h *Handler) createCausalLinkInDB(ctx context.Context, req models.CausalLin
 		"consolidation_score": 0,
 		"created_at":          time.Now().Format(time.RFC3339),
 	}
-	_, err := h.db.ExecuteQuery(ctx, query, params)
-	return err
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return countFromRecords(records, "created"), nil
 }
 
+// cleanPreservedLabels are the node labels CleanNonNarrativeData never deletes: source material and bookkeeping
+var cleanPreservedLabels = []string{"Narrative", "NarrativeRevision", "SchemaMigration", "PromptVersion", "LLMCall", "LLMCacheEntry", "ExtractionRun", "ExtractionStage", "AnalysisDraft"}
+
 // CleanNonNarrativeData - Deletes all nodes and relationships except for Narratives.
 // This is a utility function for resetting the knowledge graph without deleting the source material.
 func (h *Handler) CleanNonNarrativeData(c *gin.Context) {
@@ -947,10 +1375,11 @@ func (h *Handler) CleanNonNarrativeData(c *gin.Context) {
 	// 1. Count nodes to be deleted for reporting purposes.
 	countQuery := `
         MATCH (n)
-        WHERE NOT n:Narrative
+        WHERE NOT any(label IN labels(n) WHERE label IN $preserved)
         RETURN count(n) as nodes_to_delete
     `
-	records, err := h.db.ExecuteRead(ctx, countQuery, nil)
+	params := map[string]interface{}{"preserved": cleanPreservedLabels}
+	records, err := h.db.ExecuteRead(ctx, countQuery, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count nodes for deletion: " + err.Error()})
 		return
@@ -967,10 +1396,10 @@ func (h *Handler) CleanNonNarrativeData(c *gin.Context) {
 	// DETACH DELETE removes the nodes and any relationships connected to them atomically.
 	deleteQuery := `
         MATCH (n)
-        WHERE NOT n:Narrative
+        WHERE NOT any(label IN labels(n) WHERE label IN $preserved)
         DETACH DELETE n
     `
-	if _, err = h.db.ExecuteQuery(ctx, deleteQuery, nil); err != nil {
+	if _, err = h.db.ExecuteQuery(ctx, deleteQuery, params); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete non-narrative nodes: " + err.Error()})
 		return
 	}
@@ -1002,12 +1431,21 @@ func (h *Handler) CleanNonNarrativeData(c *gin.Context) {
 
 // ProcessEmbeddings - Processes embeddings for all unconsolidated nodes in batch
 func (h *Handler) ProcessEmbeddings(c *gin.Context) {
-	err := h.processNodeEmbeddingsInBatch(c.Request.Context())
+	report, err := h.processNodeEmbeddingsInBatch(c.Request.Context())
 	if err != nil {
 		log.Printf("Error processing embeddings: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process embeddings: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully processed embeddings for all unconsolidated nodes"})
+	message := "Successfully processed embeddings for all unconsolidated nodes"
+	if len(report.Failures) > 0 {
+		message = fmt.Sprintf("Processed embeddings; %d of %d nodes failed and will be retried next time", len(report.Failures), report.Nodes)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  message,
+		"nodes":    report.Nodes,
+		"embedded": report.Embedded,
+		"failures": report.Failures,
+	})
 }
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/markdown"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const maxImportUploadBytes = 64 << 20 // 64 MiB across all uploaded files
+
+// ImportNarratives - Imports Markdown posts with YAML front matter as narratives.
+// Accepts a multipart form with one or more "files" (.md, or .zip/.tar/.tar.gz archives of .md files).
+// Set the "analyze" form field or query parameter to true to queue analysis of newly created narratives.
+func (h *Handler) ImportNarratives(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportUploadBytes)
+	form, err := c.MultipartForm()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a multipart form with Markdown files or an archive: " + err.Error()})
+		return
+	}
+
+	var files []markdown.File
+	for _, header := range form.File["files"] {
+		uploaded, err := readUploadedMarkdown(header)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		files = append(files, uploaded...)
+	}
+
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No Markdown files found in the upload"})
+		return
+	}
+
+	analyze := c.Query("analyze") == "true" || c.PostForm("analyze") == "true"
+	report := h.ImportMarkdownFiles(c.Request.Context(), files, c.GetString("userID"), analyze, false)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Imported %d Markdown files", len(files)),
+		"report":  report,
+	})
+}
+
+// readUploadedMarkdown returns the Markdown files contained in one uploaded file or archive
+func readUploadedMarkdown(header *multipart.FileHeader) ([]markdown.File, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", header.Filename, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", header.Filename, err)
+	}
+
+	switch {
+	case markdown.IsArchive(header.Filename):
+		return markdown.ReadArchive(header.Filename, data)
+	case markdown.IsMarkdown(header.Filename):
+		return []markdown.File{{Path: header.Filename, Data: data}}, nil
+	}
+	return nil, fmt.Errorf("unsupported file type: %s", header.Filename)
+}
+
+// ImportMarkdownFiles parses Markdown files and creates a narrative for each new post. Posts are matched
+// to existing narratives by slug, then by content hash: an unchanged post is skipped, a changed post with a
+// known slug updates its narrative in place and marks it pending analysis again. When analyze is set, created
+// and updated narratives are analyzed in the background, or before returning when wait is also set.
+// Revisions are attributed to editorID.
+func (h *Handler) ImportMarkdownFiles(ctx context.Context, files []markdown.File, editorID string, analyze, wait bool) models.ImportReport {
+	var report models.ImportReport
+	var pending []*models.Narrative // Created or updated, so their current content needs analysis
+
+	for _, file := range files {
+		result := models.ImportFileResult{Path: file.Path}
+
+		doc, err := markdown.Parse(file.Path, file.Data)
+		if err != nil {
+			result.Status = "failed"
+			result.Reason = err.Error()
+			report.Failed++
+			report.Files = append(report.Files, result)
+			continue
+		}
+		result.Slug = doc.Slug
+
+		narrative, status, reason, err := h.importMarkdownDocument(ctx, doc, editorID)
+		if err != nil {
+			log.Printf("Error importing %s: %v", file.Path, err)
+			result.Status = "failed"
+			result.Reason = err.Error()
+			report.Failed++
+			report.Files = append(report.Files, result)
+			continue
+		}
+
+		result.NarrativeID = narrative.ID
+		result.Status = status
+		result.Reason = reason
+		switch status {
+		case "created":
+			report.Created++
+			pending = append(pending, narrative)
+		case "updated":
+			report.Updated++
+			pending = append(pending, narrative)
+		case "skipped":
+			report.Skipped++
+		}
+		report.Files = append(report.Files, result)
+	}
+
+	if analyze && len(pending) > 0 {
+		report.AnalysisQueued = len(pending)
+		if wait {
+			report.AwaitingApproval = h.analyzeImportedNarratives(ctx, pending)
+		} else {
+			// The request context ends with the response, so the queued batch runs on its own
+			go h.analyzeImportedNarratives(context.Background(), pending)
+		}
+	}
+
+	return report
+}
+
+// analyzeImportedNarratives analyzes imported narratives and returns how many nodes now await approval in the
+// staging area before consolidation will consume them
+func (h *Handler) analyzeImportedNarratives(ctx context.Context, narratives []*models.Narrative) int {
+	options, err := newAnalysisOptions("", nil, "")
+	if err != nil {
+		log.Printf("Warning: Analyzing imported narratives with default options: %v", err)
+	}
+	outcomes := h.analyzeNarrativesInBatch(ctx, narratives, 0, 0, options)
+	for _, outcome := range outcomes {
+		if outcome.Status == "failed" {
+			log.Printf("Analysis of imported narrative %s failed: %s", outcome.NarrativeID, outcome.Error)
+		}
+	}
+	awaiting, err := h.countNodesAwaitingApproval(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to count nodes awaiting approval: %v", err)
+	}
+	log.Printf("Finished analysis of %d imported narratives; %d nodes await approval in the staging area", len(outcomes), awaiting)
+	return awaiting
+}
+
+// importMarkdownDocument creates, updates or skips the narrative for one parsed document
+func (h *Handler) importMarkdownDocument(ctx context.Context, doc *markdown.Document, editorID string) (*models.Narrative, string, string, error) {
+	hash := contentHash(doc.Content)
+
+	// Re-import of a known post: update only when its content changed
+	records, err := h.db.ExecuteRead(ctx, `MATCH (n:Narrative {slug: $slug}) RETURN n.id, n.content_hash LIMIT 1`,
+		map[string]interface{}{"slug": doc.Slug})
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(records) > 0 {
+		existingID := getStringValue(records[0], "n.id")
+		if getStringValue(records[0], "n.content_hash") == hash {
+			return &models.Narrative{ID: existingID}, "skipped", "unchanged since last import", nil
+		}
+
+		if _, err := h.updateNarrativeContent(ctx, existingID, doc.Title, doc.Content, editorID, 0); err != nil {
+			return nil, "", "", err
+		}
+		// The new content has not been analyzed, so the narrative is pending again
+		query := `MATCH (n:Narrative {id: $id}) SET n.tags = $tags, n.extrapolated = false`
+		if _, err := h.db.ExecuteQuery(ctx, query, map[string]interface{}{"id": existingID, "tags": nonNilTags(doc.Tags)}); err != nil {
+			return nil, "", "", err
+		}
+		// What was extracted from the previous content is replaced by the re-analysis; consolidated concepts
+		// keep its support until the narrative is retracted, so the report says how many still rely on it
+		var deletion NarrativeDeletionReport
+		if err := h.deleteUnconsolidatedDerived(ctx, existingID, &deletion); err != nil {
+			return nil, "", "", err
+		}
+		reason := "content changed since last import"
+		if deletion.UnconsolidatedNodesDeleted > 0 || deletion.UnconsolidatedRelationshipsDeleted > 0 {
+			reason += fmt.Sprintf("; deleted %d unconsolidated nodes and %d relationships extracted from the previous content",
+				deletion.UnconsolidatedNodesDeleted, deletion.UnconsolidatedRelationshipsDeleted)
+		}
+		staleNodes, staleRelationships, err := h.countConsolidatedSupport(ctx, existingID)
+		if err != nil {
+			log.Printf("Warning: Failed to count consolidated support of narrative %s: %v", existingID, err)
+		} else if staleNodes > 0 || staleRelationships > 0 {
+			reason += fmt.Sprintf("; %d consolidated nodes and %d relationships are still supported by the previous content",
+				staleNodes, staleRelationships)
+		}
+
+		narrative, err := h.getNarrativeByIDFromDB(ctx, existingID)
+		if err != nil {
+			return nil, "", "", err
+		}
+		return narrative, "updated", reason, nil
+	}
+
+	// The same text may already exist under another slug or without one
+	records, err = h.db.ExecuteRead(ctx, `MATCH (n:Narrative {content_hash: $content_hash}) RETURN n.id LIMIT 1`,
+		map[string]interface{}{"content_hash": hash})
+	if err != nil {
+		return nil, "", "", err
+	}
+	if len(records) > 0 {
+		existingID := getStringValue(records[0], "n.id")
+		return &models.Narrative{ID: existingID}, "skipped", "duplicate content of narrative " + existingID, nil
+	}
+
+	now := time.Now()
+	createdAt := doc.Date
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	narrative := &models.Narrative{
+		ID:           fmt.Sprintf("narrative_%d", time.Now().UnixNano()),
+		Title:        doc.Title,
+		Content:      doc.Content,
+		Extrapolated: false,
+		Slug:         doc.Slug,
+		Tags:         doc.Tags,
+		CreatedAt:    createdAt,
+		UpdatedAt:    now,
+	}
+	if err := h.createNarrativeInDB(ctx, narrative, map[string]interface{}{
+		"source_path": doc.SourcePath,
+		"imported_at": now.Format(time.RFC3339),
+	}); err != nil {
+		return nil, "", "", err
+	}
+	if _, err := h.recordNarrativeRevision(ctx, narrative.ID, editorID, 0); err != nil {
+		log.Printf("Warning: Failed to record initial revision of narrative %s: %v", narrative.ID, err)
+	}
+	return narrative, "created", "", nil
+}
+
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLLMCacheDir = ".llm-cache"
+	defaultLLMCacheTTL = 7 * 24 * time.Hour
+)
+
+// =============================================================================
+// LLM RESPONSE CACHE - CONTENT-ADDRESSED GENERATIONS AND EMBEDDINGS
+// =============================================================================
+
+// llmCacheFromEnv returns the cache store selected by LLM_CACHE ("off" by default, "disk" or "graph") and the
+// TTL from LLM_CACHE_TTL (a Go duration, default 168h, "0" never expires). Disk entries live in LLM_CACHE_DIR.
+func llmCacheFromEnv(db *database.DB) (llm.CacheStore, time.Duration, error) {
+	ttl := defaultLLMCacheTTL
+	if ttlValue := os.Getenv("LLM_CACHE_TTL"); ttlValue != "" {
+		parsed, err := time.ParseDuration(ttlValue)
+		if err != nil || parsed < 0 {
+			return nil, 0, fmt.Errorf("invalid LLM_CACHE_TTL %q", ttlValue)
+		}
+		ttl = parsed
+	}
+
+	switch mode := strings.ToLower(os.Getenv("LLM_CACHE")); mode {
+	case "", "off":
+		return nil, 0, nil
+	case "disk":
+		dir := os.Getenv("LLM_CACHE_DIR")
+		if dir == "" {
+			dir = defaultLLMCacheDir
+		}
+		store, err := llm.NewDiskCache(dir)
+		return store, ttl, err
+	case "graph":
+		return &llmCacheStore{db: db}, ttl, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown LLM_CACHE %q: use off, disk or graph", mode)
+	}
+}
+
+// llmCacheStore keeps cache entries as LLMCacheEntry nodes
+type llmCacheStore struct {
+	db *database.DB
+}
+
+func (s *llmCacheStore) Get(ctx context.Context, key string) (*llm.CacheEntry, error) {
+	query := `MATCH (e:LLMCacheEntry {key: $key})
+		RETURN e.kind as kind, e.model as model, e.value as value, e.created_at as created_at, e.expires_at as expires_at`
+	records, err := s.db.ExecuteRead(ctx, query, map[string]interface{}{"key": key})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	record := records[0]
+	entry := &llm.CacheEntry{
+		Key:   key,
+		Kind:  getStringValue(record, "kind"),
+		Model: getStringValue(record, "model"),
+		Value: []byte(getStringValue(record, "value")),
+	}
+	entry.CreatedAt, _ = time.Parse(time.RFC3339, getStringValue(record, "created_at"))
+	entry.ExpiresAt, _ = time.Parse(time.RFC3339, getStringValue(record, "expires_at"))
+	return entry, nil
+}
+
+func (s *llmCacheStore) Put(ctx context.Context, entry llm.CacheEntry) error {
+	query := `MERGE (e:LLMCacheEntry {key: $key})
+		SET e.kind = $kind, e.model = $model, e.value = $value, e.created_at = $created_at, e.expires_at = $expires_at`
+	params := map[string]interface{}{
+		"key":        entry.Key,
+		"kind":       entry.Kind,
+		"model":      entry.Model,
+		"value":      string(entry.Value),
+		"created_at": entry.CreatedAt.UTC().Format(time.RFC3339),
+		"expires_at": nil,
+	}
+	if !entry.ExpiresAt.IsZero() {
+		params["expires_at"] = entry.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	_, err := s.db.ExecuteQuery(ctx, query, params)
+	return err
+}
+
+func (s *llmCacheStore) Invalidate(ctx context.Context, filter llm.CacheFilter) (int, error) {
+	query := `MATCH (e:LLMCacheEntry)
+		WHERE ($kind IS NULL OR e.kind = $kind)
+		  AND ($model IS NULL OR e.model = $model)
+		  AND (NOT $expired_only OR (e.expires_at IS NOT NULL AND e.expires_at <= $now))
+		  AND ($created_before IS NULL OR e.created_at < $created_before)
+		DELETE e
+		RETURN count(e) as deleted`
+	params := map[string]interface{}{
+		"kind":           nilIfEmpty(filter.Kind),
+		"model":          nilIfEmpty(filter.Model),
+		"expired_only":   filter.ExpiredOnly,
+		"now":            time.Now().UTC().Format(time.RFC3339),
+		"created_before": nil,
+	}
+	if !filter.CreatedBefore.IsZero() {
+		params["created_before"] = filter.CreatedBefore.UTC().Format(time.RFC3339)
+	}
+	records, err := s.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return 0, err
+	}
+	return int(countFromRecords(records, "deleted")), nil
+}
+
+// CacheBypassMiddleware lets a request skip cached LLM and embedding responses with a Cache-Control: no-cache
+// header or a no_cache=true query parameter. Responses fetched while bypassing still refresh the cache.
+func CacheBypassMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noCache, _ := strconv.ParseBool(c.Query("no_cache"))
+		if noCache || strings.Contains(strings.ToLower(c.GetHeader("Cache-Control")), "no-cache") {
+			c.Request = c.Request.WithContext(llm.WithCacheBypass(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+// InvalidateLLMCache - Deletes cached LLM and embedding responses.
+// Query parameters: kind (generate/embed), model, expired (true deletes only expired entries) and before
+// (RFC3339 or YYYY-MM-DD, deletes entries created earlier). Without parameters the whole cache is cleared.
+func (h *Handler) InvalidateLLMCache(c *gin.Context) {
+	if h.cache == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "LLM cache is disabled; set LLM_CACHE to disk or graph"})
+		return
+	}
+
+	filter := llm.CacheFilter{Kind: c.Query("kind"), Model: c.Query("model")}
+	if filter.Kind != "" && filter.Kind != llm.CallKindGenerate && filter.Kind != llm.CallKindEmbed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be generate or embed"})
+		return
+	}
+	if expiredParam := c.Query("expired"); expiredParam != "" {
+		expired, err := strconv.ParseBool(expiredParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expired must be true or false"})
+			return
+		}
+		filter.ExpiredOnly = expired
+	}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := parseAuditTime(beforeParam, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before " + err.Error()})
+			return
+		}
+		filter.CreatedBefore, _ = time.Parse(time.RFC3339, before.(string))
+	}
+
+	deleted, err := h.cache.Invalidate(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate LLM cache: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "LLM cache invalidated",
+		"invalidated": deleted,
+	})
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLLMCallLimit = 50
+	maxLLMCallLimit     = 500
+)
+
+// =============================================================================
+// LLM CALL AUDIT LOG - EVERY GENERATION AND EMBEDDING REQUEST AS AN LLMCall NODE
+// =============================================================================
+
+// llmCallStore persists audit records as LLMCall nodes
+type llmCallStore struct {
+	db *database.DB
+}
+
+func (s *llmCallStore) SaveCall(ctx context.Context, call *llm.Call) error {
+	query := `CREATE (c:LLMCall {
+		id: $id, kind: $kind, purpose: $purpose, model: $model,
+		narrative_id: $narrative_id, node_ids: $node_ids, prompt_version: $prompt_version,
+		system_prompt: $system_prompt, user_prompt: $user_prompt, texts: $texts,
+		response: $response, vectors: $vectors, dimensions: $dimensions, parse_outcome: $parse_outcome,
+		prompt_tokens: $prompt_tokens, candidates_tokens: $candidates_tokens, total_tokens: $total_tokens,
+		latency_ms: $latency_ms, error: $error, error_status: $error_status, created_at: $created_at
+	})`
+	params := map[string]interface{}{
+		"id":                call.ID,
+		"kind":              call.Kind,
+		"purpose":           call.Purpose,
+		"model":             call.Model,
+		"narrative_id":      nilIfEmpty(call.NarrativeID),
+		"node_ids":          call.NodeIDs,
+		"prompt_version":    nilIfEmpty(call.PromptVersion),
+		"system_prompt":     nilIfEmpty(call.SystemPrompt),
+		"user_prompt":       nilIfEmpty(call.UserPrompt),
+		"texts":             call.Texts,
+		"response":          nilIfEmpty(call.Response),
+		"vectors":           call.Vectors,
+		"dimensions":        call.Dimensions,
+		"parse_outcome":     nilIfEmpty(call.ParseOutcome),
+		"prompt_tokens":     call.Usage.PromptTokens,
+		"candidates_tokens": call.Usage.CandidatesTokens,
+		"total_tokens":      call.Usage.TotalTokens,
+		"latency_ms":        call.LatencyMs,
+		"error":             nilIfEmpty(call.Error),
+		"error_status":      call.ErrorStatus,
+		"created_at":        call.CreatedAt.Format(time.RFC3339),
+	}
+	_, err := s.db.ExecuteQuery(ctx, query, params)
+	return err
+}
+
+// recordParseOutcome notes on the audit record of a generation whether its text could be parsed
+func (h *Handler) recordParseOutcome(ctx context.Context, response *llm.Response, parseErr error) {
+	if h.db == nil || response == nil || response.CallID == "" {
+		return
+	}
+	params := map[string]interface{}{"id": response.CallID, "outcome": llm.ParseOK, "parse_error": nil}
+	if parseErr != nil {
+		params["outcome"] = llm.ParseFailed
+		params["parse_error"] = parseErr.Error()
+	}
+	query := `MATCH (c:LLMCall {id: $id}) SET c.parse_outcome = $outcome, c.parse_error = $parse_error`
+	if _, err := h.db.ExecuteQuery(context.WithoutCancel(ctx), query, params); err != nil {
+		log.Printf("Warning: Failed to record parse outcome of LLM call %s: %v", response.CallID, err)
+	}
+}
+
+// ListLLMCalls - Lists audited LLM and embedding calls, newest first, without prompts or responses.
+// Query parameters: narrative_id, node_id, purpose, kind (generate/embed), from and to (RFC3339 or
+// YYYY-MM-DD; a date-only to includes that whole day), limit (default 50) and offset.
+func (h *Handler) ListLLMCalls(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	from, err := parseAuditTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from " + err.Error()})
+		return
+	}
+	to, err := parseAuditTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to " + err.Error()})
+		return
+	}
+
+	limit, offset, err := parsePagination(c, defaultLLMCallLimit, maxLLMCallLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := map[string]interface{}{
+		"narrative_id": nilIfEmpty(c.Query("narrative_id")),
+		"node_id":      nilIfEmpty(c.Query("node_id")),
+		"purpose":      nilIfEmpty(c.Query("purpose")),
+		"kind":         nilIfEmpty(c.Query("kind")),
+		"from":         from,
+		"to":           to,
+		"limit":        limit,
+		"offset":       offset,
+	}
+	filter := `MATCH (c:LLMCall)
+		WHERE ($narrative_id IS NULL OR c.narrative_id = $narrative_id)
+		  AND ($node_id IS NULL OR $node_id IN COALESCE(c.node_ids, []))
+		  AND ($purpose IS NULL OR c.purpose = $purpose)
+		  AND ($kind IS NULL OR c.kind = $kind)
+		  AND ($from IS NULL OR c.created_at >= $from)
+		  AND ($to IS NULL OR c.created_at < $to)`
+
+	totalsQuery := filter + `
+		RETURN count(c) as calls,
+		       sum(CASE WHEN c.error IS NOT NULL THEN 1 ELSE 0 END) as errors,
+		       sum(CASE WHEN c.parse_outcome = 'failed' THEN 1 ELSE 0 END) as parse_failures,
+		       sum(COALESCE(c.prompt_tokens, 0)) as prompt_tokens,
+		       sum(COALESCE(c.candidates_tokens, 0)) as candidates_tokens,
+		       sum(COALESCE(c.total_tokens, 0)) as total_tokens,
+		       sum(COALESCE(c.latency_ms, 0)) as latency_ms`
+	totalRecords, err := h.db.ExecuteRead(ctx, totalsQuery, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to total LLM calls: " + err.Error()})
+		return
+	}
+
+	listQuery := filter + `
+		RETURN c.id as id, c.kind as kind, c.purpose as purpose, c.model as model,
+		       c.narrative_id as narrative_id, c.node_ids as node_ids, c.prompt_version as prompt_version,
+		       c.vectors as vectors, c.dimensions as dimensions,
+		       c.parse_outcome as parse_outcome, c.parse_error as parse_error,
+		       c.prompt_tokens as prompt_tokens, c.candidates_tokens as candidates_tokens, c.total_tokens as total_tokens,
+		       c.latency_ms as latency_ms, c.error as error, c.error_status as error_status, c.created_at as created_at
+		ORDER BY c.created_at DESC
+		SKIP $offset LIMIT $limit`
+	records, err := h.db.ExecuteRead(ctx, listQuery, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list LLM calls: " + err.Error()})
+		return
+	}
+
+	calls := make([]llm.Call, 0, len(records))
+	for _, record := range records {
+		calls = append(calls, llmCallFromRecord(record))
+	}
+
+	totals := gin.H{}
+	if len(totalRecords) > 0 {
+		for _, key := range []string{"calls", "errors", "parse_failures", "prompt_tokens", "candidates_tokens", "total_tokens", "latency_ms"} {
+			totals[key] = getInt64Value(totalRecords[0], key)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"calls":  calls,
+		"totals": totals,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetLLMCall - Reads one audited call including its prompts, texts and raw response
+func (h *Handler) GetLLMCall(c *gin.Context) {
+	query := `MATCH (c:LLMCall {id: $id})
+		RETURN c.id as id, c.kind as kind, c.purpose as purpose, c.model as model,
+		       c.narrative_id as narrative_id, c.node_ids as node_ids, c.prompt_version as prompt_version,
+		       c.system_prompt as system_prompt, c.user_prompt as user_prompt, c.texts as texts,
+		       c.response as response, c.vectors as vectors, c.dimensions as dimensions,
+		       c.parse_outcome as parse_outcome, c.parse_error as parse_error,
+		       c.prompt_tokens as prompt_tokens, c.candidates_tokens as candidates_tokens, c.total_tokens as total_tokens,
+		       c.latency_ms as latency_ms, c.error as error, c.error_status as error_status, c.created_at as created_at`
+	records, err := h.db.ExecuteRead(c.Request.Context(), query, map[string]interface{}{"id": c.Param("id")})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "LLM call not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, llmCallFromRecord(records[0]))
+}
+
+func llmCallFromRecord(record map[string]interface{}) llm.Call {
+	call := llm.Call{
+		ID:            getStringValue(record, "id"),
+		Kind:          getStringValue(record, "kind"),
+		Purpose:       getStringValue(record, "purpose"),
+		Model:         getStringValue(record, "model"),
+		NarrativeID:   getStringValue(record, "narrative_id"),
+		NodeIDs:       getStringList(record, "node_ids"),
+		PromptVersion: getStringValue(record, "prompt_version"),
+		SystemPrompt:  getStringValue(record, "system_prompt"),
+		UserPrompt:    getStringValue(record, "user_prompt"),
+		Texts:         getStringList(record, "texts"),
+		Response:      getStringValue(record, "response"),
+		Vectors:       int(getInt64Value(record, "vectors")),
+		Dimensions:    int(getInt64Value(record, "dimensions")),
+		ParseOutcome:  getStringValue(record, "parse_outcome"),
+		ParseError:    getStringValue(record, "parse_error"),
+		Usage: llm.Usage{
+			PromptTokens:     int(getInt64Value(record, "prompt_tokens")),
+			CandidatesTokens: int(getInt64Value(record, "candidates_tokens")),
+			TotalTokens:      int(getInt64Value(record, "total_tokens")),
+		},
+		LatencyMs:   getInt64Value(record, "latency_ms"),
+		Error:       getStringValue(record, "error"),
+		ErrorStatus: int(getInt64Value(record, "error_status")),
+	}
+	call.CreatedAt, _ = time.Parse(time.RFC3339, getStringValue(record, "created_at"))
+	return call
+}
+
+// parsePagination reads the limit and offset query parameters, capping limit at maxLimit
+func parsePagination(c *gin.Context, defaultLimit, maxLimit int) (int, int, error) {
+	limit := defaultLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		value, err := strconv.Atoi(limitParam)
+		if err != nil || value <= 0 {
+			return 0, 0, fmt.Errorf("limit must be a positive number")
+		}
+		limit = min(value, maxLimit)
+	}
+	offset := 0
+	if offsetParam := c.Query("offset"); offsetParam != "" {
+		value, err := strconv.Atoi(offsetParam)
+		if err != nil || value < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number")
+		}
+		offset = value
+	}
+	return limit, offset, nil
+}
+
+func getInt64Value(record map[string]interface{}, key string) int64 {
+	value, _ := record[key].(int64)
+	return value
+}
+
+// getStringList reads a list of strings from a record, skipping anything that is not a string
+func getStringList(record map[string]interface{}, key string) []string {
+	values, ok := record[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// parseAuditTime converts an RFC3339 timestamp or YYYY-MM-DD date to the UTC form created_at is stored in.
+// A date-only end bound moves to the start of the next day so the whole day is included.
+func parseAuditTime(value string, endOfDay bool) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, errors.New("must be an RFC3339 timestamp or a YYYY-MM-DD date")
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
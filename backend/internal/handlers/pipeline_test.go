@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+// pipelineFixtures holds the model responses the pipeline test replays. They are hand-written in the
+// recorded format: LLM_FIXTURES=record replaces them with real responses, after which the expected graph
+// below has to be updated to whatever the models extracted.
+const pipelineFixtures = "testdata/pipeline"
+
+// pipelineNarratives describe the same system, stock and flow in identical words, so consolidation merges
+// exactly those three pairs and keeps everything else apart
+var pipelineNarratives = []models.Narrative{
+	{
+		ID:    "narrative_pipeline_1",
+		Title: "Shipping Fast",
+		Content: "Our team ships features as fast as it can. Every shortcut adds to our technical debt, and the debt " +
+			"slows each new feature down. A sprint of refactoring brought the debt down again.",
+	},
+	{
+		ID:    "narrative_pipeline_2",
+		Title: "Refactoring Sprint",
+		Content: "We spent a whole sprint refactoring the oldest modules. Paying down the technical debt felt good, " +
+			"and the team's morale rose as the code got easier to work with.",
+	},
+}
+
+// pipelineNode is a System, Stock or Flow as the pipeline test expects to find it after consolidation
+type pipelineNode struct {
+	Label        string
+	Name         string
+	Description  string
+	Consolidated bool
+	Sources      int // Number of narratives the node was consolidated from
+}
+
+// TestPipelineReplaysRecordedFixtures analyzes, embeds and consolidates two narratives against a real
+// Neo4j database, answering every model call from the recorded fixtures. Set NEO4J_TEST_URI (and
+// NEO4J_USER and NEO4J_PASSWORD when they differ from the defaults) to a disposable database to run it:
+// everything in that database is deleted first.
+func TestPipelineReplaysRecordedFixtures(t *testing.T) {
+	t.Setenv("STAGING_AUTO_APPROVE", "true")
+	ctx := context.Background()
+	db := testDatabase(t)
+	h := pipelineHandler(t, db)
+
+	// --- Analyze ---
+	narratives := make([]*models.Narrative, len(pipelineNarratives))
+	for i := range pipelineNarratives {
+		narrative := pipelineNarratives[i]
+		narrative.CreatedAt, narrative.UpdatedAt = time.Now(), time.Now()
+		if err := h.createNarrativeInDB(ctx, &narrative, nil); err != nil {
+			t.Fatalf("createNarrativeInDB() error = %v", err)
+		}
+		narratives[i] = &narrative
+	}
+	options, err := newAnalysisOptions(ExtractionModeJSON, nil, CriticOff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One narrative at a time, so the second is analyzed after the first whatever the scheduling
+	outcomes := h.analyzeNarrativesInBatch(ctx, narratives, 1, 600, options)
+
+	wantOutcomes := []NarrativeAnalysisOutcome{
+		{SystemsCreated: 1, StocksCreated: 2, FlowsCreated: 2, RelationshipsCreated: 8},
+		{SystemsCreated: 1, StocksCreated: 2, FlowsCreated: 1, RelationshipsCreated: 6},
+	}
+	for i, outcome := range outcomes {
+		if outcome.Status != "succeeded" {
+			t.Fatalf("analysis of %s %s: %s", outcome.NarrativeID, outcome.Status, outcome.Error)
+		}
+		want := wantOutcomes[i]
+		if outcome.SystemsCreated != want.SystemsCreated || outcome.StocksCreated != want.StocksCreated ||
+			outcome.FlowsCreated != want.FlowsCreated || outcome.RelationshipsCreated != want.RelationshipsCreated {
+			t.Errorf("analysis of %s created %d systems, %d stocks, %d flows and %d relationships, want %d, %d, %d and %d",
+				outcome.NarrativeID, outcome.SystemsCreated, outcome.StocksCreated, outcome.FlowsCreated, outcome.RelationshipsCreated,
+				want.SystemsCreated, want.StocksCreated, want.FlowsCreated, want.RelationshipsCreated)
+		}
+	}
+
+	// --- Embed ---
+	report, err := h.processNodeEmbeddingsInBatch(ctx)
+	if err != nil {
+		t.Fatalf("processNodeEmbeddingsInBatch() error = %v", err)
+	}
+	if report.Embedded != 9 || len(report.Failures) != 0 {
+		t.Fatalf("embedded %d nodes with failures %+v, want 9 and none", report.Embedded, report.Failures)
+	}
+
+	// --- Consolidate ---
+	performed, synthesisFailures, err := h.runConsolidation(ctx)
+	if err != nil {
+		t.Fatalf("runConsolidation() error = %v", err)
+	}
+	if len(synthesisFailures) != 0 {
+		t.Errorf("synthesis failures = %+v, want none", synthesisFailures)
+	}
+	// Three merges, each with the promotion of the node it merged into, and three lone promotions
+	if performed != 9 {
+		t.Errorf("consolidations performed = %d, want 9", performed)
+	}
+
+	records, err := h.db.ExecuteRead(ctx, `
+		MATCH (n) WHERE n:System OR n:Stock OR n:Flow
+		RETURN labels(n)[0] as label, n.name as name, COALESCE(n.description, n.boundary_description) as description,
+			n.consolidated as consolidated, size(COALESCE(n.source_narratives, [])) as sources
+		ORDER BY label, name`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The merged pairs carry the synthesized descriptions; the rest keep the extracted ones
+	wantNodes := []pipelineNode{
+		{"Flow", "Code Refactoring", "Restructuring existing code to pay down accumulated technical debt.", true, 2},
+		{"Flow", "Shortcut Implementation", "Delivering features through expedient but suboptimal solutions.", true, 1},
+		{"Stock", "Delivery Velocity", "Rate at which new features are completed and released.", true, 1},
+		{"Stock", "Team Morale", "Collective motivation and satisfaction of a development team.", true, 1},
+		{"Stock", "Technical Debt", "Accumulated cost of shortcuts that slows later development.", true, 2},
+		{"System", "Software Development Lifecycle", "Process by which a team plans, builds and ships software.", true, 2},
+	}
+	var gotNodes []pipelineNode
+	for _, record := range records {
+		consolidated, _ := record["consolidated"].(bool)
+		sources, _ := record["sources"].(int64)
+		gotNodes = append(gotNodes, pipelineNode{
+			Label:        getStringValue(record, "label"),
+			Name:         getStringValue(record, "name"),
+			Description:  getStringValue(record, "description"),
+			Consolidated: consolidated,
+			Sources:      int(sources),
+		})
+	}
+	if len(gotNodes) != len(wantNodes) {
+		t.Fatalf("nodes = %+v, want %+v", gotNodes, wantNodes)
+	}
+	for i := range wantNodes {
+		if gotNodes[i] != wantNodes[i] {
+			t.Errorf("node %d = %+v, want %+v", i, gotNodes[i], wantNodes[i])
+		}
+	}
+
+	// Duplicated relationships collapse onto the merged nodes and every relationship is consolidated
+	records, err = h.db.ExecuteRead(ctx, `
+		MATCH ()-[r]->()
+		RETURN type(r) as type, count(r) as total, count(CASE WHEN r.consolidated = true THEN 1 END) as consolidated`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRelationships := map[string]int64{
+		"DESCRIBES":         2,
+		"DESCRIBES_STATIC":  3,
+		"DESCRIBES_DYNAMIC": 2,
+		"CHANGES":           2,
+		"CAUSAL_LINK":       2,
+	}
+	gotRelationships := make(map[string]int64)
+	for _, record := range records {
+		relType := getStringValue(record, "type")
+		total, _ := record["total"].(int64)
+		consolidated, _ := record["consolidated"].(int64)
+		gotRelationships[relType] = total
+		if consolidated != total {
+			t.Errorf("%d of %d %s relationships are consolidated, want all", consolidated, total, relType)
+		}
+	}
+	for relType, want := range wantRelationships {
+		if gotRelationships[relType] != want {
+			t.Errorf("%s relationships = %d, want %d", relType, gotRelationships[relType], want)
+		}
+	}
+	if len(gotRelationships) != len(wantRelationships) {
+		t.Errorf("relationship types = %v, want %v", gotRelationships, wantRelationships)
+	}
+}
+
+// pipelineHandler replays the pipeline fixtures, or with LLM_FIXTURES=record records them anew through the
+// models configured in the environment
+func pipelineHandler(t *testing.T, db *database.DB) *Handler {
+	t.Helper()
+	if os.Getenv("LLM_FIXTURES") == llm.FixtureRecord {
+		dir, err := filepath.Abs(pipelineFixtures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("LLM_FIXTURES_DIR", dir)
+		return NewHandler(db)
+	}
+	fixtures, err := llm.NewFixtures(pipelineFixtures, llm.FixtureReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandlerWithProvider(db, fixtures.Provider(nil), fixtures.Embedder(nil))
+}
+
+// testDatabase connects to the disposable database named by NEO4J_TEST_URI, skipping the test when it is not
+// set, and returns it wiped and migrated
+func testDatabase(t *testing.T) *database.DB {
+	t.Helper()
+	uri := os.Getenv("NEO4J_TEST_URI")
+	if uri == "" {
+		t.Skip("NEO4J_TEST_URI is not set; this test needs a disposable Neo4j database")
+	}
+	t.Setenv("NEO4J_URI", uri)
+	ctx := context.Background()
+
+	db := database.NewDB()
+	t.Cleanup(func() { db.Close(ctx) })
+	if _, err := db.ExecuteRead(ctx, `MATCH (n) DETACH DELETE n`, nil); err != nil {
+		t.Fatalf("failed to wipe the test database: %v", err)
+	}
+	if err := db.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return db
+}
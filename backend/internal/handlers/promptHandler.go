@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// PROMPT REGISTRY HANDLERS - VERSIONED PROMPT TEMPLATES STORED AS PromptVersion NODES
+// =============================================================================
+
+// PromptVersion is a stored prompt template version with its activation state
+type PromptVersion struct {
+	prompts.Template
+	Active          bool   `json:"active"`
+	PreviousVersion string `json:"previousVersion,omitempty"` // Version that was active before this one was activated
+	CreatedAt       string `json:"createdAt"`
+	ActivatedAt     string `json:"activatedAt,omitempty"`
+}
+
+// CreatePromptVersionRequest is the body of CreatePromptVersion
+type CreatePromptVersionRequest struct {
+	Version  string `json:"version" binding:"required"`
+	System   string `json:"system" binding:"required"`
+	User     string `json:"user" binding:"required"`
+	Activate bool   `json:"activate"`
+}
+
+// SyncPrompts stores the built-in templates and those under PROMPTS_DIR as PromptVersion nodes and makes sure
+// every prompt name has an active version. Stored versions are immutable: a file whose text differs from
+// the stored version of the same name is ignored with a warning.
+func (h *Handler) SyncPrompts(ctx context.Context) error {
+	templates, err := prompts.Builtin()
+	if err != nil {
+		return fmt.Errorf("failed to load built-in prompts: %v", err)
+	}
+	if dir := os.Getenv("PROMPTS_DIR"); dir != "" {
+		fileTemplates, err := prompts.LoadDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to load prompts from %s: %v", dir, err)
+		}
+		templates = append(templates, fileTemplates...)
+	}
+
+	for _, template := range templates {
+		query := `MERGE (p:PromptVersion {name: $name, version: $version})
+			ON CREATE SET p.system = $system, p.user = $user, p.source = $source, p.active = false, p.created_at = $created_at
+			RETURN p.system = $system AND p.user = $user as unchanged`
+		params := map[string]interface{}{
+			"name":       template.Name,
+			"version":    template.Version,
+			"system":     template.System,
+			"user":       template.User,
+			"source":     template.Source,
+			"created_at": time.Now().Format(time.RFC3339),
+		}
+		records, err := h.db.ExecuteRead(ctx, query, params)
+		if err != nil {
+			return fmt.Errorf("failed to store prompt %s: %v", template.Ref(), err)
+		}
+		if len(records) > 0 {
+			if unchanged, _ := records[0]["unchanged"].(bool); !unchanged {
+				log.Printf("Warning: Prompt %s from %s differs from the stored version and was ignored; add a new version instead", template.Ref(), template.Source)
+			}
+		}
+	}
+
+	for name := range prompts.Specs {
+		query := `MATCH (p:PromptVersion {name: $name, version: $version})
+			WHERE NOT EXISTS { MATCH (:PromptVersion {name: $name, active: true}) }
+			SET p.active = true, p.activated_at = $activated_at`
+		params := map[string]interface{}{
+			"name":         name,
+			"version":      prompts.DefaultVersion,
+			"activated_at": time.Now().Format(time.RFC3339),
+		}
+		if _, err := h.db.ExecuteQuery(ctx, query, params); err != nil {
+			return fmt.Errorf("failed to activate default %s prompt: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// activePrompt returns the active version of a named prompt, falling back to the built-in default when
+// the registry is unavailable
+func (h *Handler) activePrompt(ctx context.Context, name string) prompts.Template {
+	if h.db == nil {
+		return prompts.BuiltinDefault(name)
+	}
+	versions, err := h.fetchPromptVersions(ctx, name, "", true)
+	if err != nil {
+		log.Printf("Warning: Using built-in %s prompt, failed to read the active version: %v", name, err)
+		return prompts.BuiltinDefault(name)
+	}
+	if len(versions) == 0 {
+		return prompts.BuiltinDefault(name)
+	}
+	return versions[0].Template
+}
+
+// ListPrompts - Lists every prompt name with its versions, newest first.
+// Template text is omitted; fetch a single version to read it.
+func (h *Handler) ListPrompts(c *gin.Context) {
+	versions, err := h.fetchPromptVersions(c.Request.Context(), "", "", false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	byName := make(map[string][]PromptVersion)
+	for name := range prompts.Specs {
+		byName[name] = []PromptVersion{}
+	}
+	for _, version := range versions {
+		version.System, version.User = "", ""
+		byName[version.Name] = append(byName[version.Name], version)
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		nameVersions := byName[name]
+		active := ""
+		for _, version := range nameVersions {
+			if version.Active {
+				active = version.Version
+			}
+		}
+		result = append(result, gin.H{
+			"name":           name,
+			"description":    prompts.Specs[name].Description,
+			"active_version": active,
+			"versions":       nameVersions,
+		})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetPromptVersion - Reads one version of a prompt including its template text
+func (h *Handler) GetPromptVersion(c *gin.Context) {
+	versions, err := h.fetchPromptVersions(c.Request.Context(), c.Param("name"), c.Param("version"), false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt version not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions[0])
+}
+
+// CreatePromptVersion - Stores a new version of a prompt, optionally activating it
+func (h *Handler) CreatePromptVersion(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req CreatePromptVersionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template := prompts.Template{Name: c.Param("name"), Version: req.Version, System: req.System, User: req.User, Source: prompts.SourceAPI}
+	if err := template.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.fetchPromptVersions(ctx, template.Name, template.Version, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(existing) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Prompt version %s already exists", template.Ref())})
+		return
+	}
+
+	query := `CREATE (p:PromptVersion {
+		name: $name, version: $version, system: $system, user: $user, source: $source,
+		active: false, created_at: $created_at, created_by: $created_by
+	})`
+	params := map[string]interface{}{
+		"name":       template.Name,
+		"version":    template.Version,
+		"system":     template.System,
+		"user":       template.User,
+		"source":     template.Source,
+		"created_at": time.Now().Format(time.RFC3339),
+		"created_by": nilIfEmpty(c.GetString("userID")),
+	}
+	if _, err := h.db.ExecuteQuery(ctx, query, params); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Activate {
+		if err := h.activatePromptVersion(ctx, template.Name, template.Version, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": fmt.Sprintf("Prompt version %s created", template.Ref()),
+		"prompt":  template.Ref(),
+		"active":  req.Activate,
+	})
+}
+
+// ActivatePromptVersion - Makes a prompt version the one used for new LLM calls
+func (h *Handler) ActivatePromptVersion(c *gin.Context) {
+	ctx := c.Request.Context()
+	name, version := c.Param("name"), c.Param("version")
+
+	versions, err := h.fetchPromptVersions(ctx, name, version, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prompt version not found"})
+		return
+	}
+
+	if err := h.activatePromptVersion(ctx, name, version, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Prompt version %s activated", versions[0].Ref()),
+		"prompt":  versions[0].Ref(),
+	})
+}
+
+// RollbackPrompt - Reactivates the version that was active before the current one.
+// Repeated rollbacks keep walking back through the activation history.
+func (h *Handler) RollbackPrompt(c *gin.Context) {
+	ctx := c.Request.Context()
+	name := c.Param("name")
+
+	active, err := h.fetchPromptVersions(ctx, name, "", true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(active) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Prompt %s has no active version", name)})
+		return
+	}
+	if active[0].PreviousVersion == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Prompt %s has no earlier version to roll back to", active[0].Ref())})
+		return
+	}
+
+	if err := h.activatePromptVersion(ctx, name, active[0].PreviousVersion, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Prompt %s rolled back from %s to %s", name, active[0].Version, active[0].PreviousVersion),
+		"from":    active[0].Version,
+		"to":      active[0].PreviousVersion,
+	})
+}
+
+// ====== PROMPT DATABASE HELPERS ======
+
+// activatePromptVersion deactivates the current version of a prompt and activates another. When
+// recordPrevious is set the replaced version is remembered for rollback; rollbacks leave it untouched
+// so that repeated rollbacks walk back through history instead of toggling.
+func (h *Handler) activatePromptVersion(ctx context.Context, name, version string, recordPrevious bool) error {
+	query := `MATCH (target:PromptVersion {name: $name, version: $version})
+		OPTIONAL MATCH (current:PromptVersion {name: $name, active: true})
+		WHERE current <> target
+		SET current.active = false
+		SET target.active = true, target.activated_at = $activated_at,
+			target.previous_version = CASE WHEN $record_previous AND current IS NOT NULL
+				THEN current.version ELSE target.previous_version END
+		RETURN target.version`
+	params := map[string]interface{}{
+		"name":            name,
+		"version":         version,
+		"activated_at":    time.Now().Format(time.RFC3339),
+		"record_previous": recordPrevious,
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return fmt.Errorf("failed to activate prompt %s@%s: %v", name, version, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("prompt %s@%s not found", name, version)
+	}
+	log.Printf("Activated prompt %s@%s", name, version)
+	return nil
+}
+
+// fetchPromptVersions returns stored prompt versions, newest first, optionally filtered by name,
+// version and active state
+func (h *Handler) fetchPromptVersions(ctx context.Context, name, version string, activeOnly bool) ([]PromptVersion, error) {
+	query := `MATCH (p:PromptVersion)
+		WHERE ($name = '' OR p.name = $name)
+		  AND ($version = '' OR p.version = $version)
+		  AND (NOT $active_only OR p.active = true)
+		RETURN p.name, p.version, p.system, p.user, p.source, p.active, p.previous_version, p.created_at, p.activated_at
+		ORDER BY p.name, p.created_at DESC`
+	params := map[string]interface{}{
+		"name":        name,
+		"version":     version,
+		"active_only": activeOnly,
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]PromptVersion, 0, len(records))
+	for _, record := range records {
+		active, _ := record["p.active"].(bool)
+		versions = append(versions, PromptVersion{
+			Template: prompts.Template{
+				Name:    getStringValue(record, "p.name"),
+				Version: getStringValue(record, "p.version"),
+				System:  getStringValue(record, "p.system"),
+				User:    getStringValue(record, "p.user"),
+				Source:  getStringValue(record, "p.source"),
+			},
+			Active:          active,
+			PreviousVersion: getStringValue(record, "p.previous_version"),
+			CreatedAt:       getStringValue(record, "p.created_at"),
+			ActivatedAt:     getStringValue(record, "p.activated_at"),
+		})
+	}
+	return versions, nil
+}
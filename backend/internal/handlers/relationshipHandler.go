@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// RELATIONSHIPS - REST API FOR CURATING RELATIONSHIPS BETWEEN MODEL ELEMENTS
+// =============================================================================
+
+const (
+	defaultRelationshipLimit = 100
+	maxRelationshipLimit     = 1000
+)
+
+// modelRelationshipTypes are the relationship types between Systems, Stocks and Flows that can be curated by
+// hand. DESCRIBES links a narrative to what it describes and is only created by analysis.
+var modelRelationshipTypes = []string{"CONSTITUTES", "DESCRIBES_STATIC", "DESCRIBES_DYNAMIC", "CHANGES", "CAUSAL_LINK"}
+
+// Relationship is a relationship between two model elements. Its id is the Neo4j element id.
+type Relationship struct {
+	ID                 string   `json:"id"`
+	Type               string   `json:"type"`
+	FromID             string   `json:"fromId"`
+	FromType           string   `json:"fromType"`
+	FromName           string   `json:"fromName"`
+	ToID               string   `json:"toId"`
+	ToType             string   `json:"toType"`
+	ToName             string   `json:"toName"`
+	Polarity           *float64 `json:"polarity,omitempty"`       // CHANGES only
+	Question           string   `json:"question,omitempty"`       // CAUSAL_LINK only
+	CuriosityScore     *float64 `json:"curiosityScore,omitempty"` // CAUSAL_LINK only
+	Consolidated       bool     `json:"consolidated"`
+	ConsolidationScore int      `json:"consolidationScore"`
+	Approved           bool     `json:"approved"`
+}
+
+const relationshipReturn = `
+	RETURN elementId(r) as id, type(r) as type,
+	       a.id as from_id, [l IN labels(a) WHERE l IN ['System', 'Stock', 'Flow']][0] as from_label, a.name as from_name,
+	       b.id as to_id, [l IN labels(b) WHERE l IN ['System', 'Stock', 'Flow']][0] as to_label, b.name as to_name,
+	       r.polarity as polarity, r.question as question, r.curiosity_score as curiosity_score,
+	       COALESCE(r.consolidated, false) as consolidated, COALESCE(r.consolidation_score, 0) as consolidation_score,
+	       COALESCE(r.approved, false) as approved`
+
+func relationshipFromRecord(record map[string]interface{}) Relationship {
+	relationship := Relationship{
+		ID:                 getStringValue(record, "id"),
+		Type:               getStringValue(record, "type"),
+		FromID:             getStringValue(record, "from_id"),
+		FromType:           strings.ToLower(getStringValue(record, "from_label")),
+		FromName:           getStringValue(record, "from_name"),
+		ToID:               getStringValue(record, "to_id"),
+		ToType:             strings.ToLower(getStringValue(record, "to_label")),
+		ToName:             getStringValue(record, "to_name"),
+		Question:           getStringValue(record, "question"),
+		ConsolidationScore: int(getInt64Value(record, "consolidation_score")),
+	}
+	relationship.Consolidated, _ = record["consolidated"].(bool)
+	relationship.Approved, _ = record["approved"].(bool)
+	if polarity, ok := record["polarity"].(float64); ok {
+		relationship.Polarity = &polarity
+	}
+	if score, ok := record["curiosity_score"].(float64); ok {
+		relationship.CuriosityScore = &score
+	}
+	return relationship
+}
+
+// getRelationship reads a model relationship by element id, returning nil when there is no such relationship
+func (h *Handler) getRelationship(ctx context.Context, id string) (*Relationship, error) {
+	query := `MATCH (a)-[r]->(b) WHERE elementId(r) = $id AND type(r) IN $types` + relationshipReturn
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id, "types": modelRelationshipTypes})
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	relationship := relationshipFromRecord(records[0])
+	return &relationship, nil
+}
+
+func validPolarity(polarity float64) bool {
+	return polarity == 1 || polarity == -1
+}
+
+func validCuriosityScore(score float64) bool {
+	return score >= 0 && score <= 1
+}
+
+// relationshipUpdateSets validates an edit of a relationship of type relType and returns the SET items and
+// parameters that apply it to r
+func relationshipUpdateSets(relType string, req models.RelationshipUpdateRequest) ([]string, map[string]interface{}, error) {
+	var sets []string
+	params := map[string]interface{}{}
+	if req.Polarity != nil {
+		if relType != "CHANGES" {
+			return nil, nil, fmt.Errorf("polarity only applies to CHANGES relationships")
+		}
+		if !validPolarity(*req.Polarity) {
+			return nil, nil, fmt.Errorf("polarity must be 1 or -1")
+		}
+		sets = append(sets, "r.polarity = $polarity")
+		params["polarity"] = *req.Polarity
+	}
+	if req.Question != nil || req.CuriosityScore != nil {
+		if relType != "CAUSAL_LINK" {
+			return nil, nil, fmt.Errorf("question and curiosityScore only apply to CAUSAL_LINK relationships")
+		}
+		if req.Question != nil {
+			if strings.TrimSpace(*req.Question) == "" {
+				return nil, nil, fmt.Errorf("question cannot be empty")
+			}
+			sets = append(sets, "r.question = $question")
+			params["question"] = strings.TrimSpace(*req.Question)
+		}
+		if req.CuriosityScore != nil {
+			if !validCuriosityScore(*req.CuriosityScore) {
+				return nil, nil, fmt.Errorf("curiosityScore must be between 0 and 1")
+			}
+			sets = append(sets, "r.curiosity_score = $curiosity_score")
+			params["curiosity_score"] = *req.CuriosityScore
+		}
+	}
+	if len(sets) == 0 {
+		return nil, nil, fmt.Errorf("nothing to update: set polarity, question or curiosityScore")
+	}
+	return sets, params, nil
+}
+
+// validateRelationshipRequest checks the type-specific fields of a new relationship of type relType
+func validateRelationshipRequest(relType string, req models.RelationshipRequest) error {
+	if !slices.Contains(modelRelationshipTypes, relType) {
+		return fmt.Errorf("type must be one of %s", strings.Join(modelRelationshipTypes, ", "))
+	}
+	if req.FromID == req.ToID {
+		return fmt.Errorf("a relationship cannot link an element to itself")
+	}
+	switch relType {
+	case "CHANGES":
+		if req.Polarity == nil || !validPolarity(*req.Polarity) {
+			return fmt.Errorf("CHANGES relationships need a polarity of 1 or -1")
+		}
+	case "CAUSAL_LINK":
+		if strings.TrimSpace(req.Question) == "" {
+			return fmt.Errorf("CAUSAL_LINK relationships need a question")
+		}
+		if req.CuriosityScore == nil || !validCuriosityScore(*req.CuriosityScore) {
+			return fmt.Errorf("CAUSAL_LINK relationships need a curiosityScore between 0 and 1")
+		}
+	}
+	if req.Polarity != nil && relType != "CHANGES" {
+		return fmt.Errorf("polarity only applies to CHANGES relationships")
+	}
+	if (req.Question != "" || req.CuriosityScore != nil) && relType != "CAUSAL_LINK" {
+		return fmt.Errorf("question and curiosityScore only apply to CAUSAL_LINK relationships")
+	}
+	return nil
+}
+
+// ListRelationships - Lists relationships between model elements.
+// Query parameters: type, node_id (either end), consolidated (true/false), limit (default 100) and offset.
+func (h *Handler) ListRelationships(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	types := modelRelationshipTypes
+	if relType := strings.ToUpper(c.Query("type")); relType != "" {
+		if !slices.Contains(modelRelationshipTypes, relType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of " + strings.Join(modelRelationshipTypes, ", ")})
+			return
+		}
+		types = []string{relType}
+	}
+	var consolidated interface{}
+	if consolidatedParam := c.Query("consolidated"); consolidatedParam != "" {
+		value, err := strconv.ParseBool(consolidatedParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "consolidated must be true or false"})
+			return
+		}
+		consolidated = value
+	}
+	limit, offset, err := parsePagination(c, defaultRelationshipLimit, maxRelationshipLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := map[string]interface{}{
+		"types":        types,
+		"node_id":      nilIfEmpty(c.Query("node_id")),
+		"consolidated": consolidated,
+		"limit":        limit,
+		"offset":       offset,
+	}
+	filter := `MATCH (a)-[r]->(b)
+		WHERE type(r) IN $types
+		  AND ($node_id IS NULL OR a.id = $node_id OR b.id = $node_id)
+		  AND ($consolidated IS NULL OR COALESCE(r.consolidated, false) = $consolidated)`
+
+	totalRecords, err := h.db.ExecuteRead(ctx, filter+` RETURN count(r) as total`, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count relationships: " + err.Error()})
+		return
+	}
+	records, err := h.db.ExecuteRead(ctx, filter+relationshipReturn+`
+		ORDER BY type, from_name, to_name
+		SKIP $offset LIMIT $limit`, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list relationships: " + err.Error()})
+		return
+	}
+
+	relationships := make([]Relationship, 0, len(records))
+	for _, record := range records {
+		relationships = append(relationships, relationshipFromRecord(record))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"relationships": relationships,
+		"total":         countFromRecords(totalRecords, "total"),
+		"limit":         limit,
+		"offset":        offset,
+	})
+}
+
+// GetRelationship - Reads a relationship between model elements by ID
+func (h *Handler) GetRelationship(c *gin.Context) {
+	relationship, err := h.getRelationship(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if relationship == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+	c.JSON(http.StatusOK, relationship)
+}
+
+// CreateRelationship - Creates a relationship between two model elements by hand. Endpoint types are checked
+// per relationship type: CONSTITUTES is System→System, DESCRIBES_STATIC Stock→System, DESCRIBES_DYNAMIC
+// Flow→System, CHANGES Flow→Stock with a polarity of ±1, and CAUSAL_LINK links Stocks and Flows with a question
+// and a curiosity score. Like hand-made elements, it is approved for the next consolidation.
+func (h *Handler) CreateRelationship(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.RelationshipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	relType := strings.ToUpper(req.Type)
+	if err := validateRelationshipRequest(relType, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Both endpoints must exist and be of the types the relationship connects
+	records, err := h.db.ExecuteRead(ctx, `MATCH (n) WHERE n.id IN [$from_id, $to_id] AND (n:System OR n:Stock OR n:Flow)
+		RETURN n.id as id, [l IN labels(n) WHERE l IN ['System', 'Stock', 'Flow']][0] as label`,
+		map[string]interface{}{"from_id": req.FromID, "to_id": req.ToID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	nodeTypes := make(map[string]string)
+	for _, record := range records {
+		nodeTypes[getStringValue(record, "id")] = strings.ToLower(getStringValue(record, "label"))
+	}
+	for _, end := range []struct{ field, id string }{{"fromId", req.FromID}, {"toId", req.ToID}} {
+		if nodeTypes[end.id] == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s %s is not a system, stock or flow", end.field, end.id)})
+			return
+		}
+	}
+	endpoints := relationshipEndpointTypes[relType]
+	if !slices.Contains(endpoints[0], nodeTypes[req.FromID]) || !slices.Contains(endpoints[1], nodeTypes[req.ToID]) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must run from a %s to a %s, not from a %s to a %s", relType,
+			strings.Join(endpoints[0], " or "), strings.Join(endpoints[1], " or "), nodeTypes[req.FromID], nodeTypes[req.ToID])})
+		return
+	}
+
+	pairQuery := fmt.Sprintf(`MATCH (a {id: $from_id})-[r:%s]->(b {id: $to_id})`, relType) + relationshipReturn + ` LIMIT 1`
+	pairParams := map[string]interface{}{"from_id": req.FromID, "to_id": req.ToID}
+	existing, err := h.db.ExecuteRead(ctx, pairQuery, pairParams)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(existing) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Relationship already exists", "relationship": relationshipFromRecord(existing[0])})
+		return
+	}
+
+	props := map[string]interface{}{"approved": true}
+	switch relType {
+	case "CONSTITUTES":
+		_, err = h.createConstitutesRelationshipInDB(ctx, req.FromID, req.ToID, props)
+	case "DESCRIBES_STATIC":
+		_, err = h.createDescribesStaticRelationshipInDB(ctx, req.FromID, req.ToID, props)
+	case "DESCRIBES_DYNAMIC":
+		_, err = h.createDescribesDynamicRelationshipInDB(ctx, req.FromID, req.ToID, props)
+	case "CHANGES":
+		_, err = h.createChangesRelationshipInDB(ctx, req.FromID, req.ToID, float32(*req.Polarity), props)
+	case "CAUSAL_LINK":
+		_, err = h.createCausalLinkInDB(ctx, models.CausalLink{
+			FromID:         req.FromID,
+			FromType:       nodeLabel(nodeTypes[req.FromID]),
+			ToID:           req.ToID,
+			ToType:         nodeLabel(nodeTypes[req.ToID]),
+			Question:       strings.TrimSpace(req.Question),
+			CuriosityScore: float32(*req.CuriosityScore),
+		}, props)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.db.ExecuteRead(ctx, pairQuery, pairParams)
+	if err != nil || len(created) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read created relationship"})
+		return
+	}
+	c.JSON(http.StatusCreated, relationshipFromRecord(created[0]))
+}
+
+// UpdateRelationship - Edits the polarity of a CHANGES relationship, or the question and curiosity score of
+// a CAUSAL_LINK
+func (h *Handler) UpdateRelationship(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.RelationshipUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	relationship, err := h.getRelationship(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if relationship == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+
+	sets, params, err := relationshipUpdateSets(relationship.Type, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params["id"] = relationship.ID
+
+	query := `MATCH ()-[r]->() WHERE elementId(r) = $id SET ` + strings.Join(sets, ", ")
+	if _, err := h.db.ExecuteQuery(ctx, query, params); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.getRelationship(ctx, relationship.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read updated relationship"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteRelationship - Deletes a relationship between model elements
+func (h *Handler) DeleteRelationship(c *gin.Context) {
+	query := `MATCH ()-[r]->() WHERE elementId(r) = $id AND type(r) IN $types
+		DELETE r
+		RETURN count(*) as deleted`
+	records, err := h.db.ExecuteRead(c.Request.Context(), query, map[string]interface{}{"id": c.Param("id"), "types": modelRelationshipTypes})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if countFromRecords(records, "deleted") == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Relationship deleted successfully"})
+}
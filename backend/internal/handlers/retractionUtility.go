@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+)
+
+// Narrative deletion modes, selected with the mode query parameter of DeleteNarrativeNode
+const (
+	DeleteModeKeepDerived           = "keep"           // Delete the narrative only; derived nodes stay as they are
+	DeleteModeUnconsolidatedDerived = "unconsolidated" // Also delete the unconsolidated nodes and relationships it produced
+	DeleteModeRetract               = "retract"        // Also withdraw its support from consolidated nodes and relationships
+)
+
+// NarrativeDeletionReport describes what deleting a narrative changed in the derived graph
+type NarrativeDeletionReport struct {
+	Mode                                 string `json:"mode"`
+	UnconsolidatedNodesDeleted           int64  `json:"unconsolidated_nodes_deleted"`
+	UnconsolidatedRelationshipsDeleted   int64  `json:"unconsolidated_relationships_deleted"`
+	ConsolidatedNodesDecremented         int64  `json:"consolidated_nodes_decremented"`
+	ConsolidatedNodesDeleted             int64  `json:"consolidated_nodes_deleted"`
+	ConsolidatedRelationshipsDecremented int64  `json:"consolidated_relationships_decremented"`
+	ConsolidatedRelationshipsDeleted     int64  `json:"consolidated_relationships_deleted"`
+	UnattributedConsolidatedNodes        int64  `json:"unattributed_consolidated_nodes"` // Described by the narrative but consolidated before provenance was tracked
+}
+
+// relationshipNarratives lists, with repeats, the narratives named by the narrative_id or source_narratives of
+// the relationships of a node variable (%[1]s). A narrative that linked an existing node before reuse was
+// recorded in source_narratives is only found this way.
+const relationshipNarratives = `reduce(named = [], r IN [(%[1]s)-[r]-() | r] |
+	named + COALESCE(r.source_narratives, []) + CASE WHEN r.narrative_id IS NULL THEN [] ELSE [r.narrative_id] END)`
+
+// deleteUnconsolidatedDerived deletes the unconsolidated System/Stock/Flow nodes and relationships extracted
+// from a narrative. Nodes created before provenance was tracked are found through the narrative's DESCRIBES links.
+func (h *Handler) deleteUnconsolidatedDerived(ctx context.Context, narrativeID string, report *NarrativeDeletionReport) error {
+	params := map[string]interface{}{"narrative_id": narrativeID}
+
+	relationshipQuery := `
+		MATCH ()-[r]->()
+		WHERE r.narrative_id = $narrative_id AND COALESCE(r.consolidated, false) = false
+		DELETE r
+		RETURN count(r) as deleted`
+	records, err := h.db.ExecuteRead(ctx, relationshipQuery, params)
+	if err != nil {
+		return fmt.Errorf("failed to delete unconsolidated relationships: %v", err)
+	}
+	report.UnconsolidatedRelationshipsDeleted = countFromRecords(records, "deleted")
+
+	nodeQuery := `
+		MATCH (x)
+		WHERE (x:System OR x:Stock OR x:Flow)
+		  AND COALESCE(x.consolidated, false) = false
+		  AND (x.narrative_id = $narrative_id
+		       OR (x.narrative_id IS NULL AND EXISTS { MATCH (:Narrative {id: $narrative_id})-[:DESCRIBES]->(x) }))
+		DETACH DELETE x
+		RETURN count(x) as deleted`
+	records, err = h.db.ExecuteRead(ctx, nodeQuery, params)
+	if err != nil {
+		return fmt.Errorf("failed to delete unconsolidated nodes: %v", err)
+	}
+	report.UnconsolidatedNodesDeleted = countFromRecords(records, "deleted")
+
+	return nil
+}
+
+// addNarrativeSupport records a narrative that reused a consolidated node in the node's source_narratives,
+// so retracting the narrative that created the node leaves it in place for the narratives linking to it
+func (h *Handler) addNarrativeSupport(ctx context.Context, nodeID, narrativeID string) error {
+	query := `
+		MATCH (x {id: $id})
+		WHERE (x:System OR x:Stock OR x:Flow) AND NOT $narrative_id IN COALESCE(x.source_narratives, [])
+		SET x.source_narratives = COALESCE(x.source_narratives, []) + $narrative_id`
+	_, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": nodeID, "narrative_id": narrativeID})
+	return err
+}
+
+// retractConsolidatedSupport removes a narrative from the source_narratives of consolidated nodes and
+// relationships and lowers their consolidation_score by the support it contributed. Anything left with no
+// support is deleted. A node also keeps the support of every other narrative its relationships name, which
+// covers links made before reuse was recorded in source_narratives. Support consolidated before provenance
+// was tracked cannot be attributed and is kept.
+func (h *Handler) retractConsolidatedSupport(ctx context.Context, narrativeID string, report *NarrativeDeletionReport) error {
+	params := map[string]interface{}{"narrative_id": narrativeID}
+
+	// The narrative's DESCRIBES links vanish with it, so count unattributed systems first
+	unattributedQuery := `
+		MATCH (:Narrative {id: $narrative_id})-[:DESCRIBES]->(x)
+		WHERE x.consolidated = true AND x.source_narratives IS NULL
+		RETURN count(DISTINCT x) as unattributed`
+	records, err := h.db.ExecuteRead(ctx, unattributedQuery, params)
+	if err != nil {
+		return fmt.Errorf("failed to count unattributed nodes: %v", err)
+	}
+	report.UnattributedConsolidatedNodes = countFromRecords(records, "unattributed")
+
+	// The score never drops below the support still attributed to other narratives
+	relationshipQuery := `
+		MATCH ()-[r]->()
+		WHERE r.consolidated = true AND $narrative_id IN COALESCE(r.source_narratives, [])
+		WITH r, [x IN r.source_narratives WHERE x <> $narrative_id] as remaining
+		WITH r, remaining, size(r.source_narratives) - size(remaining) as removed
+		WITH r, remaining, CASE WHEN COALESCE(r.consolidation_score, 0) - removed > size(remaining)
+			THEN COALESCE(r.consolidation_score, 0) - removed ELSE size(remaining) END as score
+		SET r.source_narratives = remaining, r.consolidation_score = score
+		WITH r, score
+		FOREACH (_ IN CASE WHEN score <= 0 THEN [1] ELSE [] END | DELETE r)
+		RETURN count(*) as decremented, sum(CASE WHEN score <= 0 THEN 1 ELSE 0 END) as deleted`
+	records, err = h.db.ExecuteRead(ctx, relationshipQuery, params)
+	if err != nil {
+		return fmt.Errorf("failed to retract relationship support: %v", err)
+	}
+	report.ConsolidatedRelationshipsDeleted = countFromRecords(records, "deleted")
+	report.ConsolidatedRelationshipsDecremented = countFromRecords(records, "decremented") - report.ConsolidatedRelationshipsDeleted
+
+	nodeQuery := `
+		MATCH (x)
+		WHERE (x:System OR x:Stock OR x:Flow)
+		  AND x.consolidated = true AND $narrative_id IN COALESCE(x.source_narratives, [])
+		WITH x, [s IN x.source_narratives WHERE s <> $narrative_id] as kept, ` + fmt.Sprintf(relationshipNarratives, "x") + ` as named
+		WITH x, kept, reduce(remaining = kept, s IN named |
+			CASE WHEN s = $narrative_id OR s IN remaining THEN remaining ELSE remaining + s END) as remaining
+		WITH x, remaining, size(x.source_narratives) - size(kept) as removed
+		WITH x, remaining, CASE WHEN COALESCE(x.consolidation_score, 0) - removed > size(remaining)
+			THEN COALESCE(x.consolidation_score, 0) - removed ELSE size(remaining) END as score
+		SET x.source_narratives = remaining, x.consolidation_score = score
+		WITH x, score
+		FOREACH (_ IN CASE WHEN score <= 0 THEN [1] ELSE [] END | DETACH DELETE x)
+		RETURN count(*) as decremented, sum(CASE WHEN score <= 0 THEN 1 ELSE 0 END) as deleted`
+	records, err = h.db.ExecuteRead(ctx, nodeQuery, params)
+	if err != nil {
+		return fmt.Errorf("failed to retract node support: %v", err)
+	}
+	report.ConsolidatedNodesDeleted = countFromRecords(records, "deleted")
+	report.ConsolidatedNodesDecremented = countFromRecords(records, "decremented") - report.ConsolidatedNodesDeleted
+
+	return nil
+}
+
+// countConsolidatedSupport counts the consolidated nodes and relationships that list a narrative among their
+// source_narratives, for reporting support that an edit of the narrative left stale
+func (h *Handler) countConsolidatedSupport(ctx context.Context, narrativeID string) (nodes, relationships int64, err error) {
+	params := map[string]interface{}{"narrative_id": narrativeID}
+	records, err := h.db.ExecuteRead(ctx, `
+		MATCH (x)
+		WHERE (x:System OR x:Stock OR x:Flow)
+		  AND x.consolidated = true AND $narrative_id IN COALESCE(x.source_narratives, [])
+		RETURN count(x) as supported`, params)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count consolidated nodes: %v", err)
+	}
+	nodes = countFromRecords(records, "supported")
+
+	records, err = h.db.ExecuteRead(ctx, `
+		MATCH ()-[r]->()
+		WHERE r.consolidated = true AND $narrative_id IN COALESCE(r.source_narratives, [])
+		RETURN count(r) as supported`, params)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count consolidated relationships: %v", err)
+	}
+	return nodes, countFromRecords(records, "supported"), nil
+}
+
+func countFromRecords(records []map[string]interface{}, key string) int64 {
+	if len(records) == 0 {
+		return 0
+	}
+	count, _ := records[0][key].(int64)
+	return count
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+// TestRetractKeepsConceptsLinkedByOtherNarratives retracts the narrative that created a consolidated stock
+// after a second narrative reused it, and checks the stock and the second narrative's relationships survive.
+// Like the pipeline test it needs NEO4J_TEST_URI.
+func TestRetractKeepsConceptsLinkedByOtherNarratives(t *testing.T) {
+	ctx := context.Background()
+	h := &Handler{db: testDatabase(t)}
+
+	creator := &models.Narrative{ID: "narrative_retract_creator", Title: "Shipping Fast", Content: "Shortcuts add to the debt."}
+	linker := &models.Narrative{ID: "narrative_retract_linker", Title: "Refactoring Sprint", Content: "Refactoring paid the debt down."}
+	for _, narrative := range []*models.Narrative{creator, linker} {
+		narrative.CreatedAt, narrative.UpdatedAt = time.Now(), time.Now()
+		if err := h.createNarrativeInDB(ctx, narrative, nil); err != nil {
+			t.Fatalf("createNarrativeInDB() error = %v", err)
+		}
+	}
+
+	// The creator's plan, consolidated as a single source would be
+	h.executeLLMPlan(ctx, creator, models.LLMResponse{Actions: []models.LLMAction{
+		{FunctionName: "CreateStockNode", Parameters: map[string]interface{}{"name": "Technical Debt", "description": "Accumulated cost of shortcuts.", "type": "qualitative"}},
+		{FunctionName: "CreateFlowNode", Parameters: map[string]interface{}{"name": "Shortcut Implementation", "description": "Delivering features through expedient solutions."}},
+		{FunctionName: "CreateChangesRelationship", Parameters: map[string]interface{}{"flowName": "Shortcut Implementation", "stockName": "Technical Debt", "polarity": 1.0}},
+	}}, nil, "")
+	consolidate := `
+		MATCH (x) WHERE x:Stock OR x:Flow
+		SET x.consolidated = true, x.consolidation_score = 1, x.source_narratives = [x.narrative_id]
+		WITH count(x) as nodes
+		MATCH ()-[r:CHANGES]->()
+		SET r.consolidated = true, r.consolidation_score = 1, r.source_narratives = [r.narrative_id]`
+	if _, err := h.db.ExecuteRead(ctx, consolidate, nil); err != nil {
+		t.Fatal(err)
+	}
+	records, err := h.db.ExecuteRead(ctx, `MATCH (st:Stock {name: "Technical Debt"}) RETURN st.id as id`, nil)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("stock lookup = %v, %v", records, err)
+	}
+	stockID := getStringValue(records[0], "id")
+
+	// The linker reuses the stock through grounding and changes it with a flow of its own
+	grounding := indexGroundingConcepts([]GroundingConcept{{ID: stockID, NodeType: "stock", Name: "Technical Debt"}})
+	execution := h.executeLLMPlan(ctx, linker, models.LLMResponse{Actions: []models.LLMAction{
+		{FunctionName: "LinkExistingNode", Parameters: map[string]interface{}{"name": "Technical Debt", "type": "stock", "id": stockID}},
+		{FunctionName: "CreateFlowNode", Parameters: map[string]interface{}{"name": "Code Refactoring", "description": "Restructuring code to pay down debt."}},
+		{FunctionName: "CreateChangesRelationship", Parameters: map[string]interface{}{"flowName": "Code Refactoring", "stockName": "Technical Debt", "polarity": -1.0}},
+	}}, grounding, "")
+	if execution.NodesLinked != 1 || execution.RelationshipsCreated != 1 {
+		t.Fatalf("linker execution = %+v, want 1 node linked and 1 relationship", execution)
+	}
+
+	report := NarrativeDeletionReport{Mode: DeleteModeRetract}
+	if err := h.retractConsolidatedSupport(ctx, creator.ID, &report); err != nil {
+		t.Fatalf("retractConsolidatedSupport() error = %v", err)
+	}
+	if err := h.deleteUnconsolidatedDerived(ctx, creator.ID, &report); err != nil {
+		t.Fatalf("deleteUnconsolidatedDerived() error = %v", err)
+	}
+	if report.ConsolidatedNodesDeleted != 1 || report.ConsolidatedNodesDecremented != 1 {
+		t.Errorf("report = %+v, want the creator's flow deleted and the stock decremented", report)
+	}
+
+	records, err = h.db.ExecuteRead(ctx, `
+		MATCH (st:Stock {id: $id})
+		OPTIONAL MATCH (f:Flow)-[r:CHANGES]->(st)
+		RETURN st.source_narratives as sources, collect(f.name) as flows, collect(r.narrative_id) as changed_by`,
+		map[string]interface{}{"id": stockID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatal("the linked stock was deleted with the narrative that created it")
+	}
+	sources, _ := records[0]["sources"].([]interface{})
+	if len(sources) != 1 || sources[0] != linker.ID {
+		t.Errorf("source_narratives = %v, want [%s]", sources, linker.ID)
+	}
+	flows, _ := records[0]["flows"].([]interface{})
+	changedBy, _ := records[0]["changed_by"].([]interface{})
+	if !slices.Equal(flows, []interface{}{"Code Refactoring"}) || !slices.Equal(changedBy, []interface{}{linker.ID}) {
+		t.Errorf("stock is changed by %v from %v, want the linker's Code Refactoring only", flows, changedBy)
+	}
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/database"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// =============================================================================
+// NARRATIVE REVISION HANDLERS - IMMUTABLE HISTORY OF NARRATIVE EDITS
+// =============================================================================
+
+// maxRevisionAttempts bounds how often recording a revision is retried after losing its number to a
+// concurrent edit
+const maxRevisionAttempts = 3
+
+// ListNarrativeRevisions - Lists all revisions of a narrative, newest first, without their content
+func (h *Handler) ListNarrativeRevisions(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := h.getNarrativeByIDFromDB(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative not found"})
+		return
+	}
+
+	query := `MATCH (n:Narrative {id: $id})-[:HAS_REVISION]->(r:NarrativeRevision)
+		RETURN r.id, r.number, r.title, r.content_hash, r.editor_id, r.restored_from, r.created_at
+		ORDER BY r.number DESC`
+	records, err := h.db.ExecuteRead(c.Request.Context(), query, map[string]interface{}{"id": id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	revisions := make([]models.NarrativeRevision, 0, len(records))
+	for _, record := range records {
+		revision := revisionFromRecord(record)
+		revision.NarrativeID = id
+		revisions = append(revisions, revision)
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GetNarrativeRevision - Reads a single revision of a narrative, including its content
+func (h *Handler) GetNarrativeRevision(c *gin.Context) {
+	number, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Revision must be a number"})
+		return
+	}
+
+	revision, err := h.getNarrativeRevisionFromDB(c.Request.Context(), c.Param("id"), number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// DiffNarrativeRevisions - Diffs two revisions of a narrative line by line.
+// Query parameters: from (required) and to (defaults to the latest revision).
+func (h *Handler) DiffNarrativeRevisions(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from query parameter must be a revision number"})
+		return
+	}
+
+	var to int
+	if toParam := c.Query("to"); toParam != "" {
+		if to, err = strconv.Atoi(toParam); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to query parameter must be a revision number"})
+			return
+		}
+	} else if to, err = h.latestRevisionNumber(ctx, id); err != nil || to == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Narrative has no revisions"})
+		return
+	}
+
+	fromRevision, err := h.getNarrativeRevisionFromDB(ctx, id, from)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	toRevision, err := h.getNarrativeRevisionFromDB(ctx, id, to)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	diff := diffLines(fromRevision.Content, toRevision.Content)
+	insertions, deletions := 0, 0
+	for _, line := range diff {
+		switch line.Op {
+		case "insert":
+			insertions++
+		case "delete":
+			deletions++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"narrativeId":   id,
+		"from":          from,
+		"to":            to,
+		"title_changed": fromRevision.Title != toRevision.Title,
+		"from_title":    fromRevision.Title,
+		"to_title":      toRevision.Title,
+		"insertions":    insertions,
+		"deletions":     deletions,
+		"diff":          diff,
+		"unified":       formatUnifiedDiff(diff),
+	})
+}
+
+// RestoreNarrativeRevision - Restores a narrative to an earlier revision by recording it as a new revision
+func (h *Handler) RestoreNarrativeRevision(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	number, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Revision must be a number"})
+		return
+	}
+
+	revision, err := h.getNarrativeRevisionFromDB(ctx, id, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	restored, err := h.updateNarrativeContent(ctx, id, revision.Title, revision.Content, c.GetString("userID"), revision.Number)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      fmt.Sprintf("Narrative restored to revision %d", revision.Number),
+		"narrativeId":  id,
+		"revision":     restored.Number,
+		"restoredFrom": revision.Number,
+	})
+}
+
+// ====== REVISION DATABASE HELPERS ======
+
+// updateNarrativeContent overwrites a narrative's title and content and records the result as a new revision.
+// Narratives created before revision history existed get their current text snapshotted first.
+func (h *Handler) updateNarrativeContent(ctx context.Context, id, title, content, editorID string, restoredFrom int) (*models.NarrativeRevision, error) {
+	if err := h.ensureBaselineRevision(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to snapshot current narrative: %v", err)
+	}
+
+	query := `MATCH (n:Narrative {id: $id})
+		SET n.title = $title, n.content = $content, n.content_hash = $content_hash, n.updated_at = $updated_at
+		RETURN n.id`
+	params := map[string]interface{}{
+		"id":           id,
+		"title":        title,
+		"content":      content,
+		"content_hash": contentHash(content),
+		"updated_at":   time.Now().Format(time.RFC3339),
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("narrative not found")
+	}
+
+	return h.recordNarrativeRevision(ctx, id, editorID, restoredFrom)
+}
+
+// recordNarrativeRevision snapshots the narrative's current title and content as its next revision
+func (h *Handler) recordNarrativeRevision(ctx context.Context, narrativeID, editorID string, restoredFrom int) (*models.NarrativeRevision, error) {
+	query := `MATCH (n:Narrative {id: $narrative_id})
+		OPTIONAL MATCH (n)-[:HAS_REVISION]->(previous:NarrativeRevision)
+		WITH n, COALESCE(max(previous.number), 0) + 1 as number
+		CREATE (n)-[:HAS_REVISION]->(r:NarrativeRevision {
+			id: $id,
+			narrative_id: n.id,
+			number: number,
+			title: n.title,
+			content: n.content,
+			content_hash: COALESCE(n.content_hash, $content_hash),
+			editor_id: $editor_id,
+			restored_from: $restored_from,
+			created_at: $created_at
+		})
+		RETURN r.id, r.number, r.title, r.content, r.content_hash, r.editor_id, r.restored_from, r.created_at`
+	params := map[string]interface{}{
+		"narrative_id":  narrativeID,
+		"id":            uuid.New().String(),
+		"content_hash":  "",
+		"editor_id":     nilIfEmpty(editorID),
+		"restored_from": nil,
+		"created_at":    time.Now().Format(time.RFC3339),
+	}
+	if restoredFrom > 0 {
+		params["restored_from"] = restoredFrom
+	}
+
+	// The number is taken and used in one statement; when a concurrent edit of the same narrative took it first,
+	// the uniqueness constraint rejects the write and the next attempt takes the following number
+	var records []map[string]interface{}
+	var err error
+	for attempt := 1; attempt <= maxRevisionAttempts; attempt++ {
+		records, err = h.db.ExecuteRead(ctx, query, params)
+		if !database.IsConstraintViolation(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("narrative not found")
+	}
+
+	revision := revisionFromRecord(records[0])
+	revision.NarrativeID = narrativeID
+	return &revision, nil
+}
+
+// ensureBaselineRevision records the current text as revision 1 for narratives without any revisions
+func (h *Handler) ensureBaselineRevision(ctx context.Context, narrativeID string) error {
+	query := `MATCH (n:Narrative {id: $narrative_id})
+		WHERE NOT (n)-[:HAS_REVISION]->(:NarrativeRevision)
+		CREATE (n)-[:HAS_REVISION]->(:NarrativeRevision {
+			id: $id,
+			narrative_id: n.id,
+			number: 1,
+			title: n.title,
+			content: n.content,
+			content_hash: COALESCE(n.content_hash, ''),
+			created_at: COALESCE(n.updated_at, n.created_at)
+		})`
+	params := map[string]interface{}{
+		"narrative_id": narrativeID,
+		"id":           uuid.New().String(),
+	}
+	_, err := h.db.ExecuteQuery(ctx, query, params)
+	return err
+}
+
+func (h *Handler) getNarrativeRevisionFromDB(ctx context.Context, narrativeID string, number int) (*models.NarrativeRevision, error) {
+	query := `MATCH (n:Narrative {id: $id})-[:HAS_REVISION]->(r:NarrativeRevision {number: $number})
+		RETURN r.id, r.number, r.title, r.content, r.content_hash, r.editor_id, r.restored_from, r.created_at`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": narrativeID, "number": number})
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("revision %d of narrative '%s' not found", number, narrativeID)
+	}
+
+	revision := revisionFromRecord(records[0])
+	revision.NarrativeID = narrativeID
+	return &revision, nil
+}
+
+func (h *Handler) latestRevisionNumber(ctx context.Context, narrativeID string) (int, error) {
+	query := `MATCH (n:Narrative {id: $id})-[:HAS_REVISION]->(r:NarrativeRevision) RETURN max(r.number) as latest`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": narrativeID})
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	latest, _ := records[0]["latest"].(int64)
+	return int(latest), nil
+}
+
+func revisionFromRecord(record map[string]interface{}) models.NarrativeRevision {
+	revision := models.NarrativeRevision{
+		ID:          getStringValue(record, "r.id"),
+		Title:       getStringValue(record, "r.title"),
+		Content:     getStringValue(record, "r.content"),
+		ContentHash: getStringValue(record, "r.content_hash"),
+		EditorID:    getStringValue(record, "r.editor_id"),
+	}
+	if number, ok := record["r.number"].(int64); ok {
+		revision.Number = int(number)
+	}
+	if restoredFrom, ok := record["r.restored_from"].(int64); ok {
+		revision.RestoredFrom = int(restoredFrom)
+	}
+	if createdAtStr := getStringValue(record, "r.created_at"); createdAtStr != "" {
+		if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
+			revision.CreatedAt = createdAt
+		}
+	}
+	return revision
+}
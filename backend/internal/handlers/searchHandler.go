@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit   = 10
+	maxSearchLimit       = 50
+	searchSnippetRadius  = 80 // Characters of context kept on each side of the first match
+	maxSearchQueryLength = 500
+)
+
+// searchTypes are the node types that can be searched, in the order results are grouped
+var searchTypes = []string{"narrative", "system", "stock", "flow"}
+
+// Search - Full-text search over narratives and System/Stock/Flow concepts.
+// Query parameters: q (required), types (comma-separated subset of narrative,system,stock,flow),
+// consolidated (true/false, concepts only) and limit (hits per type, default 10).
+func (h *Handler) Search(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q query parameter is required"})
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q query parameter is too long"})
+		return
+	}
+
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must contain at least one letter or digit"})
+		return
+	}
+
+	types := searchTypes
+	if typesParam := c.Query("types"); typesParam != "" {
+		types = nil
+		for _, t := range strings.Split(typesParam, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if !slices.Contains(searchTypes, t) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown type '" + t + "'. Use narrative, system, stock or flow"})
+				return
+			}
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+
+	var consolidated interface{}
+	if consolidatedParam := c.Query("consolidated"); consolidatedParam != "" {
+		value, err := strconv.ParseBool(consolidatedParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "consolidated must be true or false"})
+			return
+		}
+		consolidated = value
+	}
+
+	limit := defaultSearchLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		value, err := strconv.Atoi(limitParam)
+		if err != nil || value <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(value, maxSearchLimit)
+	}
+
+	luceneQuery := buildLuceneQuery(terms)
+	results := gin.H{}
+	total := 0
+	for _, t := range types {
+		var hits []models.SearchHit
+		var err error
+		if t == "narrative" {
+			hits, err = h.searchNarratives(ctx, luceneQuery, terms, limit)
+		} else {
+			hits, err = h.searchConcepts(ctx, t, luceneQuery, terms, consolidated, limit)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed: " + err.Error()})
+			return
+		}
+		results[t+"s"] = hits
+		total += len(hits)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query":   q,
+		"total":   total,
+		"results": results,
+	})
+}
+
+func (h *Handler) searchNarratives(ctx context.Context, luceneQuery string, terms []string, limit int) ([]models.SearchHit, error) {
+	query := `CALL db.index.fulltext.queryNodes('narrative_fulltext', $query) YIELD node, score
+		RETURN node.id as id, node.title as title, node.content as content, score
+		ORDER BY score DESC
+		LIMIT $limit`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"query": luceneQuery, "limit": limit})
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]models.SearchHit, 0, len(records))
+	for _, record := range records {
+		hit := models.SearchHit{
+			ID:         getStringValue(record, "id"),
+			Type:       "narrative",
+			Name:       getStringValue(record, "title"),
+			Highlights: highlightFields(record, terms, "title", "content"),
+		}
+		hit.Score, _ = record["score"].(float64)
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// searchConcepts searches one concept type; consolidated is nil to match both states
+func (h *Handler) searchConcepts(ctx context.Context, nodeType, luceneQuery string, terms []string, consolidated interface{}, limit int) ([]models.SearchHit, error) {
+	query := `CALL db.index.fulltext.queryNodes('concept_fulltext', $query) YIELD node, score
+		WHERE $label IN labels(node)
+		  AND ($consolidated IS NULL OR COALESCE(node.consolidated, false) = $consolidated)
+		RETURN node.id as id, node.name as name, node.description as description,
+		       node.boundary_description as boundary_description,
+		       COALESCE(node.consolidated, false) as consolidated, score
+		ORDER BY score DESC
+		LIMIT $limit`
+	params := map[string]interface{}{
+		"query":        luceneQuery,
+		"label":        nodeLabel(nodeType),
+		"consolidated": consolidated,
+		"limit":        limit,
+	}
+	records, err := h.db.ExecuteRead(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]models.SearchHit, 0, len(records))
+	for _, record := range records {
+		isConsolidated, _ := record["consolidated"].(bool)
+		hit := models.SearchHit{
+			ID:           getStringValue(record, "id"),
+			Type:         nodeType,
+			Name:         getStringValue(record, "name"),
+			Consolidated: &isConsolidated,
+			Highlights:   highlightFields(record, terms, "name", "description", "boundary_description"),
+		}
+		hit.Score, _ = record["score"].(float64)
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// searchTerms lowercases the query and splits it into letter/digit runs. Dropping every other character
+// means user input can never inject Lucene operators or syntax errors into the full-text query.
+func searchTerms(q string) []string {
+	var terms []string
+	for _, term := range strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// buildLuceneQuery matches any of the terms and boosts hits containing them as an exact phrase
+func buildLuceneQuery(terms []string) string {
+	query := strings.Join(terms, " ")
+	if len(terms) > 1 {
+		query = `"` + query + `"^2 ` + query
+	}
+	return query
+}
+
+// highlightFields returns a highlighted snippet for every field that contains one of the terms
+func highlightFields(record map[string]interface{}, terms []string, fields ...string) map[string]string {
+	highlights := make(map[string]string)
+	for _, field := range fields {
+		if snippet := highlightSnippet(getStringValue(record, field), terms, searchSnippetRadius); snippet != "" {
+			highlights[field] = snippet
+		}
+	}
+	return highlights
+}
+
+// highlightSnippet cuts a window of text around the first whole-word term match, HTML-escapes it and wraps
+// every term match inside it in <mark> tags. Returns "" when no term occurs in text.
+func highlightSnippet(text string, terms []string, radius int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	// Prefer the longest term where several match at the same position
+	sorted := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		sorted = append(sorted, []rune(term))
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	matchAt := func(i int) int {
+		if i > 0 && isWordRune(lower[i-1]) {
+			return 0
+		}
+		for _, term := range sorted {
+			end := i + len(term)
+			if end > len(lower) || string(lower[i:end]) != string(term) {
+				continue
+			}
+			if end < len(lower) && isWordRune(lower[end]) {
+				continue
+			}
+			return len(term)
+		}
+		return 0
+	}
+
+	first := -1
+	for i := range lower {
+		if matchAt(i) > 0 {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start := max(first-radius, 0)
+	end := min(first+radius, len(runes))
+	// Avoid cutting words in half at the window edges
+	for start > 0 && isWordRune(lower[start-1]) && first-start < radius+20 {
+		start--
+	}
+	for end < len(runes) && isWordRune(lower[end]) && end-first < radius+20 {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	plainStart := start
+	for i := start; i < end; {
+		length := matchAt(i)
+		if length == 0 {
+			i++
+			continue
+		}
+		matchEnd := min(i+length, end)
+		b.WriteString(html.EscapeString(string(runes[plainStart:i])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[i:matchEnd])))
+		b.WriteString("</mark>")
+		i = matchEnd
+		plainStart = matchEnd
+	}
+	b.WriteString(html.EscapeString(string(runes[plainStart:end])))
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+const (
+	defaultSampleTemperature  = 0.7 // Enough variety for samples to disagree on weakly supported elements
+	maxSelfConsistencySamples = 10
+)
+
+// sampleModelName is the form of model names a request may choose; they become part of the model service URL
+var sampleModelName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*$`)
+
+// extractionSample identifies one self-consistency sample. The zero value is an ordinary extraction.
+type extractionSample struct {
+	Index       int
+	Temperature *float64
+	Model       string
+}
+
+// SelfConsistencyReport summarizes how the samples of a self-consistency extraction agreed
+type SelfConsistencyReport struct {
+	Samples         int `json:"samples"`          // Samples successfully extracted
+	MinSupport      int `json:"min_support"`      // Samples an element had to appear in to be kept
+	ElementsAligned int `json:"elements_aligned"` // Distinct nodes and relationships across all samples
+	ElementsKept    int `json:"elements_kept"`
+}
+
+// normalizeSelfConsistency validates self-consistency options and fills in their defaults. It returns nil
+// when the options leave self-consistency disabled.
+func normalizeSelfConsistency(options *models.SelfConsistencyOptions) (*models.SelfConsistencyOptions, error) {
+	if options == nil || options.Samples <= 1 {
+		return nil, nil
+	}
+	if options.Samples > maxSelfConsistencySamples {
+		return nil, fmt.Errorf("selfConsistency.samples must be at most %d", maxSelfConsistencySamples)
+	}
+
+	normalized := *options
+	if normalized.MinSupport <= 0 {
+		normalized.MinSupport = normalized.Samples/2 + 1
+	}
+	if normalized.MinSupport > normalized.Samples {
+		return nil, fmt.Errorf("selfConsistency.minSupport (%d) cannot exceed samples (%d)", normalized.MinSupport, normalized.Samples)
+	}
+	if normalized.Temperature == nil {
+		temperature := defaultSampleTemperature
+		normalized.Temperature = &temperature
+	} else if *normalized.Temperature < 0 || *normalized.Temperature > 2 {
+		return nil, fmt.Errorf("selfConsistency.temperature must be between 0 and 2")
+	}
+	normalized.Models = nil
+	for _, model := range options.Models {
+		if model = strings.TrimSpace(model); model == "" {
+			continue
+		}
+		if !sampleModelName.MatchString(model) {
+			return nil, fmt.Errorf("selfConsistency.models: %q is not a valid model name", model)
+		}
+		normalized.Models = append(normalized.Models, model)
+	}
+	return &normalized, nil
+}
+
+// extractSelfConsistentPlan draws several extractions of the narrative, aligns their elements by name and
+// embedding, and keeps the elements found in at least MinSupport samples. Each kept action carries the share
+// of samples it appeared in as its confidence. Failed samples are logged and left out, as long as enough
+// succeed to reach MinSupport.
+func (h *Handler) extractSelfConsistentPlan(ctx context.Context, narrative *models.Narrative, prompts ExtractionPrompts, vocabulary string, options *models.SelfConsistencyOptions) (models.LLMResponse, int, *SelfConsistencyReport, error) {
+	plans := make([]*models.LLMResponse, options.Samples)
+	errs := make([]error, options.Samples)
+	chunkCounts := make([]int, options.Samples)
+	var wg sync.WaitGroup
+	for i := 0; i < options.Samples; i++ {
+		sample := extractionSample{Index: i, Temperature: options.Temperature}
+		if len(options.Models) > 0 {
+			sample.Model = options.Models[i%len(options.Models)]
+		}
+		wg.Add(1)
+		go func(i int, sample extractionSample) {
+			defer wg.Done()
+			plan, chunks, err := h.extractChunkedPlan(ctx, narrative, prompts, vocabulary, sample)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			plans[i], chunkCounts[i] = &plan, chunks
+		}(i, sample)
+	}
+	wg.Wait()
+
+	var samples []models.LLMResponse
+	var lastErr error
+	chunkCount := 0
+	for i, plan := range plans {
+		if plan == nil {
+			log.Printf("Warning: Self-consistency sample %d/%d failed for narrative %s: %v", i+1, options.Samples, narrative.ID, errs[i])
+			lastErr = errs[i]
+			continue
+		}
+		samples = append(samples, *plan)
+		chunkCount = chunkCounts[i] // Every sample splits the narrative the same way
+	}
+	if len(samples) < options.MinSupport {
+		if len(samples) == 0 {
+			return models.LLMResponse{}, 0, nil, lastErr
+		}
+		return models.LLMResponse{}, 0, nil, &llm.Error{
+			Status:  http.StatusBadGateway,
+			Message: fmt.Sprintf("only %d of %d self-consistency samples succeeded, fewer than minSupport %d: %v", len(samples), options.Samples, options.MinSupport, lastErr),
+		}
+	}
+
+	aligned, origins := h.alignPlans(ctx, narrative.ID, "sample_alignment", samples)
+	report := &SelfConsistencyReport{Samples: len(samples), MinSupport: options.MinSupport, ElementsAligned: len(aligned.Actions)}
+
+	// Keep well-supported nodes, remembering dropped names so relationships to them are dropped too
+	var plan models.LLMResponse
+	dropped := make(map[string]bool) // type|name of dropped nodes
+	for i, action := range aligned.Actions {
+		if _, isNode := nodeActionTypes[action.FunctionName]; !isNode {
+			continue
+		}
+		if len(origins[i]) < options.MinSupport {
+			name, _ := action.Parameters["name"].(string)
+			dropped[actionNodeType(action)+"|"+name] = true
+			continue
+		}
+		action.Confidence = float64(len(origins[i])) / float64(len(samples))
+		plan.Actions = append(plan.Actions, action)
+	}
+	for i, action := range aligned.Actions {
+		if _, isRelationship := relationshipNameParams[action.FunctionName]; !isRelationship {
+			continue
+		}
+		if len(origins[i]) < options.MinSupport || referencesDroppedNode(action, dropped) {
+			continue
+		}
+		action.Confidence = float64(len(origins[i])) / float64(len(samples))
+		plan.Actions = append(plan.Actions, action)
+	}
+	report.ElementsKept = len(plan.Actions)
+
+	log.Printf("Self-consistency for narrative %s: kept %d of %d elements found in at least %d of %d samples",
+		narrative.ID, report.ElementsKept, report.ElementsAligned, options.MinSupport, len(samples))
+	return plan, chunkCount, report, nil
+}
+
+// referencesDroppedNode reports whether a relationship action names a node in dropped (keyed by type|name)
+func referencesDroppedNode(action models.LLMAction, dropped map[string]bool) bool {
+	for param, typeSource := range relationshipNameParams[action.FunctionName] {
+		name, _ := action.Parameters[param].(string)
+		nodeType := typeSource
+		if action.FunctionName == "CreateCausalLinkRelationship" {
+			nodeType, _ = action.Parameters[typeSource].(string)
+			nodeType = strings.ToLower(nodeType)
+		}
+		if dropped[nodeType+"|"+name] {
+			return true
+		}
+	}
+	return false
+}
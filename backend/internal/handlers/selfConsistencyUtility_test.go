@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+)
+
+func TestNormalizeSelfConsistencyValidatesModels(t *testing.T) {
+	tests := []struct {
+		name    string
+		models  []string
+		want    []string
+		wantErr bool
+	}{
+		{"none", nil, nil, false},
+		{"trimmed and blank dropped", []string{" gemini-2.5-flash ", "", "gemini-2.5-pro"}, []string{"gemini-2.5-flash", "gemini-2.5-pro"}, false},
+		{"path traversal", []string{"../../files"}, nil, true},
+		{"parent directory", []string{".."}, nil, true},
+		{"current directory", []string{"."}, nil, true},
+		{"leading hyphen", []string{"-gemini"}, nil, true},
+		{"query string", []string{"gemini-2.5-pro:generateContent?key=x"}, nil, true},
+		{"slash", []string{"models/gemini-2.5-pro"}, nil, true},
+		{"upper case", []string{"Gemini-2.5-Pro"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := normalizeSelfConsistency(&models.SelfConsistencyOptions{Samples: 3, Models: tt.models})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("normalizeSelfConsistency() accepted models %q", tt.models)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeSelfConsistency() error = %v", err)
+			}
+			if !slices.Equal(normalized.Models, tt.want) {
+				t.Errorf("Models = %q, want %q", normalized.Models, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSemanticSearchLimit = 10
+	maxSemanticSearchLimit     = 50
+)
+
+// SemanticSearch - Ranks consolidated concepts and narratives by embedding similarity to a free-text query.
+// Narratives have no embeddings of their own, so they are ranked through the consolidated concepts they
+// support and only show up once they have been analyzed and consolidated.
+func (h *Handler) SemanticSearch(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req models.SemanticSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query cannot be empty"})
+		return
+	}
+	if len(query) > maxSearchQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is too long"})
+		return
+	}
+
+	types := searchTypes
+	if len(req.Types) > 0 {
+		types = nil
+		for _, t := range req.Types {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if !slices.Contains(searchTypes, t) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown type '" + t + "'. Use narrative, system, stock or flow"})
+				return
+			}
+			if !slices.Contains(types, t) {
+				types = append(types, t)
+			}
+		}
+	}
+
+	limit := defaultSemanticSearchLimit
+	if req.Limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	} else if req.Limit > 0 {
+		limit = min(req.Limit, maxSemanticSearchLimit)
+	}
+	if req.MinSimilarity < -1 || req.MinSimilarity > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "minSimilarity must be between -1 and 1"})
+		return
+	}
+
+	concepts, err := h.rankConsolidatedConcepts(ctx, query, req.MinSimilarity)
+	if err != nil {
+		var llmErr *llm.Error
+		if errors.As(err, &llmErr) {
+			c.JSON(llmErr.Status, gin.H{"error": "Failed to embed query: " + llmErr.Message})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	hits := []models.SemanticSearchHit{}
+	for _, concept := range concepts {
+		if slices.Contains(types, concept.Type) {
+			hits = append(hits, concept)
+		}
+	}
+	if slices.Contains(types, "narrative") {
+		narratives, err := h.rankNarrativesByConcepts(ctx, concepts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		hits = append(hits, narratives...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"query": query,
+		"total": len(hits),
+		"hits":  hits,
+	})
+}
+
+// rankConsolidatedConcepts embeds the query and returns every consolidated System, Stock and Flow at least
+// minSimilarity similar to it, best matches first
+func (h *Handler) rankConsolidatedConcepts(ctx context.Context, query string, minSimilarity float64) ([]models.SemanticSearchHit, error) {
+	candidates, err := h.fetchEmbeddedConsolidatedConcepts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch consolidated concepts: %v", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	queryEmbedding, err := h.generateEmbedding(ctx, "semantic_search", query, llm.Trace{})
+	if err != nil {
+		return nil, err
+	}
+
+	var concepts []models.SemanticSearchHit
+	for _, candidate := range candidates {
+		score, err := cosineSimilarity(queryEmbedding, candidate.Embedding)
+		if err != nil || score < minSimilarity {
+			continue
+		}
+		concepts = append(concepts, models.SemanticSearchHit{
+			ID:          candidate.ID,
+			Type:        candidate.NodeType,
+			Name:        candidate.Name,
+			Description: candidate.Description,
+			Score:       score,
+		})
+	}
+
+	sort.SliceStable(concepts, func(i, j int) bool { return concepts[i].Score > concepts[j].Score })
+	return concepts, nil
+}
+
+// embeddedConcept is a consolidated System, Stock or Flow with the embedding it is ranked by
+type embeddedConcept struct {
+	ID          string
+	NodeType    string // "system", "stock", "flow"
+	Name        string
+	Description string
+	Embedding   []float32
+}
+
+// fetchEmbeddedConsolidatedConcepts reads the consolidated Systems, Stocks and Flows that have an embedding,
+// with only the fields search ranks and returns. Staged nodes and their embeddings are never read.
+func (h *Handler) fetchEmbeddedConsolidatedConcepts(ctx context.Context) ([]embeddedConcept, error) {
+	query := `MATCH (n) WHERE (n:System OR n:Stock OR n:Flow) AND n.consolidated = true AND n.embedded = true
+		RETURN n.id as id, [l IN labels(n) WHERE l IN ['System', 'Stock', 'Flow']][0] as label, n.name as name,
+			COALESCE(n.boundary_description, n.description, '') as description, n.embedding as embedding`
+	records, err := h.db.ExecuteRead(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	concepts := make([]embeddedConcept, 0, len(records))
+	for _, record := range records {
+		concepts = append(concepts, embeddedConcept{
+			ID:          getStringValue(record, "id"),
+			NodeType:    strings.ToLower(getStringValue(record, "label")),
+			Name:        getStringValue(record, "name"),
+			Description: getStringValue(record, "description"),
+			Embedding:   h.convertEmbedding(record["embedding"]),
+		})
+	}
+	return concepts, nil
+}
+
+// rankNarrativesByConcepts scores each narrative supporting one of the ranked concepts with the best score
+// among the concepts it supports
+func (h *Handler) rankNarrativesByConcepts(ctx context.Context, concepts []models.SemanticSearchHit) ([]models.SemanticSearchHit, error) {
+	if len(concepts) == 0 {
+		return nil, nil
+	}
+	scores := make(map[string]float64, len(concepts))
+	ids := make([]string, 0, len(concepts))
+	for _, concept := range concepts {
+		scores[concept.ID] = concept.Score
+		ids = append(ids, concept.ID)
+	}
+
+	// A concept is supported by the narratives it came from and those whose relationships reuse it
+	query := `MATCH (x) WHERE x.id IN $ids
+		UNWIND COALESCE(x.source_narratives, [s IN [x.narrative_id] WHERE s IS NOT NULL]) + ` + fmt.Sprintf(relationshipNarratives, "x") + ` as narrative_id
+		WITH DISTINCT x, narrative_id
+		MATCH (n:Narrative {id: narrative_id})
+		RETURN n.id as id, n.title as title, collect(DISTINCT x.id) as concepts`
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read supporting narratives: %v", err)
+	}
+
+	narratives := make([]models.SemanticSearchHit, 0, len(records))
+	for _, record := range records {
+		supported := getStringList(record, "concepts")
+		sort.SliceStable(supported, func(i, j int) bool { return scores[supported[i]] > scores[supported[j]] })
+		narratives = append(narratives, models.SemanticSearchHit{
+			ID:       getStringValue(record, "id"),
+			Type:     "narrative",
+			Name:     getStringValue(record, "title"),
+			Score:    scores[supported[0]],
+			Concepts: supported,
+		})
+	}
+	return narratives, nil
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/llm"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/prompts"
+)
+
+// extractionStageSpec describes one stage of a staged extraction: the prompt it runs and the actions it may
+// produce. Stages are numbered from 1 in the order of extractionStages.
+type extractionStageSpec struct {
+	Name      string
+	Prompt    string
+	Functions map[string]bool
+	LinkTypes map[string]bool // Node types the stage may link from the Existing Concepts
+}
+
+var extractionStages = []extractionStageSpec{
+	{
+		Name:      "systems",
+		Prompt:    prompts.StageSystems,
+		Functions: map[string]bool{"CreateSystemNode": true, "LinkExistingNode": true, "CreateDescribesRelationship": true},
+		LinkTypes: map[string]bool{"system": true},
+	},
+	{
+		Name:   "components",
+		Prompt: prompts.StageComponents,
+		Functions: map[string]bool{"CreateStockNode": true, "CreateFlowNode": true, "LinkExistingNode": true,
+			"CreateDescribesStaticRelationship": true, "CreateDescribesDynamicRelationship": true},
+		LinkTypes: map[string]bool{"stock": true, "flow": true},
+	},
+	{
+		Name:      "connections",
+		Prompt:    prompts.StageConnections,
+		Functions: map[string]bool{"CreateChangesRelationship": true, "CreateConstitutesRelationship": true},
+	},
+	{
+		Name:      "hypotheses",
+		Prompt:    prompts.StageHypotheses,
+		Functions: map[string]bool{"CreateCausalLinkRelationship": true},
+	},
+}
+
+// nodeRequiredParams lists the string parameters each node action must carry
+var nodeRequiredParams = map[string][]string{
+	"LinkExistingNode": {"type", "id", "name"},
+	"CreateSystemNode": {"name", "boundaryDescription"},
+	"CreateStockNode":  {"name", "description", "type"},
+	"CreateFlowNode":   {"name", "description"},
+}
+
+// stageNodes holds the nodes accepted by earlier stages, by type and normalized name, with the name they
+// were accepted under
+type stageNodes map[string]map[string]string
+
+func (n stageNodes) add(nodeType, name string) {
+	if n[nodeType] == nil {
+		n[nodeType] = make(map[string]string)
+	}
+	if _, exists := n[nodeType][normalizeElementName(name)]; !exists {
+		n[nodeType][normalizeElementName(name)] = name
+	}
+}
+
+func (n stageNodes) resolve(nodeType, name string) (string, bool) {
+	canonical, ok := n[nodeType][normalizeElementName(name)]
+	return canonical, ok
+}
+
+// parseExtractionStage accepts a stage by number (1-4) or name
+func parseExtractionStage(value string) (int, bool) {
+	for i, spec := range extractionStages {
+		if value == fmt.Sprint(i+1) || strings.EqualFold(value, spec.Name) {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// runExtractionStages runs the stages of a run from stage from onward, each given the validated actions of
+// the stages before it. Every stage is persisted as it finishes, so a failed stage can be rerun on its own.
+// The run ends up extracted when all stages succeed, or failed at the first stage that does not.
+func (h *Handler) runExtractionStages(ctx context.Context, narrative *models.Narrative, run *ExtractionRun, from int) error {
+	groundingIndex := indexGroundingConcepts(run.Grounding)
+	vocabulary := formatGroundingVocabulary(run.Grounding)
+
+	// Later stages were built on the output being replaced, so they are reset too
+	for i := from - 1; i < len(run.Stages); i++ {
+		run.Stages[i] = ExtractionStage{Number: i + 1, Name: extractionStages[i].Name, Status: StageStatusPending, Attempts: run.Stages[i].Attempts}
+	}
+	run.Status, run.Error = RunStatusRunning, ""
+	if err := h.saveExtractionRun(ctx, run); err != nil {
+		return err
+	}
+
+	for i := from - 1; i < len(extractionStages); i++ {
+		spec := extractionStages[i]
+		stage := &run.Stages[i]
+		stage.Attempts++
+		stage.StartedAt = time.Now().Format(time.RFC3339)
+
+		template := h.activePrompt(ctx, spec.Prompt)
+		stage.PromptVersion = template.Ref()
+		plan, err := h.extractStagePlan(ctx, narrative, template, vocabulary, formatPreviousStages(run.Stages[:i]))
+		if err == nil {
+			stage.Actions, stage.Rejected = validateStageActions(spec, plan.Actions, narrative.Title, acceptedStageNodes(run.Stages[:i], groundingIndex), groundingIndex)
+			for j := range stage.Actions {
+				stage.Actions[j].PromptVersion = stage.PromptVersion
+			}
+			if i == 0 && len(stage.Actions) == 0 {
+				err = fmt.Errorf("no valid systems were extracted")
+			}
+		}
+		stage.FinishedAt = time.Now().Format(time.RFC3339)
+
+		if err != nil {
+			stage.Status, stage.Error = StageStatusFailed, err.Error()
+			run.Status, run.Error = RunStatusFailed, fmt.Sprintf("stage %d (%s) failed: %v", stage.Number, stage.Name, err)
+			if saveErr := h.saveExtractionRun(ctx, run); saveErr != nil {
+				log.Printf("Warning: Failed to record failure of extraction run %s: %v", run.ID, saveErr)
+			}
+			prefix := fmt.Sprintf("extraction run %s failed at stage %d (%s): ", run.ID, stage.Number, stage.Name)
+			if llmErr, ok := err.(*llm.Error); ok {
+				return &llm.Error{Status: llmErr.Status, Message: prefix + llmErr.Message}
+			}
+			return &llm.Error{Status: http.StatusBadGateway, Message: prefix + err.Error()}
+		}
+
+		stage.Status = StageStatusSucceeded
+		if err := h.saveExtractionRun(ctx, run); err != nil {
+			return err
+		}
+		log.Printf("Extraction run %s: stage %d (%s) kept %d actions, rejected %d", run.ID, stage.Number, stage.Name, len(stage.Actions), len(stage.Rejected))
+	}
+
+	run.Status = RunStatusExtracted
+	return h.saveExtractionRun(ctx, run)
+}
+
+// extractStagePlan runs one stage prompt over every chunk of the narrative and merges the chunk plans
+func (h *Handler) extractStagePlan(ctx context.Context, narrative *models.Narrative, template prompts.Template, vocabulary, previousStages string) (models.LLMResponse, error) {
+	chunks := chunkNarrative(narrative.Content, analysisChunkMaxChars, analysisChunkOverlapChars)
+	plans := make([]models.LLMResponse, 0, len(chunks))
+	for _, chunk := range chunks {
+		response, err := h.llm.Generate(ctx, llm.Request{
+			Purpose:      "extraction_stage",
+			SystemPrompt: template.System,
+			UserPrompt:   fmt.Sprintf(template.User, vocabulary, narrative.Title, formatChunkContent(chunk), previousStages),
+			JSON:         true,
+			Trace:        llm.Trace{NarrativeID: narrative.ID, PromptVersion: template.Ref()},
+		})
+		if err != nil {
+			return models.LLMResponse{}, err
+		}
+
+		var plan models.LLMResponse
+		err = json.Unmarshal([]byte(response.Text), &plan)
+		h.recordParseOutcome(ctx, response, err)
+		if err != nil {
+			log.Printf("ERROR: Failed to unmarshal %s plan: %v. Content was: %s", template.Ref(), err, response.Text)
+			return models.LLMResponse{}, &llm.Error{Status: http.StatusInternalServerError, Message: "Failed to parse LLM's structured plan"}
+		}
+		plans = append(plans, plan)
+	}
+	return h.mergeChunkPlans(ctx, narrative.ID, plans), nil
+}
+
+// formatPreviousStages renders the validated actions of earlier stages as context for the next stage prompt
+func formatPreviousStages(stages []ExtractionStage) string {
+	if len(stages) == 0 {
+		return "None. This is the first stage."
+	}
+
+	var sb strings.Builder
+	for _, stage := range stages {
+		fmt.Fprintf(&sb, "Stage %d (%s):\n", stage.Number, stage.Name)
+		if len(stage.Actions) == 0 {
+			sb.WriteString("- None\n")
+		}
+		for _, action := range stage.Actions {
+			params, _ := json.Marshal(action.Parameters)
+			fmt.Fprintf(&sb, "- %s %s\n", action.FunctionName, params)
+		}
+	}
+	return sb.String()
+}
+
+// acceptedStageNodes collects the nodes created or linked by the validated actions of earlier stages
+func acceptedStageNodes(stages []ExtractionStage, groundingIndex map[string]GroundingConcept) stageNodes {
+	nodes := make(stageNodes)
+	for _, stage := range stages {
+		for _, action := range stage.Actions {
+			if _, isNode := nodeActionTypes[action.FunctionName]; !isNode {
+				continue
+			}
+			name, _ := action.Parameters["name"].(string)
+			nodes.add(actionNodeType(action), name)
+			if action.FunctionName == "LinkExistingNode" {
+				id, _ := action.Parameters["id"].(string)
+				nodes.add(actionNodeType(action), groundingIndex[id].Name)
+			}
+		}
+	}
+	return nodes
+}
+
+// validateStageActions keeps the actions a stage may produce whose parameters are complete and whose
+// relationships connect nodes accepted by this or an earlier stage. Relationship endpoints are rewritten to
+// the names the nodes were accepted under. Everything else is returned as rejected, with the reason.
+func validateStageActions(spec extractionStageSpec, actions []models.LLMAction, narrativeTitle string, nodes stageNodes, groundingIndex map[string]GroundingConcept) ([]models.LLMAction, []RejectedAction) {
+	var valid []models.LLMAction
+	var rejected []RejectedAction
+	reject := func(action models.LLMAction, format string, args ...interface{}) {
+		rejected = append(rejected, RejectedAction{Action: action, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	// Nodes first, so relationships of the same stage can refer to them
+	for _, action := range actions {
+		required, isNode := nodeRequiredParams[action.FunctionName]
+		if !isNode {
+			continue
+		}
+		if !spec.Functions[action.FunctionName] {
+			reject(action, "%s is not part of the %s stage", action.FunctionName, spec.Name)
+			continue
+		}
+		if missing := missingStringParams(action.Parameters, required); missing != "" {
+			reject(action, "missing parameter %s", missing)
+			continue
+		}
+		nodeType := actionNodeType(action)
+		if action.FunctionName == "LinkExistingNode" {
+			id, _ := action.Parameters["id"].(string)
+			concept, ok := groundingIndex[id]
+			if !ok || concept.NodeType != nodeType {
+				reject(action, "unknown %s id %q", nodeType, id)
+				continue
+			}
+			if !spec.LinkTypes[nodeType] {
+				reject(action, "the %s stage does not link %s nodes", spec.Name, nodeType)
+				continue
+			}
+			nodes.add(nodeType, concept.Name)
+		}
+		name, _ := action.Parameters["name"].(string)
+		nodes.add(nodeType, name)
+		valid = append(valid, action)
+	}
+
+	for _, action := range actions {
+		if _, isNode := nodeRequiredParams[action.FunctionName]; isNode {
+			continue
+		}
+		nameParams, isRelationship := relationshipNameParams[action.FunctionName]
+		if !isRelationship || !spec.Functions[action.FunctionName] {
+			reject(action, "%s is not part of the %s stage", action.FunctionName, spec.Name)
+			continue
+		}
+
+		params := action.Parameters
+		reason := ""
+		for param, typeSource := range nameParams {
+			nodeType := typeSource
+			if action.FunctionName == "CreateCausalLinkRelationship" {
+				nodeType, _ = params[typeSource].(string)
+				nodeType = strings.ToLower(nodeType)
+				if nodeType != "stock" && nodeType != "flow" {
+					reason = fmt.Sprintf("%s must be Stock or Flow", typeSource)
+					break
+				}
+				params = withParam(params, typeSource, nodeLabel(nodeType))
+			}
+			name, _ := params[param].(string)
+			canonical, ok := nodes.resolve(nodeType, name)
+			if !ok {
+				reason = fmt.Sprintf("%s refers to unknown %s %q", param, nodeType, name)
+				break
+			}
+			params = withParam(params, param, canonical)
+		}
+		if reason == "" {
+			switch action.FunctionName {
+			case "CreateDescribesRelationship":
+				// There is only one narrative, so its title is filled in rather than checked
+				params = withParam(params, "narrativeName", narrativeTitle)
+			case "CreateChangesRelationship":
+				if _, ok := params["polarity"].(float64); !ok {
+					reason = "polarity must be a number"
+				}
+			case "CreateCausalLinkRelationship":
+				if missing := missingStringParams(params, []string{"curiosity"}); missing != "" {
+					reason = "missing parameter " + missing
+				} else if _, ok := params["curiosityScore"].(float64); !ok {
+					reason = "curiosityScore must be a number"
+				}
+			}
+		}
+		if reason != "" {
+			reject(action, "%s", reason)
+			continue
+		}
+		action.Parameters = params
+		valid = append(valid, action)
+	}
+	return valid, rejected
+}
+
+// missingStringParams returns the first of names that is not a non-empty string parameter
+func missingStringParams(params map[string]interface{}, names []string) string {
+	for _, name := range names {
+		if value, ok := params[name].(string); !ok || strings.TrimSpace(value) == "" {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,635 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anuragk02/jna-nuh-yoh-guh/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// STAGING AREA - REVIEW UNCONSOLIDATED EXTRACTIONS BEFORE CONSOLIDATION
+// =============================================================================
+
+// stagedRelationshipTypes are the relationship types extraction creates between narratives and concepts
+var stagedRelationshipTypes = []string{"DESCRIBES", "CONSTITUTES", "DESCRIBES_STATIC", "DESCRIBES_DYNAMIC", "CHANGES", "CAUSAL_LINK"}
+
+// relationshipEndpointTypes lists the node types each relationship type may start and end at
+var relationshipEndpointTypes = map[string][2][]string{
+	"DESCRIBES":         {{"narrative"}, {"system"}},
+	"CONSTITUTES":       {{"system"}, {"system"}},
+	"DESCRIBES_STATIC":  {{"stock"}, {"system"}},
+	"DESCRIBES_DYNAMIC": {{"flow"}, {"system"}},
+	"CHANGES":           {{"flow"}, {"stock"}},
+	"CAUSAL_LINK":       {{"stock", "flow"}, {"stock", "flow"}},
+}
+
+// stagingAutoApprove reports whether STAGING_AUTO_APPROVE marks extracted elements as approved on creation,
+// so they skip review and go straight to the next consolidation
+func stagingAutoApprove() bool {
+	autoApprove, _ := strconv.ParseBool(os.Getenv("STAGING_AUTO_APPROVE"))
+	return autoApprove
+}
+
+// StagedNode is an unconsolidated System, Stock or Flow awaiting consolidation
+type StagedNode struct {
+	ID                   string  `json:"id"`
+	NodeType             string  `json:"nodeType"` // "system", "stock", "flow"
+	Name                 string  `json:"name"`
+	Description          string  `json:"description"`
+	StockType            string  `json:"stockType,omitempty"`
+	NarrativeID          string  `json:"narrativeId,omitempty"`
+	PromptVersion        string  `json:"promptVersion,omitempty"`
+	Confidence           float64 `json:"confidence,omitempty"`
+	Embedded             bool    `json:"embedded"`
+	Approved             bool    `json:"approved"`
+	PendingRelationships int     `json:"pendingRelationships"` // Unconsolidated relationships not approved yet
+	Ready                bool    `json:"ready"`                // Approved and embedded: the next consolidation will consume the node
+	CreatedAt            string  `json:"createdAt,omitempty"`
+}
+
+// StagedRelationship is an unconsolidated relationship awaiting consolidation. Its id is the Neo4j element id.
+type StagedRelationship struct {
+	ID             string   `json:"id"`
+	Type           string   `json:"type"`
+	FromID         string   `json:"fromId"`
+	FromType       string   `json:"fromType"`
+	FromName       string   `json:"fromName"`
+	ToID           string   `json:"toId"`
+	ToType         string   `json:"toType"`
+	ToName         string   `json:"toName"`
+	Polarity       *float64 `json:"polarity,omitempty"`
+	Question       string   `json:"question,omitempty"`
+	CuriosityScore *float64 `json:"curiosityScore,omitempty"`
+	NarrativeID    string   `json:"narrativeId,omitempty"`
+	PromptVersion  string   `json:"promptVersion,omitempty"`
+	Confidence     float64  `json:"confidence,omitempty"`
+	Approved       bool     `json:"approved"`
+	CreatedAt      string   `json:"createdAt,omitempty"`
+}
+
+// StagingGroup holds the staged elements extracted from one narrative
+type StagingGroup struct {
+	NarrativeID   string               `json:"narrativeId"` // Empty for elements without provenance
+	Title         string               `json:"title,omitempty"`
+	Nodes         []StagedNode         `json:"nodes"`
+	Relationships []StagedRelationship `json:"relationships"`
+}
+
+const stagedNodeReturn = `
+	OPTIONAL MATCH (n)-[pending]-() WHERE (pending.consolidated = false OR pending.consolidated IS NULL) AND COALESCE(pending.approved, false) = false
+	WITH n, count(pending) as pending
+	RETURN n.id as id, [l IN labels(n) WHERE l IN ['System', 'Stock', 'Flow']][0] as label, n.name as name,
+	       COALESCE(n.boundary_description, n.description, '') as description, n.type as stock_type,
+	       n.narrative_id as narrative_id, n.prompt_version as prompt_version, n.confidence as confidence,
+	       COALESCE(n.embedded, false) as embedded, COALESCE(n.approved, false) as approved,
+	       COALESCE(n.consolidated, false) as consolidated, pending, n.created_at as created_at`
+
+func stagedNodeFromRecord(record map[string]interface{}) StagedNode {
+	embedded, _ := record["embedded"].(bool)
+	approved, _ := record["approved"].(bool)
+	confidence, _ := record["confidence"].(float64)
+	node := StagedNode{
+		ID:                   getStringValue(record, "id"),
+		NodeType:             strings.ToLower(getStringValue(record, "label")),
+		Name:                 getStringValue(record, "name"),
+		Description:          getStringValue(record, "description"),
+		StockType:            getStringValue(record, "stock_type"),
+		NarrativeID:          getStringValue(record, "narrative_id"),
+		PromptVersion:        getStringValue(record, "prompt_version"),
+		Confidence:           confidence,
+		Embedded:             embedded,
+		Approved:             approved,
+		PendingRelationships: int(getInt64Value(record, "pending")),
+		CreatedAt:            getStringValue(record, "created_at"),
+	}
+	node.Ready = node.Approved && node.Embedded
+	return node
+}
+
+const stagedRelationshipReturn = `
+	RETURN elementId(r) as id, type(r) as type,
+	       a.id as from_id, [l IN labels(a) WHERE l IN ['Narrative', 'System', 'Stock', 'Flow']][0] as from_label, COALESCE(a.name, a.title) as from_name,
+	       b.id as to_id, [l IN labels(b) WHERE l IN ['Narrative', 'System', 'Stock', 'Flow']][0] as to_label, COALESCE(b.name, b.title) as to_name,
+	       r.polarity as polarity, r.question as question, r.curiosity_score as curiosity_score,
+	       r.narrative_id as narrative_id, r.prompt_version as prompt_version, r.confidence as confidence,
+	       COALESCE(r.approved, false) as approved, COALESCE(r.consolidated, false) as consolidated, r.created_at as created_at`
+
+func stagedRelationshipFromRecord(record map[string]interface{}) StagedRelationship {
+	approved, _ := record["approved"].(bool)
+	confidence, _ := record["confidence"].(float64)
+	relationship := StagedRelationship{
+		ID:            getStringValue(record, "id"),
+		Type:          getStringValue(record, "type"),
+		FromID:        getStringValue(record, "from_id"),
+		FromType:      strings.ToLower(getStringValue(record, "from_label")),
+		FromName:      getStringValue(record, "from_name"),
+		ToID:          getStringValue(record, "to_id"),
+		ToType:        strings.ToLower(getStringValue(record, "to_label")),
+		ToName:        getStringValue(record, "to_name"),
+		Question:      getStringValue(record, "question"),
+		NarrativeID:   getStringValue(record, "narrative_id"),
+		PromptVersion: getStringValue(record, "prompt_version"),
+		Confidence:    confidence,
+		Approved:      approved,
+		CreatedAt:     getStringValue(record, "created_at"),
+	}
+	if polarity, ok := record["polarity"].(float64); ok {
+		relationship.Polarity = &polarity
+	}
+	if score, ok := record["curiosity_score"].(float64); ok {
+		relationship.CuriosityScore = &score
+	}
+	return relationship
+}
+
+// countNodesAwaitingApproval returns how many staged Systems, Stocks and Flows consolidation skips until they
+// are approved
+func (h *Handler) countNodesAwaitingApproval(ctx context.Context) (int, error) {
+	query := `MATCH (n) WHERE (n:System OR n:Stock OR n:Flow)
+		AND COALESCE(n.consolidated, false) = false AND COALESCE(n.approved, false) = false
+		RETURN count(n) as count`
+	records, err := h.db.ExecuteRead(ctx, query, nil)
+	if err != nil {
+		return 0, err
+	}
+	return int(countFromRecords(records, "count")), nil
+}
+
+// getStagedNode reads a System, Stock or Flow with its staging status. It returns nil when there is no such
+// node; consolidated reports whether it has already left the staging area.
+func (h *Handler) getStagedNode(ctx context.Context, id string) (node *StagedNode, consolidated bool, err error) {
+	query := `MATCH (n) WHERE n.id = $id AND (n:System OR n:Stock OR n:Flow)` + stagedNodeReturn
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id})
+	if err != nil || len(records) == 0 {
+		return nil, false, err
+	}
+	staged := stagedNodeFromRecord(records[0])
+	consolidated, _ = records[0]["consolidated"].(bool)
+	return &staged, consolidated, nil
+}
+
+// requireStagedNode reads a staged node, responding with an error and returning nil when it is missing or
+// already consolidated
+func (h *Handler) requireStagedNode(c *gin.Context, id string) *StagedNode {
+	node, consolidated, err := h.getStagedNode(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if node == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		return nil
+	}
+	if consolidated {
+		c.JSON(http.StatusConflict, gin.H{"error": "Node is already consolidated; only staged nodes can be changed here"})
+		return nil
+	}
+	return node
+}
+
+// getStagedRelationship reads a relationship by element id. It returns nil when there is no such relationship.
+func (h *Handler) getStagedRelationship(ctx context.Context, id string) (relationship *StagedRelationship, consolidated bool, err error) {
+	query := `MATCH (a)-[r]->(b) WHERE elementId(r) = $id` + stagedRelationshipReturn
+	records, err := h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": id})
+	if err != nil || len(records) == 0 {
+		return nil, false, err
+	}
+	staged := stagedRelationshipFromRecord(records[0])
+	consolidated, _ = records[0]["consolidated"].(bool)
+	return &staged, consolidated, nil
+}
+
+// requireStagedRelationship reads a staged relationship, responding with an error and returning nil when it
+// is missing or already consolidated
+func (h *Handler) requireStagedRelationship(c *gin.Context, id string) *StagedRelationship {
+	relationship, consolidated, err := h.getStagedRelationship(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if relationship == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Relationship not found"})
+		return nil
+	}
+	if consolidated {
+		c.JSON(http.StatusConflict, gin.H{"error": "Relationship is already consolidated; only staged relationships can be changed here"})
+		return nil
+	}
+	return relationship
+}
+
+// ListStaging - Lists unconsolidated nodes and relationships grouped by the narrative they were extracted from.
+// Query parameters: narrative_id, type (system/stock/flow) and approved (true/false).
+func (h *Handler) ListStaging(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var label interface{}
+	if nodeType := c.Query("type"); nodeType != "" {
+		if label = nodeLabel(nodeType); label == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be system, stock or flow"})
+			return
+		}
+	}
+	var approved interface{}
+	if approvedParam := c.Query("approved"); approvedParam != "" {
+		value, err := strconv.ParseBool(approvedParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "approved must be true or false"})
+			return
+		}
+		approved = value
+	}
+	params := map[string]interface{}{
+		"narrative_id": nilIfEmpty(c.Query("narrative_id")),
+		"label":        label,
+		"approved":     approved,
+		"types":        stagedRelationshipTypes,
+	}
+
+	nodeQuery := `MATCH (n) WHERE (n:System OR n:Stock OR n:Flow)
+		  AND (n.consolidated = false OR n.consolidated IS NULL)
+		  AND ($narrative_id IS NULL OR n.narrative_id = $narrative_id)
+		  AND ($label IS NULL OR $label IN labels(n))
+		  AND ($approved IS NULL OR COALESCE(n.approved, false) = $approved)` + stagedNodeReturn + `
+		ORDER BY narrative_id, created_at`
+	nodeRecords, err := h.db.ExecuteRead(ctx, nodeQuery, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list staged nodes: " + err.Error()})
+		return
+	}
+
+	relationshipQuery := `MATCH (a)-[r]->(b) WHERE type(r) IN $types
+		  AND (r.consolidated = false OR r.consolidated IS NULL)
+		  AND ($narrative_id IS NULL OR r.narrative_id = $narrative_id)
+		  AND ($label IS NULL OR $label IN labels(a) OR $label IN labels(b))
+		  AND ($approved IS NULL OR COALESCE(r.approved, false) = $approved)` + stagedRelationshipReturn + `
+		ORDER BY narrative_id, created_at`
+	relationshipRecords, err := h.db.ExecuteRead(ctx, relationshipQuery, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list staged relationships: " + err.Error()})
+		return
+	}
+
+	// Group by source narrative, in order of first appearance
+	groups := make(map[string]*StagingGroup)
+	var order []string
+	group := func(narrativeID string) *StagingGroup {
+		if groups[narrativeID] == nil {
+			groups[narrativeID] = &StagingGroup{NarrativeID: narrativeID, Nodes: []StagedNode{}, Relationships: []StagedRelationship{}}
+			order = append(order, narrativeID)
+		}
+		return groups[narrativeID]
+	}
+	totals := map[string]int{"nodes": 0, "relationships": 0, "approved": 0, "unembedded": 0, "ready": 0}
+	for _, record := range nodeRecords {
+		node := stagedNodeFromRecord(record)
+		g := group(node.NarrativeID)
+		g.Nodes = append(g.Nodes, node)
+		totals["nodes"]++
+		if node.Approved {
+			totals["approved"]++
+		}
+		if !node.Embedded {
+			totals["unembedded"]++
+		}
+		if node.Ready {
+			totals["ready"]++
+		}
+	}
+	for _, record := range relationshipRecords {
+		relationship := stagedRelationshipFromRecord(record)
+		g := group(relationship.NarrativeID)
+		g.Relationships = append(g.Relationships, relationship)
+		totals["relationships"]++
+		if relationship.Approved {
+			totals["approved"]++
+		}
+	}
+
+	// Fill in narrative titles
+	var narrativeIDs []string
+	for _, id := range order {
+		if id != "" {
+			narrativeIDs = append(narrativeIDs, id)
+		}
+	}
+	if len(narrativeIDs) > 0 {
+		titleRecords, err := h.db.ExecuteRead(ctx, `MATCH (n:Narrative) WHERE n.id IN $ids RETURN n.id as id, n.title as title`,
+			map[string]interface{}{"ids": narrativeIDs})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read narrative titles: " + err.Error()})
+			return
+		}
+		for _, record := range titleRecords {
+			groups[getStringValue(record, "id")].Title = getStringValue(record, "title")
+		}
+	}
+
+	narratives := make([]*StagingGroup, 0, len(order))
+	for _, id := range order {
+		narratives = append(narratives, groups[id])
+	}
+	c.JSON(http.StatusOK, gin.H{"narratives": narratives, "totals": totals})
+}
+
+// UpdateStagedNode - Edits the name, description or stock type of a staged node. Changing the name or
+// description clears its embedding so the next embedding run recomputes it.
+func (h *Handler) UpdateStagedNode(c *gin.Context) {
+	var req models.StagingNodeUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	node := h.requireStagedNode(c, c.Param("id"))
+	if node == nil {
+		return
+	}
+
+	var sets []string
+	params := map[string]interface{}{"id": node.ID}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		sets = append(sets, "n.name = $name")
+		params["name"] = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		if node.NodeType == "system" {
+			sets = append(sets, "n.boundary_description = $description")
+		} else {
+			sets = append(sets, "n.description = $description")
+		}
+		params["description"] = *req.Description
+	}
+	if req.Name != nil || req.Description != nil {
+		sets = append(sets, "n.embedded = false", "n.embedding = []")
+	}
+	if req.StockType != nil {
+		if node.NodeType != "stock" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stockType only applies to stocks"})
+			return
+		}
+		if *req.StockType != "qualitative" && *req.StockType != "quantitative" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stockType must be qualitative or quantitative"})
+			return
+		}
+		sets = append(sets, "n.type = $stock_type")
+		params["stock_type"] = *req.StockType
+	}
+	if len(sets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update: set name, description or stockType"})
+		return
+	}
+
+	query := `MATCH (n {id: $id}) WHERE n.consolidated = false OR n.consolidated IS NULL SET ` + strings.Join(sets, ", ")
+	if _, err := h.db.ExecuteQuery(c.Request.Context(), query, params); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, _, err := h.getStagedNode(c.Request.Context(), node.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read updated node"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteStagedNode - Deletes a staged node together with its relationships
+func (h *Handler) DeleteStagedNode(c *gin.Context) {
+	node := h.requireStagedNode(c, c.Param("id"))
+	if node == nil {
+		return
+	}
+
+	query := `MATCH (n {id: $id}) WHERE n.consolidated = false OR n.consolidated IS NULL
+		OPTIONAL MATCH (n)-[r]-()
+		WITH n, count(r) as relationships
+		DETACH DELETE n
+		RETURN relationships`
+	records, err := h.db.ExecuteRead(c.Request.Context(), query, map[string]interface{}{"id": node.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Staged node deleted", "relationships_deleted": countFromRecords(records, "relationships")})
+}
+
+// RetypeStagedNode - Changes a staged node between System, Stock and Flow. Relationships that the new type
+// cannot take part in are reported, and only deleted when dropInvalidRelationships is set.
+func (h *Handler) RetypeStagedNode(c *gin.Context) {
+	var req models.StagingRetypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	newType := strings.ToLower(req.Type)
+	label := nodeLabel(newType)
+	if label == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type must be system, stock or flow"})
+		return
+	}
+	if newType == "stock" && req.StockType != "qualitative" && req.StockType != "quantitative" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "stockType must be qualitative or quantitative when retyping to a stock"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	node := h.requireStagedNode(c, c.Param("id"))
+	if node == nil {
+		return
+	}
+	if node.NodeType == newType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Node is already a %s", newType)})
+		return
+	}
+
+	// Find the relationships the node could not take part in as the new type
+	records, err := h.db.ExecuteRead(ctx, `MATCH (n {id: $id})-[r]-(other)
+		RETURN elementId(r) as id, type(r) as type, startNode(r) = n as outgoing, other.id as other_id, COALESCE(other.name, other.title) as other_name`,
+		map[string]interface{}{"id": node.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invalid := []gin.H{}
+	invalidIDs := []string{} // Never nil, so the query always gets a list
+	for _, record := range records {
+		endpoints, known := relationshipEndpointTypes[getStringValue(record, "type")]
+		if !known {
+			continue
+		}
+		allowed := endpoints[1]
+		if outgoing, _ := record["outgoing"].(bool); outgoing {
+			allowed = endpoints[0]
+		}
+		if slices.Contains(allowed, newType) {
+			continue
+		}
+		invalid = append(invalid, gin.H{"id": record["id"], "type": record["type"], "other_id": record["other_id"], "other_name": record["other_name"]})
+		invalidIDs = append(invalidIDs, getStringValue(record, "id"))
+	}
+	if len(invalid) > 0 && !req.DropInvalidRelationships {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                 fmt.Sprintf("%d relationships are not valid for a %s; set dropInvalidRelationships to delete them", len(invalid), newType),
+			"invalid_relationships": invalid,
+		})
+		return
+	}
+
+	// Systems keep their description as boundary_description; only stocks have a type
+	var properties string
+	switch newType {
+	case "system":
+		properties = `n.boundary_description = COALESCE(n.boundary_description, n.description) REMOVE n.description, n.type`
+	case "stock":
+		properties = `n.description = COALESCE(n.description, n.boundary_description), n.type = $stock_type REMOVE n.boundary_description`
+	case "flow":
+		properties = `n.description = COALESCE(n.description, n.boundary_description) REMOVE n.boundary_description, n.type`
+	}
+	// Moving the description between description and boundary_description changes what gets embedded,
+	// so the node is embedded again, as after an edit
+	if newType == "system" || node.NodeType == "system" {
+		properties = `n.embedded = false, n.embedding = [], ` + properties
+	}
+	// The invalid relationships go in the same statement as the label, so a failure leaves neither changed
+	query := fmt.Sprintf(`MATCH (n {id: $id}) WHERE n.consolidated = false OR n.consolidated IS NULL
+		OPTIONAL MATCH (n)-[r]-() WHERE elementId(r) IN $invalid_ids
+		DELETE r
+		WITH DISTINCT n
+		REMOVE n:System:Stock:Flow
+		SET n:%s, %s
+		RETURN n.id as id`, label, properties)
+	records, err = h.db.ExecuteRead(ctx, query, map[string]interface{}{"id": node.ID, "stock_type": req.StockType, "invalid_ids": invalidIDs})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(records) == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Node was consolidated before it could be retyped"})
+		return
+	}
+
+	updated, _, err := h.getStagedNode(ctx, node.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read retyped node"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node": updated, "relationships_deleted": invalid})
+}
+
+// UpdateStagedRelationship - Edits the polarity of a staged CHANGES relationship, or the question and
+// curiosity score of a staged CAUSAL_LINK
+func (h *Handler) UpdateStagedRelationship(c *gin.Context) {
+	var req models.RelationshipUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	relationship := h.requireStagedRelationship(c, c.Param("id"))
+	if relationship == nil {
+		return
+	}
+
+	sets, params, err := relationshipUpdateSets(relationship.Type, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params["id"] = relationship.ID
+
+	query := `MATCH ()-[r]->() WHERE elementId(r) = $id SET ` + strings.Join(sets, ", ")
+	if _, err := h.db.ExecuteQuery(c.Request.Context(), query, params); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, _, err := h.getStagedRelationship(c.Request.Context(), relationship.ID)
+	if err != nil || updated == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read updated relationship"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteStagedRelationship - Deletes a staged relationship
+func (h *Handler) DeleteStagedRelationship(c *gin.Context) {
+	relationship := h.requireStagedRelationship(c, c.Param("id"))
+	if relationship == nil {
+		return
+	}
+
+	query := `MATCH ()-[r]->() WHERE elementId(r) = $id AND (r.consolidated = false OR r.consolidated IS NULL) DELETE r`
+	if _, err := h.db.ExecuteQuery(c.Request.Context(), query, map[string]interface{}{"id": relationship.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Staged relationship deleted"})
+}
+
+// ApproveStagingItems - Marks staged nodes and relationships as ready for consolidation, by id or for a whole
+// narrative. Set approved to false to withdraw approval.
+func (h *Handler) ApproveStagingItems(c *gin.Context) {
+	var req models.StagingApprovalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+	if req.NarrativeID == "" && len(req.NodeIDs) == 0 && len(req.RelationshipIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide narrativeId, nodeIds or relationshipIds"})
+		return
+	}
+	approved := req.Approved == nil || *req.Approved
+
+	ctx := c.Request.Context()
+	params := map[string]interface{}{
+		"narrative_id":     nilIfEmpty(req.NarrativeID),
+		"node_ids":         req.NodeIDs,
+		"relationship_ids": req.RelationshipIDs,
+		"approved":         approved,
+		"types":            stagedRelationshipTypes,
+	}
+	if params["node_ids"] == nil {
+		params["node_ids"] = []string{}
+	}
+	if params["relationship_ids"] == nil {
+		params["relationship_ids"] = []string{}
+	}
+
+	nodeQuery := `MATCH (n) WHERE (n:System OR n:Stock OR n:Flow)
+		  AND (n.consolidated = false OR n.consolidated IS NULL)
+		  AND (n.id IN $node_ids OR ($narrative_id IS NOT NULL AND n.narrative_id = $narrative_id))
+		SET n.approved = $approved
+		RETURN count(n) as count`
+	nodeRecords, err := h.db.ExecuteRead(ctx, nodeQuery, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve staged nodes: " + err.Error()})
+		return
+	}
+
+	relationshipQuery := `MATCH ()-[r]->() WHERE type(r) IN $types
+		  AND (r.consolidated = false OR r.consolidated IS NULL)
+		  AND (elementId(r) IN $relationship_ids OR ($narrative_id IS NOT NULL AND r.narrative_id = $narrative_id))
+		SET r.approved = $approved
+		RETURN count(r) as count`
+	relationshipRecords, err := h.db.ExecuteRead(ctx, relationshipQuery, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve staged relationships: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"approved":              approved,
+		"nodes_updated":         countFromRecords(nodeRecords, "count"),
+		"relationships_updated": countFromRecords(relationshipRecords, "count"),
+	})
+}
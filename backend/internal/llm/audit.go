@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of audited calls
+const (
+	CallKindGenerate = "generate"
+	CallKindEmbed    = "embed"
+)
+
+// Parse outcomes of an audited call. Generated text starts as ParseUnreported until the caller reports
+// whether it could use it; embeddings are ParsePartial when some texts came back without a vector.
+const (
+	ParseOK         = "ok"
+	ParseFailed     = "failed"
+	ParsePartial    = "partial"
+	ParseUnreported = "unreported"
+)
+
+// Call is the audit record of one generation or embedding request
+type Call struct {
+	ID            string    `json:"id"`
+	Kind          string    `json:"kind"` // CallKindGenerate or CallKindEmbed
+	Purpose       string    `json:"purpose"`
+	Model         string    `json:"model"`
+	NarrativeID   string    `json:"narrativeId,omitempty"`
+	NodeIDs       []string  `json:"nodeIds,omitempty"`
+	PromptVersion string    `json:"promptVersion,omitempty"`
+	SystemPrompt  string    `json:"systemPrompt,omitempty"`
+	UserPrompt    string    `json:"userPrompt,omitempty"`
+	Texts         []string  `json:"texts,omitempty"`      // Embedded texts
+	Response      string    `json:"response,omitempty"`   // Raw generated text, then any function calls as JSON
+	Vectors       int       `json:"vectors,omitempty"`    // Embeddings returned
+	Dimensions    int       `json:"dimensions,omitempty"` // Length of each embedding
+	ParseOutcome  string    `json:"parseOutcome,omitempty"`
+	ParseError    string    `json:"parseError,omitempty"`
+	Usage         Usage     `json:"usage"`
+	LatencyMs     int64     `json:"latencyMs"`
+	Error         string    `json:"error,omitempty"`
+	ErrorStatus   int       `json:"errorStatus,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// CallStore persists audit records
+type CallStore interface {
+	SaveCall(ctx context.Context, call *Call) error
+}
+
+// auditedProvider records every request made through the Provider it wraps
+type auditedProvider struct {
+	next  Provider
+	store CallStore
+}
+
+// WithAudit wraps next so every Generate call is saved to store. The saved record's id is returned in
+// Response.CallID. Failing to save is logged and never fails the call itself.
+func WithAudit(next Provider, store CallStore) Provider {
+	return &auditedProvider{next: next, store: store}
+}
+
+func (a *auditedProvider) Model() string {
+	return a.next.Model()
+}
+
+func (a *auditedProvider) Generate(ctx context.Context, req Request) (*Response, error) {
+	started := time.Now()
+	response, err := a.next.Generate(ctx, req)
+
+	call := newCall(CallKindGenerate, req.Purpose, requestModel(a.next, req), req.Trace, started)
+	call.SystemPrompt = req.SystemPrompt
+	call.UserPrompt = req.UserPrompt
+	if err != nil {
+		recordError(call, err)
+	} else {
+		call.Model = response.Model
+		call.Response = response.Text
+		if len(response.ToolCalls) > 0 {
+			toolCalls, _ := json.Marshal(response.ToolCalls)
+			call.Response = strings.TrimSpace(call.Response + "\n" + string(toolCalls))
+		}
+		call.Usage = response.Usage
+		call.ParseOutcome = ParseUnreported
+	}
+
+	if saveCall(ctx, a.store, call) && response != nil {
+		response.CallID = call.ID
+	}
+	return response, err
+}
+
+// auditedEmbedder records every request made through the Embedder it wraps
+type auditedEmbedder struct {
+	next  Embedder
+	store CallStore
+}
+
+// WithEmbedAudit wraps next so every Embed call is saved to store. Vectors are not stored, only their count.
+func WithEmbedAudit(next Embedder, store CallStore) Embedder {
+	return &auditedEmbedder{next: next, store: store}
+}
+
+func (a *auditedEmbedder) Model() string {
+	return a.next.Model()
+}
+
+func (a *auditedEmbedder) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	started := time.Now()
+	response, err := a.next.Embed(ctx, req)
+
+	call := newCall(CallKindEmbed, req.Purpose, a.next.Model(), req.Trace, started)
+	call.Texts = req.Texts
+	if err != nil {
+		recordError(call, err)
+	} else {
+		call.ParseOutcome = ParseOK
+		for _, vector := range response.Vectors {
+			if vector == nil {
+				call.ParseOutcome = ParsePartial
+				continue
+			}
+			call.Vectors++
+			call.Dimensions = len(vector)
+		}
+		if len(response.Vectors) != len(req.Texts) {
+			call.ParseOutcome = ParsePartial
+		}
+	}
+
+	if saveCall(ctx, a.store, call) && response != nil {
+		response.CallID = call.ID
+	}
+	return response, err
+}
+
+func newCall(kind, purpose, model string, trace Trace, started time.Time) *Call {
+	return &Call{
+		ID:            uuid.New().String(),
+		Kind:          kind,
+		Purpose:       purpose,
+		Model:         model,
+		NarrativeID:   trace.NarrativeID,
+		NodeIDs:       trace.NodeIDs,
+		PromptVersion: trace.PromptVersion,
+		LatencyMs:     time.Since(started).Milliseconds(),
+		CreatedAt:     started.UTC(),
+	}
+}
+
+func recordError(call *Call, err error) {
+	call.Error = err.Error()
+	var llmErr *Error
+	if errors.As(err, &llmErr) {
+		call.ErrorStatus = llmErr.Status
+	}
+}
+
+// saveCall persists call even when the request context was cancelled, so failed calls are still audited
+func saveCall(ctx context.Context, store CallStore, call *Call) bool {
+	if err := store.SaveCall(context.WithoutCancel(ctx), call); err != nil {
+		log.Printf("Warning: Failed to save audit record for %s call: %v", call.Purpose, err)
+		return false
+	}
+	return true
+}
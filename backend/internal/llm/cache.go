@@ -0,0 +1,300 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CacheEntry is a cached generation or embedding. Value is the JSON encoded Response or vector.
+type CacheEntry struct {
+	Key       string    `json:"key"`
+	Kind      string    `json:"kind"` // CallKindGenerate or CallKindEmbed
+	Model     string    `json:"model"`
+	Value     []byte    `json:"value"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"` // Zero when the entry never expires
+}
+
+func (e *CacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// CacheFilter selects entries to invalidate. Empty fields match everything.
+type CacheFilter struct {
+	Kind          string
+	Model         string
+	ExpiredOnly   bool
+	CreatedBefore time.Time
+}
+
+func (f CacheFilter) matches(entry *CacheEntry, now time.Time) bool {
+	return (f.Kind == "" || entry.Kind == f.Kind) &&
+		(f.Model == "" || entry.Model == f.Model) &&
+		(!f.ExpiredOnly || entry.expired(now)) &&
+		(f.CreatedBefore.IsZero() || entry.CreatedAt.Before(f.CreatedBefore))
+}
+
+// CacheStore keeps cache entries by key
+type CacheStore interface {
+	// Get returns the entry for key, or nil when there is none
+	Get(ctx context.Context, key string) (*CacheEntry, error)
+	Put(ctx context.Context, entry CacheEntry) error
+	// Invalidate deletes matching entries and returns how many were deleted
+	Invalidate(ctx context.Context, filter CacheFilter) (int, error)
+}
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context whose calls skip cached responses. Fresh responses are still cached.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
+// cachedProvider serves repeated requests from a CacheStore
+type cachedProvider struct {
+	next  Provider
+	store CacheStore
+	ttl   time.Duration
+}
+
+// WithCache wraps next so identical requests to the same model are answered from store for ttl (0 keeps
+// entries until invalidated). JSON requests are only cached when the response is valid JSON, and requests
+// declaring tools only when the model called them.
+func WithCache(next Provider, store CacheStore, ttl time.Duration) Provider {
+	return &cachedProvider{next: next, store: store, ttl: ttl}
+}
+
+func (p *cachedProvider) Model() string {
+	return p.next.Model()
+}
+
+func (p *cachedProvider) Generate(ctx context.Context, req Request) (*Response, error) {
+	model := requestModel(p.next, req)
+	key := generateCacheKey(model, req)
+	if !cacheBypassed(ctx) {
+		if entry := getCacheEntry(ctx, p.store, key); entry != nil {
+			var response Response
+			if err := json.Unmarshal(entry.Value, &response); err == nil {
+				return &response, nil
+			}
+		}
+	}
+
+	response, err := p.next.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if req.JSON && !json.Valid([]byte(response.Text)) || len(req.Tools) > 0 && len(response.ToolCalls) == 0 {
+		return response, nil
+	}
+	if value, err := json.Marshal(response); err == nil {
+		putCacheEntry(ctx, p.store, newCacheEntry(key, CallKindGenerate, model, value, p.ttl))
+	}
+	return response, nil
+}
+
+// cachedEmbedder serves previously embedded texts from a CacheStore and only embeds the rest
+type cachedEmbedder struct {
+	next  Embedder
+	store CacheStore
+	ttl   time.Duration
+}
+
+// WithEmbedCache wraps next so each text is embedded once per model and served from store for ttl
+func WithEmbedCache(next Embedder, store CacheStore, ttl time.Duration) Embedder {
+	return &cachedEmbedder{next: next, store: store, ttl: ttl}
+}
+
+func (e *cachedEmbedder) Model() string {
+	return e.next.Model()
+}
+
+func (e *cachedEmbedder) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	model := e.next.Model()
+	vectors := make([][]float32, len(req.Texts))
+	keys := make([]string, len(req.Texts))
+	var missing []int
+	for i, text := range req.Texts {
+		keys[i] = embedCacheKey(model, text)
+		if !cacheBypassed(ctx) {
+			if entry := getCacheEntry(ctx, e.store, keys[i]); entry != nil && json.Unmarshal(entry.Value, &vectors[i]) == nil && len(vectors[i]) > 0 {
+				continue
+			}
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return &EmbedResponse{Vectors: vectors, Model: model}, nil
+	}
+
+	missReq := req
+	missReq.Texts = make([]string, len(missing))
+	for j, i := range missing {
+		missReq.Texts[j] = req.Texts[i]
+	}
+	response, err := e.next.Embed(ctx, missReq)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range missing {
+		if j >= len(response.Vectors) || response.Vectors[j] == nil {
+			continue
+		}
+		vectors[i] = response.Vectors[j]
+		if value, err := json.Marshal(vectors[i]); err == nil {
+			putCacheEntry(ctx, e.store, newCacheEntry(keys[i], CallKindEmbed, model, value, e.ttl))
+		}
+	}
+	return &EmbedResponse{Vectors: vectors, Model: response.Model, CallID: response.CallID}, nil
+}
+
+// generateCacheKey fingerprints everything that influences a generation: the model and the request
+// settings, prompts, declared tools and sample index, but not its purpose or trace
+func generateCacheKey(model string, req Request) string {
+	temperature := "default"
+	if req.Temperature != nil {
+		temperature = fmt.Sprintf("%g", *req.Temperature)
+	}
+	parts := []string{CallKindGenerate, model, fmt.Sprintf("json=%t", req.JSON), "temperature=" + temperature, req.SystemPrompt, req.UserPrompt}
+	if len(req.Tools) > 0 {
+		tools, _ := json.Marshal(req.Tools)
+		parts = append(parts, "tools="+string(tools))
+	}
+	// The first sample keeps the key of an unsampled request
+	if req.Sample > 0 {
+		parts = append(parts, fmt.Sprintf("sample=%d", req.Sample))
+	}
+	return cacheKey(parts...)
+}
+
+func embedCacheKey(model, text string) string {
+	return cacheKey(CallKindEmbed, model, text)
+}
+
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func newCacheEntry(key, kind, model string, value []byte, ttl time.Duration) CacheEntry {
+	entry := CacheEntry{Key: key, Kind: kind, Model: model, Value: value, CreatedAt: time.Now().UTC()}
+	if ttl > 0 {
+		entry.ExpiresAt = entry.CreatedAt.Add(ttl)
+	}
+	return entry
+}
+
+// getCacheEntry treats lookup failures and expired entries as misses
+func getCacheEntry(ctx context.Context, store CacheStore, key string) *CacheEntry {
+	entry, err := store.Get(ctx, key)
+	if err != nil {
+		log.Printf("Warning: LLM cache lookup failed: %v", err)
+		return nil
+	}
+	if entry == nil || entry.expired(time.Now()) {
+		return nil
+	}
+	return entry
+}
+
+func putCacheEntry(ctx context.Context, store CacheStore, entry CacheEntry) {
+	if err := store.Put(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("Warning: Failed to cache %s response: %v", entry.Kind, err)
+	}
+}
+
+// DiskCache stores cache entries as JSON files under a directory, sharded by the first two key characters
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a cache rooted at dir, creating it if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %v", dir, err)
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (d *DiskCache) path(key string) string {
+	return filepath.Join(d.dir, key[:2], key+".json")
+}
+
+func (d *DiskCache) Get(ctx context.Context, key string) (*CacheEntry, error) {
+	data, err := os.ReadFile(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid cache entry %s: %v", key, err)
+	}
+	return &entry, nil
+}
+
+func (d *DiskCache) Put(ctx context.Context, entry CacheEntry) error {
+	path := d.path(entry.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(filepath.Dir(path), entry.Key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *DiskCache) Invalidate(ctx context.Context, filter CacheFilter) (int, error) {
+	now := time.Now()
+	deleted := 0
+	err := filepath.WalkDir(d.dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var cached CacheEntry
+		if json.Unmarshal(data, &cached) == nil && !filter.matches(&cached, now) {
+			return nil
+		}
+		// Unreadable entries are always removed
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	return deleted, err
+}
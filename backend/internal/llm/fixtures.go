@@ -0,0 +1,255 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fixture modes: call the model and save every exchange, or answer only from saved exchanges
+const (
+	FixtureRecord = "record"
+	FixtureReplay = "replay"
+)
+
+// Fixtures records model and embedding exchanges to a directory, or replays them from it. Exchanges are
+// stored one file per request fingerprint under generate/ and embed/, so recordings diff and merge cleanly.
+// A generation fingerprint covers the prompts and request settings; an embedding fingerprint covers one text,
+// so replay does not depend on how texts were batched. Identical requests repeated within a run are replayed
+// in the order they were recorded.
+type Fixtures struct {
+	dir    string
+	replay bool
+
+	mu     sync.Mutex
+	counts map[string]int // Times each fingerprint has been served or recorded in this run
+}
+
+// generateFixture is the file holding the responses recorded for one generation fingerprint
+type generateFixture struct {
+	Purpose      string     `json:"purpose"`
+	SystemPrompt string     `json:"systemPrompt"`
+	UserPrompt   string     `json:"userPrompt"`
+	Responses    []Response `json:"responses"`
+}
+
+// embedFixture is the file holding the vector recorded for one text
+type embedFixture struct {
+	Text   string    `json:"text"`
+	Model  string    `json:"model"`
+	Vector []float32 `json:"vector"`
+}
+
+// NewFixtures returns fixtures stored in dir for mode FixtureRecord or FixtureReplay
+func NewFixtures(dir, mode string) (*Fixtures, error) {
+	if mode != FixtureRecord && mode != FixtureReplay {
+		return nil, fmt.Errorf("unknown fixture mode %q: use record or replay", mode)
+	}
+	if mode == FixtureReplay {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("fixture directory %s: %v", dir, err)
+		}
+	}
+	return &Fixtures{dir: dir, replay: mode == FixtureReplay, counts: make(map[string]int)}, nil
+}
+
+// NewFixturesFromEnv returns the fixtures selected by LLM_FIXTURES (record or replay) in LLM_FIXTURES_DIR,
+// or nil when LLM_FIXTURES is unset
+func NewFixturesFromEnv() (*Fixtures, error) {
+	mode := strings.ToLower(os.Getenv("LLM_FIXTURES"))
+	if mode == "" || mode == "off" {
+		return nil, nil
+	}
+	dir := os.Getenv("LLM_FIXTURES_DIR")
+	if dir == "" {
+		return nil, fmt.Errorf("LLM_FIXTURES_DIR must be set when LLM_FIXTURES is %q", mode)
+	}
+	return NewFixtures(dir, mode)
+}
+
+// Replaying reports whether the fixtures answer without calling a model
+func (f *Fixtures) Replaying() bool {
+	return f.replay
+}
+
+// Provider wraps next so its exchanges are recorded, or replaces it in replay mode, where next may be nil
+func (f *Fixtures) Provider(next Provider) Provider {
+	return &fixtureProvider{fixtures: f, next: next}
+}
+
+// Embedder wraps next so its exchanges are recorded, or replaces it in replay mode, where next may be nil
+func (f *Fixtures) Embedder(next Embedder) Embedder {
+	return &fixtureEmbedder{fixtures: f, next: next}
+}
+
+// next returns how many times key was used before in this run and counts this use
+func (f *Fixtures) next(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := f.counts[key]
+	f.counts[key] = n + 1
+	return n
+}
+
+func (f *Fixtures) path(kind, key string) string {
+	return filepath.Join(f.dir, kind, key+".json")
+}
+
+func (f *Fixtures) missing(kind, key, detail string) error {
+	return &Error{
+		Status:  http.StatusNotFound,
+		Message: fmt.Sprintf("no recorded %s fixture %s in %s for %s; record it first", kind, key, f.dir, detail),
+	}
+}
+
+func readFixture(path string, fixture interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return false, fmt.Errorf("invalid fixture %s: %v", path, err)
+	}
+	return true, nil
+}
+
+func writeFixture(path string, fixture interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type fixtureProvider struct {
+	fixtures *Fixtures
+	next     Provider
+}
+
+func (p *fixtureProvider) Model() string {
+	if p.next == nil {
+		return "replay"
+	}
+	return p.next.Model()
+}
+
+func (p *fixtureProvider) Generate(ctx context.Context, req Request) (*Response, error) {
+	key := generateFixtureKey(req)
+	path := p.fixtures.path(CallKindGenerate, key)
+	index := p.fixtures.next(key)
+
+	var fixture generateFixture
+	if p.fixtures.replay {
+		found, err := readFixture(path, &fixture)
+		if err != nil {
+			return nil, err
+		}
+		if !found || len(fixture.Responses) == 0 {
+			return nil, p.fixtures.missing(CallKindGenerate, key, req.Purpose+" prompt")
+		}
+		// Serve repeats in recorded order, cycling if the run makes more calls than were recorded
+		response := fixture.Responses[index%len(fixture.Responses)]
+		return &response, nil
+	}
+
+	response, err := p.next.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The first use in a run replaces an earlier recording; repeats append to it
+	p.fixtures.mu.Lock()
+	defer p.fixtures.mu.Unlock()
+	if index > 0 {
+		if _, err := readFixture(path, &fixture); err != nil {
+			return nil, err
+		}
+	}
+	fixture.Purpose = req.Purpose
+	fixture.SystemPrompt = req.SystemPrompt
+	fixture.UserPrompt = req.UserPrompt
+	recorded := *response
+	recorded.CallID = ""
+	fixture.Responses = append(fixture.Responses, recorded)
+	if err := writeFixture(path, fixture); err != nil {
+		return nil, fmt.Errorf("failed to record fixture %s: %v", path, err)
+	}
+	return response, nil
+}
+
+type fixtureEmbedder struct {
+	fixtures *Fixtures
+	next     Embedder
+}
+
+func (e *fixtureEmbedder) Model() string {
+	if e.next == nil {
+		return "replay"
+	}
+	return e.next.Model()
+}
+
+func (e *fixtureEmbedder) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	if e.fixtures.replay {
+		vectors := make([][]float32, len(req.Texts))
+		model := ""
+		for i, text := range req.Texts {
+			key := embedFixtureKey(text)
+			var fixture embedFixture
+			found, err := readFixture(e.fixtures.path(CallKindEmbed, key), &fixture)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, e.fixtures.missing(CallKindEmbed, key, fmt.Sprintf("%s text %q", req.Purpose, truncate(text, 60)))
+			}
+			vectors[i] = fixture.Vector
+			model = fixture.Model
+		}
+		return &EmbedResponse{Vectors: vectors, Model: model}, nil
+	}
+
+	response, err := e.next.Embed(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for i, text := range req.Texts {
+		if i >= len(response.Vectors) || response.Vectors[i] == nil {
+			continue
+		}
+		path := e.fixtures.path(CallKindEmbed, embedFixtureKey(text))
+		if err := writeFixture(path, embedFixture{Text: text, Model: response.Model, Vector: response.Vectors[i]}); err != nil {
+			return nil, fmt.Errorf("failed to record fixture %s: %v", path, err)
+		}
+	}
+	return response, nil
+}
+
+// generateFixtureKey fingerprints a generation without the default model, so fixtures replay without one
+// configured. A model requested explicitly is part of the fingerprint.
+func generateFixtureKey(req Request) string {
+	return generateCacheKey(req.Model, req)
+}
+
+func embedFixtureKey(text string) string {
+	return embedCacheKey("", text)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
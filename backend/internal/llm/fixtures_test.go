@@ -0,0 +1,253 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// scriptedProvider answers every request with its user prompt and a call counter
+type scriptedProvider struct {
+	calls int
+}
+
+func (p *scriptedProvider) Model() string {
+	return "scripted"
+}
+
+func (p *scriptedProvider) Generate(ctx context.Context, req Request) (*Response, error) {
+	p.calls++
+	return &Response{
+		Text:   fmt.Sprintf("%s #%d", req.UserPrompt, p.calls),
+		Model:  "scripted",
+		Usage:  Usage{PromptTokens: 3, CandidatesTokens: 2, TotalTokens: 5},
+		CallID: fmt.Sprintf("call-%d", p.calls),
+	}, nil
+}
+
+// scriptedEmbedder embeds each text as its length and first byte
+type scriptedEmbedder struct {
+	calls int
+}
+
+func (e *scriptedEmbedder) Model() string {
+	return "scripted-embedding"
+}
+
+func (e *scriptedEmbedder) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	e.calls++
+	vectors := make([][]float32, len(req.Texts))
+	for i, text := range req.Texts {
+		vectors[i] = []float32{float32(len(text)), float32(text[0])}
+	}
+	return &EmbedResponse{Vectors: vectors, Model: "scripted-embedding"}, nil
+}
+
+func temperature(value float64) *float64 {
+	return &value
+}
+
+func TestGenerateFixtureKeyIsStable(t *testing.T) {
+	base := Request{Purpose: "extraction", SystemPrompt: "system", UserPrompt: "user", JSON: true}
+
+	// Recorded fixtures are named by this key, so changing how it is computed orphans every recording
+	const want = "b2f77edfc56465fae25947001931f799b44a004067169931d3781385d33cfb79"
+	if got := generateFixtureKey(base); got != want {
+		t.Errorf("generateFixtureKey() = %s, want %s", got, want)
+	}
+
+	same := []struct {
+		name string
+		req  Request
+	}{
+		{"purpose", Request{Purpose: "synthesis", SystemPrompt: "system", UserPrompt: "user", JSON: true}},
+		{"trace", Request{Purpose: "extraction", SystemPrompt: "system", UserPrompt: "user", JSON: true, Trace: Trace{NarrativeID: "narrative_1", PromptVersion: "extraction@v1"}}},
+		{"first sample", Request{Purpose: "extraction", SystemPrompt: "system", UserPrompt: "user", JSON: true, Sample: 0}},
+	}
+	for _, tt := range same {
+		if got := generateFixtureKey(tt.req); got != want {
+			t.Errorf("%s changed the key: %s", tt.name, got)
+		}
+	}
+
+	different := []struct {
+		name string
+		req  Request
+	}{
+		{"system prompt", Request{SystemPrompt: "other", UserPrompt: "user", JSON: true}},
+		{"user prompt", Request{SystemPrompt: "system", UserPrompt: "other", JSON: true}},
+		{"json", Request{SystemPrompt: "system", UserPrompt: "user"}},
+		{"temperature", Request{SystemPrompt: "system", UserPrompt: "user", JSON: true, Temperature: temperature(0.7)}},
+		{"explicit model", Request{SystemPrompt: "system", UserPrompt: "user", JSON: true, Model: "gemini-2.5-pro"}},
+		{"later sample", Request{SystemPrompt: "system", UserPrompt: "user", JSON: true, Sample: 1}},
+		{"tools", Request{SystemPrompt: "system", UserPrompt: "user", JSON: true, Tools: []Tool{{Name: "CreateStockNode"}}}},
+	}
+	seen := map[string]string{want: "base"}
+	for _, tt := range different {
+		key := generateFixtureKey(tt.req)
+		if previous, ok := seen[key]; ok {
+			t.Errorf("%s has the same key as %s", tt.name, previous)
+		}
+		seen[key] = tt.name
+	}
+}
+
+func TestEmbedFixtureKeyIsStable(t *testing.T) {
+	const want = "814c98fd49c2645316288a8605a9ddfcc4edb24bd2aa2b7ceb20b8714ba50d3d"
+	if got := embedFixtureKey("Technical Debt"); got != want {
+		t.Errorf("embedFixtureKey() = %s, want %s", got, want)
+	}
+	if embedFixtureKey("Technical Debt") == embedFixtureKey("technical debt") {
+		t.Error("embedFixtureKey() ignores case")
+	}
+}
+
+func TestFixturesRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	recorder, err := NewFixtures(dir, FixtureRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, embedder := &scriptedProvider{}, &scriptedEmbedder{}
+	recordingProvider, recordingEmbedder := recorder.Provider(provider), recorder.Embedder(embedder)
+
+	requests := []Request{
+		{Purpose: "extraction", SystemPrompt: "system", UserPrompt: "first"},
+		{Purpose: "extraction", SystemPrompt: "system", UserPrompt: "first"}, // Repeated within the run
+		{Purpose: "synthesis", SystemPrompt: "system", UserPrompt: "second"},
+	}
+	var recorded []string
+	for _, req := range requests {
+		response, err := recordingProvider.Generate(ctx, req)
+		if err != nil {
+			t.Fatalf("recording Generate() error = %v", err)
+		}
+		recorded = append(recorded, response.Text)
+	}
+	embedded, err := recordingEmbedder.Embed(ctx, EmbedRequest{Purpose: "node_embedding", Texts: []string{"alpha", "beta"}})
+	if err != nil {
+		t.Fatalf("recording Embed() error = %v", err)
+	}
+
+	replayer, err := NewFixtures(dir, FixtureReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !replayer.Replaying() {
+		t.Fatal("Replaying() = false in replay mode")
+	}
+	replayingProvider, replayingEmbedder := replayer.Provider(nil), replayer.Embedder(nil)
+
+	for i, req := range requests {
+		response, err := replayingProvider.Generate(ctx, req)
+		if err != nil {
+			t.Fatalf("replaying Generate(%q) error = %v", req.UserPrompt, err)
+		}
+		if response.Text != recorded[i] {
+			t.Errorf("replayed response %d = %q, want %q", i, response.Text, recorded[i])
+		}
+		if response.CallID != "" {
+			t.Errorf("replayed response %d has call id %q; call ids are not recorded", i, response.CallID)
+		}
+		if response.Usage.TotalTokens != 5 {
+			t.Errorf("replayed response %d usage = %+v, want the recorded usage", i, response.Usage)
+		}
+	}
+	// More repeats than were recorded cycle through the recorded responses
+	response, err := replayingProvider.Generate(ctx, requests[0])
+	if err != nil || response.Text != recorded[0] {
+		t.Errorf("third repeat = %v, %v; want %q", response, err, recorded[0])
+	}
+
+	// Embeddings replay text by text, however the texts are batched
+	replayed, err := replayingEmbedder.Embed(ctx, EmbedRequest{Purpose: "node_embedding", Texts: []string{"beta", "alpha", "beta"}})
+	if err != nil {
+		t.Fatalf("replaying Embed() error = %v", err)
+	}
+	want := [][]float32{embedded.Vectors[1], embedded.Vectors[0], embedded.Vectors[1]}
+	if !reflect.DeepEqual(replayed.Vectors, want) {
+		t.Errorf("replayed vectors = %v, want %v", replayed.Vectors, want)
+	}
+	if replayed.Model != "scripted-embedding" {
+		t.Errorf("replayed model = %q, want the recorded model", replayed.Model)
+	}
+
+	if provider.calls != len(requests) || embedder.calls != 1 {
+		t.Errorf("recording made %d generate and %d embed calls, want %d and 1", provider.calls, embedder.calls, len(requests))
+	}
+}
+
+func TestFixturesRecordingReplacesEarlierRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	req := Request{SystemPrompt: "system", UserPrompt: "prompt"}
+
+	provider := &scriptedProvider{}
+	for run := 0; run < 2; run++ {
+		recorder, err := NewFixtures(dir, FixtureRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := recorder.Provider(provider).Generate(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var fixture generateFixture
+	found, err := readFixture(filepath.Join(dir, CallKindGenerate, generateFixtureKey(req)+".json"), &fixture)
+	if err != nil || !found {
+		t.Fatalf("readFixture() = %t, %v", found, err)
+	}
+	if len(fixture.Responses) != 1 || fixture.Responses[0].Text != "prompt #2" {
+		t.Errorf("responses = %+v, want only the second run's", fixture.Responses)
+	}
+}
+
+func TestFixturesReplayMisses(t *testing.T) {
+	ctx := context.Background()
+	fixtures, err := NewFixtures(t.TempDir(), FixtureReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fixtures.Provider(nil).Generate(ctx, Request{Purpose: "extraction", UserPrompt: "never recorded"})
+	assertMissingFixture(t, err)
+
+	_, err = fixtures.Embedder(nil).Embed(ctx, EmbedRequest{Purpose: "grounding", Texts: []string{"never recorded"}})
+	assertMissingFixture(t, err)
+}
+
+func TestNewFixturesValidatesModeAndDirectory(t *testing.T) {
+	if _, err := NewFixtures(t.TempDir(), "rewind"); err == nil {
+		t.Error("NewFixtures() accepted an unknown mode")
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, err := NewFixtures(missing, FixtureReplay); err == nil {
+		t.Error("NewFixtures() replays from a directory that does not exist")
+	}
+	// Recording creates the directory on first use
+	if _, err := NewFixtures(missing, FixtureRecord); err != nil {
+		t.Errorf("NewFixtures() record error = %v", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("NewFixtures() created %s before anything was recorded", missing)
+	}
+}
+
+func assertMissingFixture(t *testing.T, err error) {
+	t.Helper()
+	var llmErr *Error
+	if !errors.As(err, &llmErr) {
+		t.Fatalf("error = %v, want an *Error", err)
+	}
+	if llmErr.Status != http.StatusNotFound || llmErr.Temporary {
+		t.Errorf("error = %+v, want a permanent 404", llmErr)
+	}
+}
@@ -0,0 +1,315 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/googleapis/gax-go/v2/apierror"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	defaultGeminiModel = "gemini-2.5-flash"
+	geminiBaseURL      = "https://generativelanguage.googleapis.com/v1beta/models/"
+)
+
+// Gemini calls the Gemini generateContent REST API with the key in GEMINI_API_KEY
+type Gemini struct {
+	model  string
+	client *http.Client
+}
+
+// NewGemini returns a Gemini provider for model, or gemini-2.5-flash when model is empty
+func NewGemini(model string) *Gemini {
+	if model == "" {
+		model = defaultGeminiModel
+	}
+	return &Gemini{model: model, client: &http.Client{}}
+}
+
+func (g *Gemini) Model() string {
+	return g.model
+}
+
+// Generate sends the prompts and returns the text and function calls of the first candidate
+func (g *Gemini) Generate(ctx context.Context, req Request) (*Response, error) {
+	geminiApiKey := os.Getenv("GEMINI_API_KEY")
+	if geminiApiKey == "" {
+		return nil, &Error{Status: http.StatusInternalServerError, Message: "Server configuration error: missing API key"}
+	}
+
+	generationConfig := map[string]interface{}{}
+	if req.JSON && len(req.Tools) == 0 {
+		generationConfig["response_mime_type"] = "application/json"
+	}
+	if req.Temperature != nil {
+		generationConfig["temperature"] = *req.Temperature
+	}
+	payload := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]string{
+					{"text": req.UserPrompt},
+				},
+			},
+		},
+		"generationConfig": generationConfig,
+	}
+	if len(req.Tools) > 0 {
+		// Mode ANY makes the model answer only with calls to the declared functions
+		payload["tools"] = []map[string]interface{}{{"functionDeclarations": req.Tools}}
+		payload["toolConfig"] = map[string]interface{}{
+			"functionCallingConfig": map[string]interface{}{"mode": "ANY"},
+		}
+	}
+	if req.SystemPrompt != "" {
+		payload["systemInstruction"] = map[string]interface{}{
+			"parts": []map[string]string{
+				{"text": req.SystemPrompt},
+			},
+		}
+	}
+	reqBody, _ := json.Marshal(payload)
+
+	model := g.model
+	if req.Model != "" {
+		model = req.Model
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, "POST", geminiBaseURL+model+":generateContent", bytes.NewBuffer(reqBody))
+	if err != nil {
+		log.Printf("ERROR: Failed to create Gemini request: %v", err)
+		return nil, &Error{Status: http.StatusInternalServerError, Message: "Failed to create request to LLM service"}
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("X-goog-api-key", geminiApiKey)
+
+	httpResponse, err := g.client.Do(httpRequest)
+	if err != nil {
+		log.Printf("ERROR: Gemini API request failed: %v", err)
+		return nil, &Error{Status: http.StatusServiceUnavailable, Message: "Could not connect to the LLM service", Temporary: ctx.Err() == nil}
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		log.Printf("ERROR: Gemini API returned non-200 status: %d", httpResponse.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(httpResponse.Body, 64<<10))
+		return nil, upstreamError(httpResponse.StatusCode, httpResponse.Header, retryDelayFromBody(body),
+			fmt.Sprintf("LLM service returned status code %d", httpResponse.StatusCode))
+	}
+
+	var geminiAPIResponse struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text         string `json:"text"`
+					FunctionCall *struct {
+						Name string                 `json:"name"`
+						Args map[string]interface{} `json:"args"`
+					} `json:"functionCall"`
+				} `json:"parts"`
+			} `json:"content"`
+		} `json:"candidates"`
+		UsageMetadata struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+			TotalTokenCount      int `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
+	}
+	if err := json.NewDecoder(httpResponse.Body).Decode(&geminiAPIResponse); err != nil {
+		log.Printf("ERROR: Failed to decode Gemini API response: %v", err)
+		return nil, &Error{Status: http.StatusInternalServerError, Message: "Invalid response from LLM service"}
+	}
+	if len(geminiAPIResponse.Candidates) == 0 || len(geminiAPIResponse.Candidates[0].Content.Parts) == 0 {
+		return nil, &Error{Status: http.StatusInternalServerError, Message: "LLM service returned no content"}
+	}
+
+	var text strings.Builder
+	var toolCalls []ToolCall
+	for _, part := range geminiAPIResponse.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+		if part.FunctionCall != nil {
+			toolCalls = append(toolCalls, ToolCall{Name: part.FunctionCall.Name, Arguments: part.FunctionCall.Args})
+		}
+	}
+
+	return &Response{
+		Text:      text.String(),
+		ToolCalls: toolCalls,
+		Model:     model,
+		Usage: Usage{
+			PromptTokens:     geminiAPIResponse.UsageMetadata.PromptTokenCount,
+			CandidatesTokens: geminiAPIResponse.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      geminiAPIResponse.UsageMetadata.TotalTokenCount,
+		},
+	}, nil
+}
+
+const defaultGeminiEmbeddingModel = "models/text-embedding-004"
+
+// GeminiEmbedder embeds texts with the Gemini batch embedding API, using the key in GEMINI_API_KEY
+type GeminiEmbedder struct {
+	model string
+}
+
+// NewGeminiEmbedder returns a Gemini embedder for model, or models/text-embedding-004 when model is empty
+func NewGeminiEmbedder(model string) *GeminiEmbedder {
+	if model == "" {
+		model = defaultGeminiEmbeddingModel
+	}
+	return &GeminiEmbedder{model: model}
+}
+
+func (e *GeminiEmbedder) Model() string {
+	return e.model
+}
+
+// Embed sends all texts in a single batch request
+func (e *GeminiEmbedder) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	geminiApiKey := os.Getenv("GEMINI_API_KEY")
+	if geminiApiKey == "" {
+		return nil, &Error{Status: http.StatusInternalServerError, Message: "GEMINI_API_KEY environment variable not set"}
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(geminiApiKey))
+	if err != nil {
+		log.Printf("Failed to create genai client: %v", err)
+		return nil, &Error{Status: http.StatusServiceUnavailable, Message: "Could not connect to the embedding service", Temporary: true}
+	}
+	defer client.Close()
+
+	em := client.EmbeddingModel(e.model)
+	batch := em.NewBatch()
+	for _, text := range req.Texts {
+		batch.AddContent(genai.Text(text))
+	}
+
+	res, err := em.BatchEmbedContents(ctx, batch)
+	if err != nil {
+		log.Printf("Failed to generate batch embeddings: %v", err)
+		return nil, embeddingError(err)
+	}
+	if res == nil || res.Embeddings == nil {
+		return nil, &Error{Status: http.StatusBadGateway, Message: "received a nil response from the batch embedding API"}
+	}
+
+	// Keep a nil vector in place of any text that failed so the order matches the request
+	vectors := make([][]float32, 0, len(res.Embeddings))
+	for _, embedding := range res.Embeddings {
+		if embedding != nil && len(embedding.Values) > 0 {
+			vectors = append(vectors, embedding.Values)
+		} else {
+			vectors = append(vectors, nil)
+		}
+	}
+	return &EmbedResponse{Vectors: vectors, Model: e.model}, nil
+}
+
+// retryableStatus reports whether an upstream HTTP status is worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// upstreamError maps a failed Gemini response to an Error. Rate limiting is passed on as 429 so clients
+// can back off too; every other status is reported as a bad gateway.
+func upstreamError(status int, header http.Header, bodyDelay time.Duration, message string) *Error {
+	err := &Error{Status: http.StatusBadGateway, Message: message, Temporary: retryableStatus(status), RetryAfter: bodyDelay}
+	if status == http.StatusTooManyRequests {
+		err.Status = http.StatusTooManyRequests
+	}
+	if delay := parseRetryAfter(header.Get("Retry-After")); delay > 0 {
+		err.RetryAfter = delay
+	}
+	return err
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && time.Until(at) > 0 {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// retryDelayFromBody reads the RetryInfo detail Gemini puts in 429 error bodies, e.g. "retryDelay": "17s"
+func retryDelayFromBody(body []byte) time.Duration {
+	var errorBody struct {
+		Error struct {
+			Details []struct {
+				RetryDelay string `json:"retryDelay"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &errorBody) != nil {
+		return 0
+	}
+	for _, detail := range errorBody.Error.Details {
+		if delay, err := time.ParseDuration(detail.RetryDelay); err == nil && delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// embeddingError maps a genai client error to an Error, keeping the upstream status and retry delay
+func embeddingError(err error) *Error {
+	message := fmt.Sprintf("Embedding service request failed: %v", err)
+	var apiErr *apierror.APIError
+	if !errors.As(err, &apiErr) {
+		return &Error{Status: http.StatusBadGateway, Message: message}
+	}
+
+	status := apiErr.HTTPCode()
+	if status <= 0 {
+		status = grpcHTTPStatus(apiErr.GRPCStatus().Code())
+	}
+	var bodyDelay time.Duration
+	if retryInfo := apiErr.Details().RetryInfo; retryInfo != nil {
+		bodyDelay = retryInfo.GetRetryDelay().AsDuration()
+	}
+	header := http.Header{}
+	var googleErr *googleapi.Error
+	if errors.As(err, &googleErr) && googleErr.Header != nil {
+		header = googleErr.Header
+	}
+	return upstreamError(status, header, bodyDelay, message)
+}
+
+// grpcHTTPStatus maps the gRPC codes that matter for retrying to their HTTP equivalents
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Internal, codes.Unknown:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,130 @@
+// Package llm is the boundary between the application and the language models it prompts.
+// Handlers depend on the Provider interface; concrete providers are chosen from the environment.
+package llm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Trace identifies what a model call was made for. Providers ignore it; decorators such as the audit log record it.
+type Trace struct {
+	NarrativeID   string   // Narrative being analyzed, if any
+	NodeIDs       []string // System/Stock/Flow nodes the call is about, if any
+	PromptVersion string   // Registry reference of the prompt template, e.g. "extraction@v1"
+}
+
+// Request is a single prompt sent to a language model
+type Request struct {
+	Purpose      string   // What the call is for, e.g. "extraction" or "synthesis"
+	SystemPrompt string   // System instruction
+	UserPrompt   string   // User turn
+	JSON         bool     // Ask the model to answer with a JSON document
+	Tools        []Tool   // Functions the model must answer by calling; replaces a text answer
+	Temperature  *float64 // Sampling temperature; nil keeps the model default
+	Model        string   // Model to ask instead of the provider's default, when set
+	Sample       int      // Distinguishes repeated samples of one request, so caches and fixtures keep them apart
+	Trace
+}
+
+// Tool declares a function the model can call, with its parameters as a JSON Schema object
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is one function call returned by the model
+type ToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// Usage is the token accounting reported by the model
+type Usage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CandidatesTokens int `json:"candidatesTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// Response is the text a model returned for a Request
+type Response struct {
+	Text      string     `json:"text"`
+	ToolCalls []ToolCall `json:"toolCalls,omitempty"` // Function calls, in order, when the request declared Tools
+	Model     string     `json:"model"`
+	Usage     Usage      `json:"usage"`
+	CallID    string     `json:"-"` // Set by the audit log so callers can report how the text parsed
+}
+
+// Provider generates text for prompts
+type Provider interface {
+	Generate(ctx context.Context, req Request) (*Response, error)
+	// Model names the model answering requests, e.g. "gemini-2.5-flash"
+	Model() string
+}
+
+// requestModel returns the model that will answer req: its override, or the provider's default
+func requestModel(provider Provider, req Request) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return provider.Model()
+}
+
+// EmbedRequest is a batch of texts to embed
+type EmbedRequest struct {
+	Purpose string // What the embeddings are for, e.g. "node_embedding" or "grounding"
+	Texts   []string
+	Trace
+}
+
+// EmbedResponse holds one vector per requested text, in order. A vector is nil when its text failed to embed.
+type EmbedResponse struct {
+	Vectors [][]float32 `json:"vectors"`
+	Model   string      `json:"model"`
+	CallID  string      `json:"-"`
+}
+
+// Embedder turns texts into vector embeddings
+type Embedder interface {
+	Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error)
+	// Model names the embedding model, e.g. "models/text-embedding-004"
+	Model() string
+}
+
+// Error is a failed model call, carrying the HTTP status a handler should report
+type Error struct {
+	Status     int
+	Message    string
+	Temporary  bool          // The same request may succeed if retried, e.g. after a 429 or 503
+	RetryAfter time.Duration // How long the service asked us to wait before retrying, if it said
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewFromEnv returns the provider selected by LLM_PROVIDER (default "gemini"), using LLM_MODEL when set
+func NewFromEnv() (Provider, error) {
+	model := os.Getenv("LLM_MODEL")
+	switch provider := strings.ToLower(os.Getenv("LLM_PROVIDER")); provider {
+	case "", "gemini":
+		return NewGemini(model), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", provider)
+	}
+}
+
+// NewEmbedderFromEnv returns the embedder for LLM_PROVIDER (default "gemini"), using EMBEDDING_MODEL when set
+func NewEmbedderFromEnv() (Embedder, error) {
+	model := os.Getenv("EMBEDDING_MODEL")
+	switch provider := strings.ToLower(os.Getenv("LLM_PROVIDER")); provider {
+	case "", "gemini":
+		return NewGeminiEmbedder(model), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", provider)
+	}
+}
@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Defaults for NewThrottleFromEnv
+const (
+	defaultRequestsPerMinute = 60
+	defaultRateBurst         = 5
+	defaultMaxConcurrency    = 4
+	defaultMaxAttempts       = 4
+	defaultRetryBaseDelay    = time.Second
+	defaultRetryMaxDelay     = 30 * time.Second
+)
+
+// Throttle paces the calls made to a model service and retries the ones that fail temporarily. One Throttle
+// is shared by every provider and embedder talking to the same service so they draw on the same quota.
+type Throttle struct {
+	limiter     *rate.Limiter // Token bucket; nil for no rate limit
+	slots       chan struct{} // Caps calls in flight; nil for no cap
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// NewThrottle allows requestsPerMinute calls with bursts of burst (0 for no limit), at most concurrency calls
+// in flight (0 for no cap), and up to maxAttempts tries per call with exponential backoff from baseDelay
+// to maxDelay
+func NewThrottle(requestsPerMinute float64, burst, concurrency, maxAttempts int, baseDelay, maxDelay time.Duration) *Throttle {
+	t := &Throttle{maxAttempts: max(maxAttempts, 1), baseDelay: baseDelay, maxDelay: maxDelay}
+	if requestsPerMinute > 0 {
+		t.limiter = rate.NewLimiter(rate.Limit(requestsPerMinute/60), max(burst, 1))
+	}
+	if concurrency > 0 {
+		t.slots = make(chan struct{}, concurrency)
+	}
+	return t
+}
+
+// NewThrottleFromEnv reads LLM_REQUESTS_PER_MINUTE (default 60, 0 disables), LLM_RATE_BURST (default 5),
+// LLM_MAX_CONCURRENCY (default 4, 0 disables), LLM_MAX_ATTEMPTS (default 4), and LLM_RETRY_BASE_DELAY and
+// LLM_RETRY_MAX_DELAY (Go durations, default 1s and 30s)
+func NewThrottleFromEnv() (*Throttle, error) {
+	requestsPerMinute, err := envFloat("LLM_REQUESTS_PER_MINUTE", defaultRequestsPerMinute)
+	if err != nil {
+		return nil, err
+	}
+	burst, err := envInt("LLM_RATE_BURST", defaultRateBurst)
+	if err != nil {
+		return nil, err
+	}
+	concurrency, err := envInt("LLM_MAX_CONCURRENCY", defaultMaxConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts, err := envInt("LLM_MAX_ATTEMPTS", defaultMaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	baseDelay, err := envDuration("LLM_RETRY_BASE_DELAY", defaultRetryBaseDelay)
+	if err != nil {
+		return nil, err
+	}
+	maxDelay, err := envDuration("LLM_RETRY_MAX_DELAY", defaultRetryMaxDelay)
+	if err != nil {
+		return nil, err
+	}
+	return NewThrottle(requestsPerMinute, burst, concurrency, maxAttempts, baseDelay, maxDelay), nil
+}
+
+// do runs call under the rate limit and concurrency cap, retrying temporary failures. When every attempt
+// fails the last error is returned with the number of attempts added to its message.
+func (t *Throttle) do(ctx context.Context, purpose string, call func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := t.acquire(ctx); err != nil {
+			return err
+		}
+		err := call()
+		t.release()
+		if err == nil {
+			return nil
+		}
+
+		var llmErr *Error
+		if !errors.As(err, &llmErr) || !llmErr.Temporary || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= t.maxAttempts {
+			if attempt == 1 {
+				return err
+			}
+			exhausted := *llmErr
+			exhausted.Message = fmt.Sprintf("%s (gave up after %d attempts)", llmErr.Message, attempt)
+			return &exhausted
+		}
+
+		delay := t.backoff(attempt, llmErr.RetryAfter)
+		log.Printf("Warning: %s call failed (attempt %d/%d), retrying in %s: %v", purpose, attempt, t.maxAttempts, delay.Round(time.Millisecond), err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// backoff returns the wait before the next attempt: the service's Retry-After when it gave one, otherwise
+// exponential backoff with equal jitter, so concurrent callers spread out instead of retrying in lockstep
+func (t *Throttle) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter + time.Duration(rand.Int63n(int64(t.baseDelay/2)+1))
+	}
+	delay := t.baseDelay << (attempt - 1)
+	if delay > t.maxDelay || delay <= 0 {
+		delay = t.maxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (t *Throttle) acquire(ctx context.Context) error {
+	if t.slots != nil {
+		select {
+		case t.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if t.limiter != nil {
+		if err := t.limiter.Wait(ctx); err != nil {
+			t.release()
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Throttle) release() {
+	if t.slots != nil {
+		<-t.slots
+	}
+}
+
+// retryingProvider sends requests through a Throttle
+type retryingProvider struct {
+	next     Provider
+	throttle *Throttle
+}
+
+// WithRetry wraps next so its calls are rate limited, capped in concurrency and retried by throttle
+func WithRetry(next Provider, throttle *Throttle) Provider {
+	return &retryingProvider{next: next, throttle: throttle}
+}
+
+func (p *retryingProvider) Model() string {
+	return p.next.Model()
+}
+
+func (p *retryingProvider) Generate(ctx context.Context, req Request) (*Response, error) {
+	var response *Response
+	err := p.throttle.do(ctx, req.Purpose, func() error {
+		var err error
+		response, err = p.next.Generate(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// retryingEmbedder sends requests through a Throttle
+type retryingEmbedder struct {
+	next     Embedder
+	throttle *Throttle
+}
+
+// WithEmbedRetry wraps next so its calls are rate limited, capped in concurrency and retried by throttle
+func WithEmbedRetry(next Embedder, throttle *Throttle) Embedder {
+	return &retryingEmbedder{next: next, throttle: throttle}
+}
+
+func (e *retryingEmbedder) Model() string {
+	return e.next.Model()
+}
+
+func (e *retryingEmbedder) Embed(ctx context.Context, req EmbedRequest) (*EmbedResponse, error) {
+	var response *EmbedResponse
+	err := e.throttle.do(ctx, req.Purpose, func() error {
+		var err error
+		response, err = e.next.Embed(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func envFloat(name string, fallback float64) (float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
+
+func envDuration(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,199 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryableStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusRequestTimeout, true},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+		{http.StatusGatewayTimeout, true},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusForbidden, false},
+		{http.StatusNotFound, false},
+		{http.StatusNotImplemented, false},
+	}
+	for _, tt := range tests {
+		if got := retryableStatus(tt.status); got != tt.want {
+			t.Errorf("retryableStatus(%d) = %t, want %t", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		retryAfter    string
+		bodyDelay     time.Duration
+		wantStatus    int
+		wantTemporary bool
+		wantDelay     time.Duration
+	}{
+		{"rate limited keeps 429", http.StatusTooManyRequests, "", 0, http.StatusTooManyRequests, true, 0},
+		{"server error is a bad gateway", http.StatusServiceUnavailable, "", 0, http.StatusBadGateway, true, 0},
+		{"client error is permanent", http.StatusBadRequest, "", 0, http.StatusBadGateway, false, 0},
+		{"delay from the body", http.StatusTooManyRequests, "", 17 * time.Second, http.StatusTooManyRequests, true, 17 * time.Second},
+		{"header wins over the body", http.StatusTooManyRequests, "5", 17 * time.Second, http.StatusTooManyRequests, true, 5 * time.Second},
+		{"unreadable header keeps the body delay", http.StatusTooManyRequests, "soon", 17 * time.Second, http.StatusTooManyRequests, true, 17 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			err := upstreamError(tt.status, header, tt.bodyDelay, "failed")
+			if err.Status != tt.wantStatus || err.Temporary != tt.wantTemporary || err.RetryAfter != tt.wantDelay {
+				t.Errorf("upstreamError() = %+v, want status %d, temporary %t, retry after %s", err, tt.wantStatus, tt.wantTemporary, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		min, max time.Duration
+	}{
+		{"missing", "", 0, 0},
+		{"seconds", "30", 30 * time.Second, 30 * time.Second},
+		{"zero seconds", "0", 0, 0},
+		{"negative seconds", "-5", 0, 0},
+		{"garbage", "later", 0, 0},
+		{"http date", time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat), 118 * time.Second, 2 * time.Minute},
+		{"http date in the past", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestThrottleBackoff(t *testing.T) {
+	throttle := NewThrottle(0, 0, 0, 4, 100*time.Millisecond, time.Second)
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{"first retry", 1, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubles per attempt", 3, 0, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped at maxDelay", 5, 0, 500 * time.Millisecond, time.Second},
+		{"capped when the shift overflows", 70, 0, 500 * time.Millisecond, time.Second},
+		{"retry-after from the service", 1, 2 * time.Second, 2 * time.Second, 2*time.Second + 50*time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Jitter is random, so every draw has to land in range
+			for i := 0; i < 50; i++ {
+				if got := throttle.backoff(tt.attempt, tt.retryAfter); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d, %s) = %s, want between %s and %s", tt.attempt, tt.retryAfter, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottleRetries(t *testing.T) {
+	temporary := &Error{Status: http.StatusServiceUnavailable, Message: "unavailable", Temporary: true}
+	permanent := &Error{Status: http.StatusBadGateway, Message: "bad request", Temporary: false}
+	plain := errors.New("not an llm error")
+
+	tests := []struct {
+		name        string
+		maxAttempts int
+		errs        []error // Returned by successive calls; calls past the end succeed
+		wantCalls   int
+		wantErr     string
+	}{
+		{"succeeds first time", 3, nil, 1, ""},
+		{"retries temporary failures", 3, []error{temporary, temporary}, 3, ""},
+		{"gives up after maxAttempts", 3, []error{temporary, temporary, temporary, temporary}, 3, "unavailable (gave up after 3 attempts)"},
+		{"single attempt returns the error as is", 1, []error{temporary}, 1, "unavailable"},
+		{"permanent failures are not retried", 3, []error{permanent}, 1, "bad request"},
+		{"other errors are not retried", 3, []error{plain}, 1, "not an llm error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			throttle := NewThrottle(0, 0, 1, tt.maxAttempts, time.Millisecond, 2*time.Millisecond)
+			calls := 0
+			err := throttle.do(context.Background(), "test", func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("do() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("do() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestThrottleStopsWaitingWhenCancelled(t *testing.T) {
+	throttle := NewThrottle(0, 0, 0, 3, time.Millisecond, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	calls := 0
+	started := time.Now()
+	err := throttle.do(ctx, "test", func() error {
+		calls++
+		return &Error{Status: http.StatusTooManyRequests, Message: "slow down", Temporary: true, RetryAfter: time.Hour}
+	})
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("do() waited %s after the context was cancelled", elapsed)
+	}
+	var llmErr *Error
+	if !errors.As(err, &llmErr) || llmErr.Status != http.StatusTooManyRequests {
+		t.Errorf("do() error = %v, want the last failure", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestThrottleStopsAcquiringWhenCancelled(t *testing.T) {
+	throttle := NewThrottle(0, 0, 1, 1, time.Millisecond, time.Millisecond)
+	throttle.slots <- struct{}{} // Another call holds the only slot
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	called := false
+	err := throttle.do(ctx, "test", func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) || called {
+		t.Errorf("do() = %v with called %t, want a deadline error before calling", err, called)
+	}
+}
@@ -0,0 +1,287 @@
+package markdown
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Document is a Markdown post with its front matter parsed
+type Document struct {
+	SourcePath string    // Path of the file inside the directory or archive it came from
+	Title      string    // Front matter title, else the first heading, else the file name
+	Slug       string    // Front matter slug, else derived from the file name
+	Tags       []string  // Front matter tags
+	Date       time.Time // Front matter date; zero if absent or unparseable
+	Content    string    // Markdown body without the front matter
+}
+
+// File is a raw Markdown file read from a directory or archive
+type File struct {
+	Path string
+	Data []byte
+}
+
+type frontMatter struct {
+	Title string      `yaml:"title"`
+	Slug  string      `yaml:"slug"`
+	Date  interface{} `yaml:"date"`
+	Tags  interface{} `yaml:"tags"`
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Limits on what an archive may expand to, so a small compressed upload cannot exhaust memory
+const (
+	maxArchiveFileBytes  = 4 << 20  // One Markdown file
+	maxArchiveTotalBytes = 64 << 20 // All Markdown files in one archive
+)
+
+var frontMatterEnd = regexp.MustCompile(`(?m)^---[ \t]*$`)
+var headingPattern = regexp.MustCompile(`(?m)^#\s+(.+)$`)
+var slugUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Parse splits a Markdown file into its YAML front matter and body
+func Parse(path string, data []byte) (*Document, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	var meta frontMatter
+	body := text
+	if strings.HasPrefix(text, "---\n") {
+		// The closing delimiter may directly follow the opening one when the front matter is empty
+		rest := text[4:]
+		closing := frontMatterEnd.FindStringIndex(rest)
+		if closing == nil {
+			return nil, fmt.Errorf("%s: front matter is not terminated", path)
+		}
+		if err := yaml.Unmarshal([]byte(rest[:closing[0]]), &meta); err != nil {
+			return nil, fmt.Errorf("%s: invalid front matter: %v", path, err)
+		}
+		body = strings.TrimPrefix(rest[closing[1]:], "\n")
+	}
+
+	doc := &Document{
+		SourcePath: path,
+		Title:      strings.TrimSpace(meta.Title),
+		Slug:       Slugify(meta.Slug),
+		Tags:       parseTags(meta.Tags),
+		Date:       parseDate(meta.Date),
+		Content:    strings.TrimSpace(body),
+	}
+
+	if doc.Title == "" {
+		if match := headingPattern.FindStringSubmatch(doc.Content); match != nil {
+			doc.Title = strings.TrimSpace(match[1])
+		} else {
+			doc.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+	}
+	if doc.Slug == "" {
+		doc.Slug = Slugify(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	if doc.Content == "" {
+		return nil, fmt.Errorf("%s: document has no content", path)
+	}
+
+	return doc, nil
+}
+
+// Slugify lowercases s and joins its alphanumeric runs with hyphens
+func Slugify(s string) string {
+	return strings.Trim(slugUnsafe.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+func parseTags(raw interface{}) []string {
+	var tags []string
+	switch v := raw.(type) {
+	case string:
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	case []interface{}:
+		for _, tag := range v {
+			if s := strings.TrimSpace(fmt.Sprint(tag)); s != "" {
+				tags = append(tags, s)
+			}
+		}
+	}
+	return tags
+}
+
+func parseDate(raw interface{}) time.Time {
+	switch v := raw.(type) {
+	case time.Time:
+		return v
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// IsMarkdown reports whether a path has a Markdown extension
+func IsMarkdown(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// ReadDir collects every Markdown file under dir, sorted by path
+func ReadDir(dir string) ([]File, error) {
+	var files []File
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !IsMarkdown(path) {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, File{Path: rel, Data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// ReadArchive collects every Markdown file from a .zip, .tar, .tar.gz or .tgz archive
+func ReadArchive(name string, data []byte) ([]File, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return readZip(data)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		return readTar(gz)
+	case strings.HasSuffix(lower, ".tar"):
+		return readTar(bytes.NewReader(data))
+	}
+	return nil, fmt.Errorf("unsupported archive type: %s", name)
+}
+
+// IsArchive reports whether a file name has a supported archive extension
+func IsArchive(name string) bool {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func readZip(data []byte) ([]File, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %v", err)
+	}
+
+	var files []File
+	budget := int64(maxArchiveTotalBytes)
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() || !IsMarkdown(entry.Name) || isHidden(entry.Name) {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", entry.Name, err)
+		}
+		content, err := readEntry(rc, entry.Name, &budget)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: entry.Name, Data: content})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func readTar(r io.Reader) ([]File, error) {
+	reader := tar.NewReader(r)
+	var files []File
+	budget := int64(maxArchiveTotalBytes)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid tar archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg || !IsMarkdown(header.Name) || isHidden(header.Name) {
+			continue
+		}
+		content, err := readEntry(reader, header.Name, &budget)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: header.Name, Data: content})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// readEntry reads one archive entry, failing once it exceeds maxArchiveFileBytes or the bytes left in budget.
+// Sizes recorded in archive headers are not trusted: the limits apply to the bytes actually decompressed.
+func readEntry(r io.Reader, name string, budget *int64) ([]byte, error) {
+	limit := min(int64(maxArchiveFileBytes), *budget)
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	if int64(len(content)) > limit {
+		if limit < maxArchiveFileBytes {
+			return nil, fmt.Errorf("archive expands to more than %d MiB of Markdown", maxArchiveTotalBytes>>20)
+		}
+		return nil, fmt.Errorf("%s is larger than %d MiB", name, maxArchiveFileBytes>>20)
+	}
+	*budget -= int64(len(content))
+	return content, nil
+}
+
+// isHidden skips metadata entries such as macOS "._" resource forks and "__MACOSX" folders
+func isHidden(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == "." || part == ".." {
+			continue
+		}
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
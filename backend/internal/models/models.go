@@ -43,10 +43,59 @@ type Narrative struct {
 	Title        string    `json:"title"`
 	Content      string    `json:"content"`
 	Extrapolated bool      `json:"extrapolated"`
+	Slug         string    `json:"slug,omitempty"` // Set for narratives imported from Markdown
+	Tags         []string  `json:"tags,omitempty"`
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt,omitempty"`
 }
 
+// NarrativeRevision is an immutable snapshot of a narrative's title and content
+type NarrativeRevision struct {
+	ID           string    `json:"id"`
+	NarrativeID  string    `json:"narrativeId"`
+	Number       int       `json:"number"` // 1-based, increasing with every update
+	Title        string    `json:"title"`
+	Content      string    `json:"content,omitempty"`
+	ContentHash  string    `json:"contentHash"`
+	EditorID     string    `json:"editorId,omitempty"`     // userID from the JWT of the editor, empty if unknown
+	RestoredFrom int       `json:"restoredFrom,omitempty"` // Revision number this one restored, if any
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type DiffLine struct {
+	Op   string `json:"op"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+// SearchHit is one ranked full-text match. Highlights maps each matched field to a snippet
+// with the query terms wrapped in <mark> tags.
+type SearchHit struct {
+	ID           string            `json:"id"`
+	Type         string            `json:"type"` // "narrative", "system", "stock" or "flow"
+	Name         string            `json:"name"` // Narrative title or concept name
+	Score        float64           `json:"score"`
+	Consolidated *bool             `json:"consolidated,omitempty"` // Concepts only
+	Highlights   map[string]string `json:"highlights"`
+}
+
+type SemanticSearchRequest struct {
+	Query         string   `json:"query" binding:"required"`
+	Types         []string `json:"types,omitempty"`         // Subset of narrative, system, stock, flow; defaults to all
+	Limit         int      `json:"limit,omitempty"`         // Top-k hits, default 10
+	MinSimilarity float64  `json:"minSimilarity,omitempty"` // Cosine similarity below which hits are dropped
+}
+
+// SemanticSearchHit is one concept or narrative ranked by embedding similarity to the query. Narratives are
+// ranked by the best of the consolidated concepts they support, which are listed in Concepts.
+type SemanticSearchHit struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"` // "narrative", "system", "stock" or "flow"
+	Name        string   `json:"name"` // Narrative title or concept name
+	Description string   `json:"description,omitempty"`
+	Score       float64  `json:"score"`
+	Concepts    []string `json:"concepts,omitempty"` // Narratives only: ids of the matching concepts they support
+}
+
 type System struct {
 	ID                  string    `json:"id"`
 	Name                string    `json:"name"`
@@ -132,13 +181,118 @@ type CausalLink struct {
 	ConsolidationScore int     `json:"consolidationScore"` // Number of relationships consolidated
 }
 
+// ImportReport summarizes a Markdown import; every file gets exactly one entry in Files
+type ImportReport struct {
+	Created          int                `json:"created"`
+	Updated          int                `json:"updated"`
+	Skipped          int                `json:"skipped"`
+	Failed           int                `json:"failed"`
+	AnalysisQueued   int                `json:"analysisQueued"`
+	AwaitingApproval int                `json:"awaitingApproval,omitempty"` // Staged nodes left for review; counted when the import waits for analysis
+	Files            []ImportFileResult `json:"files"`
+}
+
+type ImportFileResult struct {
+	Path        string `json:"path"`
+	Slug        string `json:"slug,omitempty"`
+	NarrativeID string `json:"narrativeId,omitempty"`
+	Status      string `json:"status"` // "created", "updated", "skipped" or "failed"
+	Reason      string `json:"reason,omitempty"`
+}
+
 type AnalyzeNarrativeRequest struct {
-	NarrativeID string `json:"id"`
+	NarrativeID     string                  `json:"id"`
+	ExtractionMode  string                  `json:"extractionMode,omitempty"`  // "json", "functions" or "staged"; defaults to EXTRACTION_MODE
+	SelfConsistency *SelfConsistencyOptions `json:"selfConsistency,omitempty"` // Draw several extractions and keep what they agree on
+	Critic          string                  `json:"critic,omitempty"`          // "off", "flag" or "repair"; defaults to EXTRACTION_CRITIC
+}
+
+type AnalyzePendingRequest struct {
+	Concurrency       int                     `json:"concurrency,omitempty"`       // Narratives analyzed in parallel
+	RequestsPerMinute int                     `json:"requestsPerMinute,omitempty"` // Upper bound on LLM generation calls per minute across the batch
+	ProcessEmbeddings bool                    `json:"processEmbeddings,omitempty"` // Run ProcessEmbeddings after the batch
+	Consolidate       bool                    `json:"consolidate,omitempty"`       // Run ConsolidateGraph after embeddings
+	ExtractionMode    string                  `json:"extractionMode,omitempty"`    // "json", "functions" or "staged"; defaults to EXTRACTION_MODE
+	SelfConsistency   *SelfConsistencyOptions `json:"selfConsistency,omitempty"`   // Applied to every narrative in the batch
+	Critic            string                  `json:"critic,omitempty"`            // "off", "flag" or "repair"; defaults to EXTRACTION_CRITIC
+}
+
+type AnalysisPreviewRequest struct {
+	ExtractionMode  string                  `json:"extractionMode,omitempty"`  // "json", "functions" or "staged"; defaults to EXTRACTION_MODE
+	SelfConsistency *SelfConsistencyOptions `json:"selfConsistency,omitempty"` // Draw several extractions and keep what they agree on
+	Critic          string                  `json:"critic,omitempty"`          // "off", "flag" or "repair"; defaults to EXTRACTION_CRITIC
+}
+
+type CommitAnalysisRequest struct {
+	DraftID     string      `json:"draftId" binding:"required"`
+	Actions     []LLMAction `json:"actions,omitempty"`     // Edited plan; omit to commit the draft as previewed
+	SkipInvalid bool        `json:"skipInvalid,omitempty"` // Commit even when some actions cannot be resolved; they are skipped
+}
+
+// Staging-area requests edit unconsolidated extractions before they are consolidated
+type StagingNodeUpdateRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"` // Boundary description for systems
+	StockType   *string `json:"stockType,omitempty"`   // Stocks only: "qualitative" or "quantitative"
+}
+
+type StagingRetypeRequest struct {
+	Type                     string `json:"type" binding:"required"` // "system", "stock" or "flow"
+	StockType                string `json:"stockType,omitempty"`     // Required when retyping to a stock
+	DropInvalidRelationships bool   `json:"dropInvalidRelationships,omitempty"`
+}
+
+// RelationshipRequest creates a relationship between two model elements by hand
+type RelationshipRequest struct {
+	Type           string   `json:"type" binding:"required"` // "CONSTITUTES", "DESCRIBES_STATIC", "DESCRIBES_DYNAMIC", "CHANGES" or "CAUSAL_LINK"
+	FromID         string   `json:"fromId" binding:"required"`
+	ToID           string   `json:"toId" binding:"required"`
+	Polarity       *float64 `json:"polarity,omitempty"`       // CHANGES only: +1 or -1
+	Question       string   `json:"question,omitempty"`       // CAUSAL_LINK only
+	CuriosityScore *float64 `json:"curiosityScore,omitempty"` // CAUSAL_LINK only, between 0 and 1
+}
+
+// RelationshipUpdateRequest edits a relationship; only the fields that are set change
+type RelationshipUpdateRequest struct {
+	Polarity       *float64 `json:"polarity,omitempty"`       // CHANGES only
+	Question       *string  `json:"question,omitempty"`       // CAUSAL_LINK only
+	CuriosityScore *float64 `json:"curiosityScore,omitempty"` // CAUSAL_LINK only
+}
+
+// ElementUpdateRequest edits a System, Stock or Flow; only the fields that are set change
+type ElementUpdateRequest struct {
+	Name                *string `json:"name,omitempty"`
+	BoundaryDescription *string `json:"boundaryDescription,omitempty"` // Systems only
+	Description         *string `json:"description,omitempty"`         // Stocks and flows only
+	Type                *string `json:"type,omitempty"`                // Stocks only: "qualitative" or "quantitative"
+}
+
+type StagingApprovalRequest struct {
+	NarrativeID     string   `json:"narrativeId,omitempty"` // Every staged node and relationship extracted from the narrative
+	NodeIDs         []string `json:"nodeIds,omitempty"`
+	RelationshipIDs []string `json:"relationshipIds,omitempty"`
+	Approved        *bool    `json:"approved,omitempty"` // Defaults to true; false withdraws approval
+}
+
+type RerunExtractionStageRequest struct {
+	Critic string `json:"critic,omitempty"` // Critic applied when the rerun completes the run; defaults to EXTRACTION_CRITIC
+}
+
+// SelfConsistencyOptions configure self-consistency extraction: the narrative is extracted Samples times,
+// elements are aligned across samples by name and embedding, and only those found in MinSupport samples are kept
+type SelfConsistencyOptions struct {
+	Samples     int      `json:"samples"`               // Extractions drawn; 1 or less disables self-consistency
+	MinSupport  int      `json:"minSupport,omitempty"`  // Samples an element must appear in; defaults to a majority
+	Temperature *float64 `json:"temperature,omitempty"` // Sampling temperature; defaults to 0.7
+	Models      []string `json:"models,omitempty"`      // Models the samples rotate through; defaults to the configured model
 }
 
 type LLMAction struct {
-	FunctionName string                 `json:"function_name"`
-	Parameters   map[string]interface{} `json:"parameters"`
+	FunctionName  string                 `json:"function_name"`
+	Parameters    map[string]interface{} `json:"parameters"`
+	SourceChunks  []int                  `json:"sourceChunks,omitempty"`  // Narrative chunks this action was extracted from
+	Confidence    float64                `json:"confidence,omitempty"`    // Share of self-consistency samples containing the action
+	PromptVersion string                 `json:"promptVersion,omitempty"` // Prompt that extracted the action, when it differs between actions of a plan
 }
 type LLMResponse struct {
 	Actions []LLMAction `json:"actions"`
@@ -152,6 +306,7 @@ type NodeMatch struct {
 	SimilarityScore  float64 `json:"similarityScore"`
 	NewName          string  `json:"newName,omitempty"`        // Synthesized name
 	NewDescription   string  `json:"newDescription,omitempty"` // Synthesized description
+	PromptVersion    string  `json:"promptVersion,omitempty"`  // Synthesis prompt that produced NewName
 }
 
 type RelationshipConsolidation struct {
@@ -161,4 +316,8 @@ type RelationshipConsolidation struct {
 	ConsolidatedFrom string                 `json:"consolidatedFrom"` // Mapped consolidated node ID
 	ConsolidatedTo   string                 `json:"consolidatedTo"`   // Mapped consolidated node ID
 	Properties       map[string]interface{} `json:"properties"`       // Additional relationship properties
+	ElementID        string                 `json:"elementId"`        // Neo4j element id of the unconsolidated relationship
+	Approved         bool                   `json:"approved"`         // Approved in the staging area
+	FromSettled      bool                   `json:"fromSettled"`      // From is a narrative or an already consolidated node
+	ToSettled        bool                   `json:"toSettled"`        // To is a narrative or an already consolidated node
 }
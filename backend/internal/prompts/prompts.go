@@ -0,0 +1,200 @@
+// Package prompts holds the versioned prompt templates sent to the LLM. Built-in versions are embedded in
+// the binary; further versions can be loaded from a directory laid out as <dir>/<name>/<version>/system.txt
+// and user.txt.
+package prompts
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed builtin
+var builtinFS embed.FS
+
+// Template names
+const (
+	Extraction          = "extraction"           // Turns a narrative chunk into an action plan
+	ExtractionFunctions = "extraction_functions" // Extraction answered with native function calls instead of JSON
+	Synthesis           = "synthesis"            // Merges two similar nodes into one name and description
+	Critique            = "critique"             // Reviews an extracted action plan against the extraction rules
+	Repair              = "repair"               // Rewrites the actions of a plan that break the extraction rules
+	StageSystems        = "stage_systems"        // Staged extraction, stage 1: systems and their boundaries
+	StageComponents     = "stage_components"     // Staged extraction, stage 2: stocks and flows of each system
+	StageConnections    = "stage_connections"    // Staged extraction, stage 3: CHANGES and CONSTITUTES relationships
+	StageHypotheses     = "stage_hypotheses"     // Staged extraction, stage 4: causal-link hypotheses
+)
+
+// DefaultVersion is the built-in version used until another one is activated
+const DefaultVersion = "v1"
+
+// Template sources
+const (
+	SourceBuiltin = "builtin"
+	SourceFile    = "file"
+	SourceAPI     = "api"
+)
+
+// Spec describes what each named template is for and how many %s verbs its user template takes
+type Spec struct {
+	Description string
+	UserVerbs   int
+}
+
+// Specs lists the known template names
+var Specs = map[string]Spec{
+	Extraction:          {Description: "Narrative extraction; user template takes the existing concepts, title and content", UserVerbs: 3},
+	ExtractionFunctions: {Description: "Narrative extraction by function calling; user template takes the existing concepts, title and content", UserVerbs: 3},
+	Synthesis:           {Description: "Node name synthesis; user template takes the node type, then name and description of nodes A and B", UserVerbs: 5},
+	Critique:            {Description: "Plan critique; user template takes the numbered actions", UserVerbs: 1},
+	Repair:              {Description: "Plan repair; user template takes the numbered actions, then the actions to correct with their violations", UserVerbs: 2},
+	StageSystems:        {Description: "Staged extraction of systems; user template takes the existing concepts, title, content and previous stages", UserVerbs: 4},
+	StageComponents:     {Description: "Staged extraction of stocks and flows; user template takes the existing concepts, title, content and previous stages", UserVerbs: 4},
+	StageConnections:    {Description: "Staged extraction of CHANGES and CONSTITUTES; user template takes the existing concepts, title, content and previous stages", UserVerbs: 4},
+	StageHypotheses:     {Description: "Staged extraction of causal links; user template takes the existing concepts, title, content and previous stages", UserVerbs: 4},
+}
+
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Template is one version of a named prompt
+type Template struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	System  string `json:"system"`
+	User    string `json:"user"`
+	Source  string `json:"source"` // "builtin", "file" or "api"
+}
+
+// Ref identifies the template version, e.g. "extraction@v1". It is what gets stamped on generated data.
+func (t Template) Ref() string {
+	return t.Name + "@" + t.Version
+}
+
+// Validate checks the name, version and the number of %s verbs in the user template
+func (t Template) Validate() error {
+	spec, ok := Specs[t.Name]
+	if !ok {
+		return fmt.Errorf("unknown prompt name %q", t.Name)
+	}
+	if !versionPattern.MatchString(t.Version) {
+		return fmt.Errorf("invalid version %q: use letters, digits, '.', '_' or '-'", t.Version)
+	}
+	if strings.TrimSpace(t.System) == "" || strings.TrimSpace(t.User) == "" {
+		return fmt.Errorf("%s: system and user templates are required", t.Ref())
+	}
+	verbs, err := countUserVerbs(t.User)
+	if err != nil {
+		return fmt.Errorf("%s: %v", t.Ref(), err)
+	}
+	if verbs != spec.UserVerbs {
+		return fmt.Errorf("%s: user template must contain %d %%s verbs, found %d", t.Ref(), spec.UserVerbs, verbs)
+	}
+	return nil
+}
+
+// countUserVerbs counts the %s verbs of a user template. The template is rendered with fmt.Sprintf, so any
+// other verb is rejected; a literal percent sign is written %%.
+func countUserVerbs(template string) (int, error) {
+	verbs := 0
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			continue
+		}
+		if i+1 == len(template) {
+			return 0, fmt.Errorf("user template ends with a lone %%; write a literal percent sign as %%%%")
+		}
+		i++
+		switch template[i] {
+		case 's':
+			verbs++
+		case '%':
+		default:
+			verb, _ := utf8.DecodeRuneInString(template[i:])
+			return 0, fmt.Errorf("user template contains %%%c; only %%s verbs are allowed, write a literal percent sign as %%%%", verb)
+		}
+	}
+	return verbs, nil
+}
+
+// Builtin returns the embedded templates
+func Builtin() ([]Template, error) {
+	return loadFS(builtinFS, "builtin", SourceBuiltin)
+}
+
+// BuiltinDefault returns the embedded default version of a named template
+func BuiltinDefault(name string) Template {
+	return Template{
+		Name:    name,
+		Version: DefaultVersion,
+		System:  mustReadBuiltin(name, "system.txt"),
+		User:    mustReadBuiltin(name, "user.txt"),
+		Source:  SourceBuiltin,
+	}
+}
+
+func mustReadBuiltin(name, file string) string {
+	data, err := builtinFS.ReadFile(path.Join("builtin", name, DefaultVersion, file))
+	if err != nil {
+		panic(fmt.Sprintf("missing built-in prompt %s/%s: %v", name, file, err))
+	}
+	return string(data)
+}
+
+// LoadDir returns the templates under dir. A missing directory yields no templates.
+func LoadDir(dir string) ([]Template, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return loadFS(os.DirFS(filepath.Clean(dir)), ".", SourceFile)
+}
+
+func loadFS(fsys fs.FS, root, source string) ([]Template, error) {
+	var templates []Template
+	names, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	for _, nameEntry := range names {
+		if !nameEntry.IsDir() {
+			continue
+		}
+		versions, err := fs.ReadDir(fsys, path.Join(root, nameEntry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, versionEntry := range versions {
+			if !versionEntry.IsDir() {
+				continue
+			}
+			dir := path.Join(root, nameEntry.Name(), versionEntry.Name())
+			system, err := fs.ReadFile(fsys, path.Join(dir, "system.txt"))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", dir, err)
+			}
+			user, err := fs.ReadFile(fsys, path.Join(dir, "user.txt"))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", dir, err)
+			}
+			template := Template{
+				Name:    nameEntry.Name(),
+				Version: versionEntry.Name(),
+				System:  string(system),
+				User:    string(user),
+				Source:  source,
+			}
+			if err := template.Validate(); err != nil {
+				return nil, err
+			}
+			templates = append(templates, template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Ref() < templates[j].Ref() })
+	return templates, nil
+}
@@ -0,0 +1,50 @@
+package prompts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTemplatesValidate(t *testing.T) {
+	templates, err := Builtin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, template := range templates {
+		if err := template.Validate(); err != nil {
+			t.Errorf("Validate(%s) error = %v", template.Ref(), err)
+		}
+	}
+}
+
+func TestValidateUserVerbs(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		wantErr string
+	}{
+		{"one verb", "Actions:\n%s", ""},
+		{"escaped percent", "Keep 100%% of the actions:\n%s", ""},
+		{"escaped percent before s", "%%s is not a verb:\n%s", ""},
+		{"literal percent", "Keep 50% of the actions:\n%s", "contains % "},
+		{"other verb", "Actions:\n%d", "contains %d"},
+		{"trailing percent", "Actions:\n%s 100%", "lone %"},
+		{"too few verbs", "No actions", "must contain 1 %s verbs, found 0"},
+		{"too many verbs", "%s and %s", "must contain 1 %s verbs, found 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := Template{Name: Critique, Version: "v2", System: "system", User: tt.user}
+			err := template.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}